@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	accountDelivery "github.com/ell1jah/bmstu_web/internal/account/delivery"
+	accountLogic "github.com/ell1jah/bmstu_web/internal/account/logic"
+	collectionDelivery "github.com/ell1jah/bmstu_web/internal/collection/delivery"
+	collectionLogic "github.com/ell1jah/bmstu_web/internal/collection/logic"
+	commentDelivery "github.com/ell1jah/bmstu_web/internal/comment/delivery"
+	commentLogic "github.com/ell1jah/bmstu_web/internal/comment/logic"
+	eventDelivery "github.com/ell1jah/bmstu_web/internal/event/delivery"
+	eventLogic "github.com/ell1jah/bmstu_web/internal/event/logic"
+	followDelivery "github.com/ell1jah/bmstu_web/internal/follow/delivery"
+	followLogic "github.com/ell1jah/bmstu_web/internal/follow/logic"
+	imageDelivery "github.com/ell1jah/bmstu_web/internal/image/delivery"
+	imageLogic "github.com/ell1jah/bmstu_web/internal/image/logic"
+	"github.com/ell1jah/bmstu_web/internal/pkg/httperror"
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/middleware"
+	"github.com/ell1jah/bmstu_web/internal/pkg/oidc"
+	"github.com/ell1jah/bmstu_web/internal/pkg/password"
+	"github.com/ell1jah/bmstu_web/internal/pkg/ratelimit"
+	"github.com/ell1jah/bmstu_web/internal/pkg/replica"
+	postDelivery "github.com/ell1jah/bmstu_web/internal/post/delivery"
+	postLogic "github.com/ell1jah/bmstu_web/internal/post/logic"
+	reportDelivery "github.com/ell1jah/bmstu_web/internal/report/delivery"
+	reportLogic "github.com/ell1jah/bmstu_web/internal/report/logic"
+	userDelivery "github.com/ell1jah/bmstu_web/internal/user/delivery"
+	userLogic "github.com/ell1jah/bmstu_web/internal/user/logic"
+
+	echojwt "github.com/labstack/echo-jwt/v4"
+	"github.com/labstack/echo/v4"
+	echoMiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.uber.org/zap"
+)
+
+// each repository serves every logic using it
+type (
+	userRepo interface {
+		userLogic.UserRepository
+		accountLogic.UserRepository
+		postLogic.UserRepository
+		commentLogic.UserRepository
+		followLogic.UserRepository
+		reportLogic.UserRepository
+	}
+	postRepo interface {
+		userLogic.PostRepository
+		accountLogic.PostRepository
+		postLogic.PostRepository
+		eventLogic.PostRepository
+		reportLogic.PostRepository
+	}
+	rateRepo interface {
+		userLogic.RateRepository
+		accountLogic.RateRepository
+		postLogic.RateRepository
+	}
+	commentRepo interface {
+		accountLogic.CommentRepository
+		commentLogic.CommentRepository
+		reportLogic.CommentRepository
+	}
+	followRepo interface {
+		userLogic.FollowRepository
+		followLogic.FollowRepository
+	}
+	collectionRepo interface {
+		postLogic.CollectionRepository
+		collectionLogic.CollectionRepository
+	}
+	eventBroker interface {
+		postLogic.EventPublisher
+		eventLogic.EventSubscriber
+	}
+)
+
+// services is what the app is run on, Postgres in production and memdb
+// in the tests.
+type services struct {
+	users       userRepo
+	posts       postRepo
+	rates       rateRepo
+	comments    commentRepo
+	follows     followRepo
+	collections collectionRepo
+	reports     reportLogic.ReportRepository
+
+	rateStore ratelimit.Store
+	events    eventBroker
+	txManager userLogic.TxManager
+	mail      userLogic.Mailer
+}
+
+// setUp adds the middleware and routes of the app to e and starts its
+// background work, which stops with ctx.
+func setUp(ctx context.Context, e *echo.Echo, svc *services) error {
+	loginGuard := ratelimit.NewBackoffGuard(svc.rateStore, "signin:login:", loginBackoff)
+	ipGuard := ratelimit.NewBackoffGuard(svc.rateStore, "signin:ip:", ipBackoff)
+
+	providers := make(map[string]userLogic.OIDCProvider, len(oidcProviders))
+	for _, cfg := range oidcProviders {
+		providers[cfg.Name] = oidc.NewProvider(cfg)
+	}
+
+	passwordHasher := password.NewHasher(passwordHashing)
+
+	imageLogic := imageLogic.NewLogic()
+	go imageLogic.RunStorageScan(ctx, imageScanPeriod)
+	userLogic := userLogic.NewLogic(svc.users, svc.posts, svc.rates, svc.follows, imageLogic,
+		loginGuard, ipGuard, svc.mail, passwordHasher, passwordPolicy,
+		providers, svc.txManager, accountCfg)
+	accountLogic := accountLogic.NewLogic(svc.users, svc.posts, svc.comments, svc.rates, imageLogic,
+		passwordHasher, svc.mail, svc.txManager, accountDeletion)
+	// the deletions are claimed on the primary, replicas may not have them yet
+	go accountLogic.RunDeletions(replica.WithPrimary(ctx))
+	postLogic := postLogic.NewLogic(svc.posts, svc.users, svc.rates, svc.collections, svc.txManager, svc.events)
+	go postLogic.RunScoring(ctx, scoringPeriod)
+	commentLogic := commentLogic.NewLogic(svc.comments, svc.users, svc.events)
+	eventLogic := eventLogic.NewLogic(svc.posts, svc.events)
+	followLogic := followLogic.NewLogic(svc.follows, svc.users)
+	collectionLogic := collectionLogic.NewLogic(svc.collections, postLogic)
+	reportLogic := reportLogic.NewLogic(svc.reports, svc.posts, svc.comments, svc.users,
+		postLogic, commentLogic, svc.txManager, reportHideThreshold)
+
+	_, proxies, err := net.ParseCIDR(trustedProxies)
+	if err != nil {
+		return errors.Wrap(err, "trusted proxies")
+	}
+	e.IPExtractor = echo.ExtractIPFromRealIPHeader(
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+		echo.TrustIPRange(proxies),
+	)
+
+	e.HTTPErrorHandler = httperror.NewHandler(debugErrors)
+
+	// echo's own lines, its default header is JSON as well
+	e.Logger.SetLevel(log.INFO)
+
+	// the request's span is in the context the request logger passes on
+	e.Use(otelecho.Middleware(tracingCfg.ServiceName))
+	e.Use(middleware.NewRequestLogger().Handle)
+	e.Use(echoMiddleware.RecoverWithConfig(echoMiddleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			logger.Ctx(c.Request().Context(), "http").Error("panic", zap.Error(err), zap.ByteString("stack", stack))
+			return err
+		},
+	}))
+	e.Use(middleware.NewReadYourWrites(replicaRouting.StickyFor).Handle)
+
+	e.GET("/swagger/*", echoSwagger.WrapHandler)
+
+	jwtKeys, err := jwtManager.LoadKeySet(jwtKeysDir, jwtActiveKey)
+	if err != nil {
+		return errors.Wrap(err, "load jwt keys")
+	}
+	sessionManager := jwtManager.NewJWTSessionsManager(jwtKeys, jwtIssuer, jwtAudience, sessionTTL)
+
+	e.GET("/.well-known/jwks.json", func(c echo.Context) error {
+		c.Response().Header().Set("Cache-Control", "public, max-age=300")
+		return c.JSON(http.StatusOK, jwtKeys.JWKS())
+	})
+
+	jwtMiddleware := echojwt.WithConfig(echojwt.Config{
+		ParseTokenFunc: func(c echo.Context, auth string) (interface{}, error) {
+			return sessionManager.ParseSession(auth)
+		},
+	})
+
+	accessMiddleware := middleware.NewAuthMiddleware(jwtMiddleware, userLogic, userLogic, userStatusTTL)
+	authMiddleware := accessMiddleware.Auth()
+	rateLimiter := middleware.NewRateLimiter(svc.rateStore, routeLimits)
+
+	userDelivery.NewHandler(userLogic, sessionManager, accessMiddleware).SetRoutes(e, authMiddleware, accessMiddleware, rateLimiter)
+	accountDelivery.NewHandler(accountLogic).SetRoutes(e, authMiddleware, rateLimiter)
+	postDelivery.NewHandler(postLogic).SetRoutes(e, authMiddleware, accessMiddleware)
+	commentDelivery.NewHandler(commentLogic).SetRoutes(e, authMiddleware, accessMiddleware, rateLimiter)
+	imageDelivery.NewHandler(imageLogic).SetRoutes(e, authMiddleware, accessMiddleware, rateLimiter)
+	eventDelivery.NewHandler(eventLogic).SetRoutes(e, authMiddleware, accessMiddleware)
+	followDelivery.NewHandler(followLogic).SetRoutes(e, authMiddleware, accessMiddleware)
+	collectionDelivery.NewHandler(collectionLogic).SetRoutes(e, authMiddleware, accessMiddleware)
+	reportDelivery.NewHandler(reportLogic).SetRoutes(e, authMiddleware, accessMiddleware)
+
+	return nil
+}
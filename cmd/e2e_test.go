@@ -0,0 +1,694 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	collectionRepository "github.com/ell1jah/bmstu_web/internal/collection/repository"
+	commentRepository "github.com/ell1jah/bmstu_web/internal/comment/repository"
+	followRepository "github.com/ell1jah/bmstu_web/internal/follow/repository"
+	"github.com/ell1jah/bmstu_web/internal/pkg/eventbus"
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/internal/pkg/password"
+	"github.com/ell1jah/bmstu_web/internal/pkg/pgtest"
+	"github.com/ell1jah/bmstu_web/internal/pkg/ratelimit"
+	"github.com/ell1jah/bmstu_web/internal/pkg/totp"
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	postRepository "github.com/ell1jah/bmstu_web/internal/post/repository"
+	rateRepository "github.com/ell1jah/bmstu_web/internal/rate/repository"
+	reportRepository "github.com/ell1jah/bmstu_web/internal/report/repository"
+	userRepository "github.com/ell1jah/bmstu_web/internal/user/repository"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestMain(m *testing.M) {
+	// the access lines of every request aren't worth reading in a test
+	logger.Init(logger.Config{Level: zapcore.WarnLevel})
+	govalidator.SetFieldsRequiredByDefault(true)
+	pgtest.Main(m)
+}
+
+func newMemoryServices(t *testing.T) *services {
+	db := memdb.New()
+
+	return &services{
+		users:       userRepository.NewMemoryRepo(db),
+		posts:       postRepository.NewMemoryRepo(db),
+		rates:       rateRepository.NewMemoryRepo(db),
+		comments:    commentRepository.NewMemoryRepo(db),
+		follows:     followRepository.NewMemoryRepo(db),
+		collections: collectionRepository.NewMemoryRepo(db),
+		reports:     reportRepository.NewMemoryRepo(db),
+
+		rateStore: ratelimit.NewMemoryStore(),
+		events:    eventbus.NewBus(),
+		txManager: db,
+		mail:      &testMailer{},
+	}
+}
+
+func newPgServices(t *testing.T) *services {
+	db := pgtest.New(t)
+
+	return &services{
+		users:       userRepository.NewPgRepo(db),
+		posts:       postRepository.NewPgRepo(db),
+		rates:       rateRepository.NewPgRepo(db),
+		comments:    commentRepository.NewPgRepo(db),
+		follows:     followRepository.NewPgRepo(db),
+		collections: collectionRepository.NewPgRepo(db),
+		reports:     reportRepository.NewPgRepo(db),
+
+		rateStore: ratelimit.NewPgStore(db),
+		events:    eventbus.NewBus(),
+		txManager: txmanager.NewManager(db, txConfig),
+		mail:      &testMailer{},
+	}
+}
+
+// testMailer keeps the mails for the tests to read the codes in them.
+type testMailer struct {
+	mu     sync.Mutex
+	bodies map[string]string
+}
+
+func (tm *testMailer) Send(to, subject, body string) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.bodies == nil {
+		tm.bodies = make(map[string]string)
+	}
+	tm.bodies[to] = body
+
+	return nil
+}
+
+// lastMail is the body of the latest mail sent to to.
+func (tm *testMailer) lastMail(to string) string {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	return tm.bodies[to]
+}
+
+// forEachServices runs test on an app set up on every kind of services.
+func forEachServices(t *testing.T, test func(t *testing.T, app *testApp)) {
+	kinds := []struct {
+		name string
+		new  func(t *testing.T) *services
+	}{
+		{"memory", newMemoryServices},
+		{"postgres", newPgServices},
+	}
+
+	for _, kind := range kinds {
+		kind := kind
+		t.Run(kind.name, func(t *testing.T) {
+			test(t, newTestApp(t, kind.new(t)))
+		})
+	}
+}
+
+type testApp struct {
+	e   *echo.Echo
+	svc *services
+}
+
+// newTestApp sets the app up in a temporary working directory holding
+// its images and a fresh signing key.
+func newTestApp(t *testing.T, svc *services) *testApp {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+
+	err = os.Mkdir("images", 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKey(t, filepath.Join(jwtKeysDir, jwtActiveKey+".pem"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	e := echo.New()
+	e.Logger.SetOutput(&bytes.Buffer{})
+	err = setUp(ctx, e, svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testApp{e: e, svc: svc}
+}
+
+func writeKey(t *testing.T, path string) {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// do sends the request with token as the session, if any, checks the
+// response has the status wanted and decodes its body into resp, if not nil.
+func (app *testApp) do(t *testing.T, req *http.Request, token string, status int, resp interface{}) {
+	t.Helper()
+
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	app.e.ServeHTTP(rec, req)
+
+	if rec.Code != status {
+		t.Fatalf("%s %s = %d %s, want %d", req.Method, req.URL, rec.Code, rec.Body, status)
+	}
+
+	if resp != nil {
+		err := json.Unmarshal(rec.Body.Bytes(), resp)
+		if err != nil {
+			t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+		}
+	}
+}
+
+func (app *testApp) doJSON(t *testing.T, method, path, token string, body interface{}, status int, resp interface{}) {
+	t.Helper()
+
+	reader := bytes.NewReader(nil)
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+
+	app.do(t, req, token, status, resp)
+}
+
+func (app *testApp) signUp(t *testing.T, login string) string {
+	t.Helper()
+
+	var resp dto.RespToken
+	app.doJSON(t, http.MethodPost, "/users/signup", "",
+		dto.ReqSign{Login: login, Password: "Correct-horse-42"}, http.StatusCreated, &resp)
+
+	return resp.Token
+}
+
+// signUpAdmin promotes the user before the first request made with the
+// session, so no server has cached the role it signed up with.
+func (app *testApp) signUpAdmin(t *testing.T, login string) string {
+	t.Helper()
+
+	token := app.signUp(t, login)
+
+	user, err := app.svc.users.GetUserByLogin(context.Background(), login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.svc.users.UpdateRole(context.Background(), user.ID, model.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func (app *testApp) uploadImage(t *testing.T, token string, image []byte) string {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("Image", "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(image)
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/images", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+
+	var resp dto.RespImage
+	app.do(t, req, token, http.StatusCreated, &resp)
+
+	return resp.ID
+}
+
+func TestSignUpAndSignIn(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		app.signUp(t, "alice_login")
+
+		// the login is taken
+		app.doJSON(t, http.MethodPost, "/users/signup", "",
+			dto.ReqSign{Login: "alice_login", Password: "Correct-horse-42"}, http.StatusConflict, nil)
+
+		app.doJSON(t, http.MethodPost, "/users/signin", "",
+			dto.ReqSign{Login: "alice_login", Password: "Wrong-horse-42"}, http.StatusBadRequest, nil)
+
+		var token dto.RespToken
+		app.doJSON(t, http.MethodPost, "/users/signin", "",
+			dto.ReqSign{Login: "alice_login", Password: "Correct-horse-42"}, http.StatusOK, &token)
+
+		var me dto.RespUser
+		app.doJSON(t, http.MethodGet, "/users/me", token.Token, nil, http.StatusOK, &me)
+		if me.Login != "alice_login" {
+			t.Fatalf("login = %q, want %q", me.Login, "alice_login")
+		}
+
+		app.doJSON(t, http.MethodGet, "/users/me", "", nil, http.StatusUnauthorized, nil)
+	})
+}
+
+func TestTOTPStepReplay(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		alice := app.signUp(t, "alice_login")
+
+		var enrollment dto.RespTOTPEnrollment
+		app.doJSON(t, http.MethodPost, "/users/me/2fa", alice, nil, http.StatusOK, &enrollment)
+
+		code := func(at time.Time) string {
+			c, err := totp.Code(enrollment.Secret, at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}
+		signIn := func(code string, status int) {
+			t.Helper()
+
+			var challenge dto.RespChallenge
+			app.doJSON(t, http.MethodPost, "/users/signin", "",
+				dto.ReqSign{Login: "alice_login", Password: "Correct-horse-42"}, http.StatusOK, &challenge)
+			if !challenge.TwoFactorRequired {
+				t.Fatal("no second factor asked")
+			}
+			app.doJSON(t, http.MethodPost, "/users/signin/2fa", "",
+				dto.ReqSecondFactor{Challenge: challenge.Challenge, Code: code}, status, nil)
+		}
+
+		now := time.Now()
+		app.doJSON(t, http.MethodPost, "/users/me/2fa/enable", alice,
+			dto.ReqCode{Code: code(now)}, http.StatusOK, nil)
+
+		// the step spent enabling is spent for signing in too
+		signIn(code(now), http.StatusUnauthorized)
+
+		// the next step is within the skew window, but once only
+		next := code(now.Add(30 * time.Second))
+		signIn(next, http.StatusOK)
+		signIn(next, http.StatusUnauthorized)
+	})
+}
+
+func TestTOTPChallengeRetry(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		alice := app.signUp(t, "alice_login")
+
+		var enrollment dto.RespTOTPEnrollment
+		app.doJSON(t, http.MethodPost, "/users/me/2fa", alice, nil, http.StatusOK, &enrollment)
+
+		now := time.Now()
+		code, err := totp.Code(enrollment.Secret, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var recovery dto.RespRecoveryCodes
+		app.doJSON(t, http.MethodPost, "/users/me/2fa/enable", alice,
+			dto.ReqCode{Code: code}, http.StatusOK, &recovery)
+
+		var challenge dto.RespChallenge
+		app.doJSON(t, http.MethodPost, "/users/signin", "",
+			dto.ReqSign{Login: "alice_login", Password: "Correct-horse-42"}, http.StatusOK, &challenge)
+
+		// a mistyped code leaves the challenge for the right one
+		app.doJSON(t, http.MethodPost, "/users/signin/2fa", "",
+			dto.ReqSecondFactor{Challenge: challenge.Challenge, Code: "000000"}, http.StatusUnauthorized, nil)
+		app.doJSON(t, http.MethodPost, "/users/signin/2fa", "",
+			dto.ReqSecondFactor{Challenge: challenge.Challenge, Code: recovery.Codes[0]}, http.StatusOK, nil)
+
+		// which spends it
+		app.doJSON(t, http.MethodPost, "/users/signin/2fa", "",
+			dto.ReqSecondFactor{Challenge: challenge.Challenge, Code: recovery.Codes[1]}, http.StatusBadRequest, nil)
+	})
+}
+
+func TestPostFlow(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		alice := app.signUp(t, "alice_login")
+		bob := app.signUp(t, "bob_login")
+
+		image := []byte("\x89PNG not really")
+		imageId := app.uploadImage(t, alice, image)
+
+		req := httptest.NewRequest(http.MethodGet, "/images/"+imageId, nil)
+		rec := httptest.NewRecorder()
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+bob)
+		app.e.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), image) {
+			t.Fatalf("GET image = %d %q, want %d %q", rec.Code, rec.Body, http.StatusOK, image)
+		}
+
+		// a post needs an uploaded image
+		app.doJSON(t, http.MethodPost, "/posts", alice, dto.ReqPost{
+			ImageID: "missing", Category: "shoes", Sex: "female", Brand: "brand", Description: "description", Link: "link",
+		}, http.StatusBadRequest, nil)
+
+		var post dto.RespPost
+		app.doJSON(t, http.MethodPost, "/posts", alice, dto.ReqPost{
+			ImageID: imageId, Category: "shoes", Sex: "female", Brand: "brand", Description: "description", Link: "link",
+		}, http.StatusCreated, &post)
+		if post.ID == 0 || post.UserName != "alice_login" {
+			t.Fatalf("post = %+v, want one by alice_login", post)
+		}
+		postPath := fmt.Sprintf("/posts/%d", post.ID)
+
+		app.doJSON(t, http.MethodPut, postPath+"/like", bob, nil, http.StatusOK, nil)
+
+		var comment dto.RespComment
+		app.doJSON(t, http.MethodPost, postPath+"/comments", bob,
+			dto.ReqComment{Body: "nice shoes"}, http.StatusCreated, &comment)
+
+		var got dto.RespPost
+		app.doJSON(t, http.MethodGet, postPath, alice, nil, http.StatusOK, &got)
+		if got.LikeCnt != 1 || got.DislikeCnt != 0 {
+			t.Fatalf("rates = %d likes %d dislikes, want 1 like", got.LikeCnt, got.DislikeCnt)
+		}
+
+		var comments []dto.RespComment
+		app.doJSON(t, http.MethodGet, postPath+"/comments", alice, nil, http.StatusOK, &comments)
+		if len(comments) != 1 || comments[0].ID != comment.ID || comments[0].Body != "nice shoes" {
+			t.Fatalf("comments = %+v, want bob's one", comments)
+		}
+
+		var posts []dto.RespPost
+		app.doJSON(t, http.MethodGet, "/posts?sex=female&category=shoes", bob, nil, http.StatusOK, &posts)
+		if len(posts) != 1 || posts[0].ID != post.ID {
+			t.Fatalf("posts = %+v, want alice's one", posts)
+		}
+
+		// a new post is ranked before any scoring ran
+		app.doJSON(t, http.MethodGet, "/posts?sort=hot&sex=female", bob, nil, http.StatusOK, &posts)
+		if len(posts) != 1 || posts[0].ID != post.ID {
+			t.Fatalf("hot posts = %+v, want alice's one", posts)
+		}
+
+		app.doJSON(t, http.MethodGet, "/posts/trending?window=7d&category=shoes", bob, nil, http.StatusOK, &posts)
+		if len(posts) != 1 || posts[0].ID != post.ID {
+			t.Fatalf("trending posts = %+v, want alice's one", posts)
+		}
+
+		app.doJSON(t, http.MethodGet, "/posts/trending?window=1y", bob, nil, http.StatusBadRequest, nil)
+
+		// only the author can delete a post
+		app.doJSON(t, http.MethodDelete, postPath, bob, nil, http.StatusForbidden, nil)
+		app.doJSON(t, http.MethodDelete, postPath, alice, nil, http.StatusOK, nil)
+		app.doJSON(t, http.MethodGet, postPath, alice, nil, http.StatusNotFound, nil)
+	})
+}
+
+func TestClientAddress(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		signIn := func(login, peer, forwarded string) int {
+			body, _ := json.Marshal(dto.ReqSign{Login: login, Password: "Wrong-horse-42"})
+			req := httptest.NewRequest(http.MethodPost, "/users/signin", bytes.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.RemoteAddr = peer + ":40000"
+			req.Header.Set(echo.HeaderXForwardedFor, forwarded)
+			req.Header.Set(echo.HeaderXRealIP, forwarded)
+
+			rec := httptest.NewRecorder()
+			app.e.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		// the headers of a client connecting directly are ignored
+		limit := routeLimits["signin"].Limit
+		for i := 0; i < limit; i++ {
+			code := signIn(fmt.Sprintf("login_%d", i), "192.0.2.1", fmt.Sprintf("198.51.100.%d", i))
+			if code == http.StatusTooManyRequests {
+				t.Fatalf("sign-in %d limited already", i)
+			}
+		}
+		if code := signIn("login_last", "192.0.2.1", "198.51.100.200"); code != http.StatusTooManyRequests {
+			t.Fatalf("sign-in past the limit = %d, want %d", code, http.StatusTooManyRequests)
+		}
+
+		// behind nginx, the client is the one it names
+		if code := signIn("login_proxied", "172.18.0.2", "203.0.113.7"); code == http.StatusTooManyRequests {
+			t.Fatalf("sign-in of another client through the proxy = %d", code)
+		}
+	})
+}
+
+func TestAPITokenScopes(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		alice := app.signUp(t, "alice_login")
+		imageId := app.uploadImage(t, alice, []byte("\x89PNG not really"))
+
+		var post dto.RespPost
+		app.doJSON(t, http.MethodPost, "/posts", alice, dto.ReqPost{
+			ImageID: imageId, Category: "shoes", Sex: "female", Brand: "brand", Description: "description", Link: "link",
+		}, http.StatusCreated, &post)
+		postPath := fmt.Sprintf("/posts/%d", post.ID)
+
+		newToken := func(scopes ...string) string {
+			var resp dto.RespCreatedAPIToken
+			app.doJSON(t, http.MethodPost, "/users/me/tokens", alice,
+				dto.ReqAPIToken{Name: "test", Scopes: scopes}, http.StatusCreated, &resp)
+			return resp.Token
+		}
+		read := newToken(model.ScopeRead)
+		comments := newToken(model.ScopeCommentsWrite)
+		posts := newToken(model.ScopePostsWrite)
+
+		// comments:write covers both comment routes, whatever their path starts with
+		var comment dto.RespComment
+		app.doJSON(t, http.MethodPost, postPath+"/comments", comments,
+			dto.ReqComment{Body: "nice shoes"}, http.StatusCreated, &comment)
+		app.doJSON(t, http.MethodDelete, fmt.Sprintf("/comments/%d", comment.ID), comments, nil, http.StatusOK, nil)
+		app.doJSON(t, http.MethodPost, postPath+"/comments", posts,
+			dto.ReqComment{Body: "nice shoes"}, http.StatusForbidden, nil)
+		app.doJSON(t, http.MethodPut, postPath+"/like", comments, nil, http.StatusForbidden, nil)
+		app.doJSON(t, http.MethodPut, postPath+"/like", posts, nil, http.StatusOK, nil)
+
+		app.doJSON(t, http.MethodGet, postPath, read, nil, http.StatusOK, nil)
+		app.doJSON(t, http.MethodGet, "/users/me", read, nil, http.StatusOK, nil)
+		app.doJSON(t, http.MethodGet, postPath, comments, nil, http.StatusForbidden, nil)
+		app.doJSON(t, http.MethodPut, postPath+"/like", read, nil, http.StatusForbidden, nil)
+
+		// the account is managed by sessions only, whatever the scopes
+		for _, token := range []string{read, comments, posts} {
+			app.doJSON(t, http.MethodGet, "/users/me/export", token, nil, http.StatusForbidden, nil)
+			app.doJSON(t, http.MethodGet, "/users/me/tokens", token, nil, http.StatusForbidden, nil)
+			app.doJSON(t, http.MethodPost, "/users/me/tokens", token,
+				dto.ReqAPIToken{Name: "escalated", Scopes: []string{model.ScopePostsWrite}}, http.StatusForbidden, nil)
+			app.doJSON(t, http.MethodPost, "/users/changepass", token, nil, http.StatusForbidden, nil)
+			app.doJSON(t, http.MethodDelete, "/users/me", token, nil, http.StatusForbidden, nil)
+		}
+		app.doJSON(t, http.MethodGet, "/users/me/tokens", alice, nil, http.StatusOK, nil)
+	})
+}
+
+func TestReportSuspension(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		ctx := context.Background()
+		users := map[string]string{}
+		ids := map[string]uint64{}
+		for _, login := range []string{"alice_login", "bob_login", "carol_login", "mod_login"} {
+			users[login] = app.signUp(t, login)
+
+			var me dto.RespUser
+			app.doJSON(t, http.MethodGet, "/users/me", users[login], nil, http.StatusOK, &me)
+			ids[login] = me.ID
+		}
+
+		admin := app.signUpAdmin(t, "admin_login")
+		setRole := func(login, role string) {
+			app.doJSON(t, http.MethodPut, fmt.Sprintf("/users/%d/role", ids[login]), admin,
+				dto.ReqRole{Role: role}, http.StatusOK, nil)
+		}
+		setRole("mod_login", model.RoleModerator)
+		setRole("carol_login", model.RoleModerator)
+
+		reportPost := func(author string) uint64 {
+			imageId := app.uploadImage(t, users[author], []byte("\x89PNG not really"))
+
+			var post dto.RespPost
+			app.doJSON(t, http.MethodPost, "/posts", users[author], dto.ReqPost{
+				ImageID: imageId, Category: "shoes", Sex: "female", Brand: "brand", Description: "description", Link: "link",
+			}, http.StatusCreated, &post)
+
+			var report dto.RespReport
+			app.doJSON(t, http.MethodPost, fmt.Sprintf("/posts/%d/report", post.ID), users["bob_login"],
+				dto.ReqReport{Reason: "spam"}, http.StatusCreated, &report)
+			return report.ID
+		}
+		suspend := func(reportId uint64, status int) {
+			app.doJSON(t, http.MethodPut, fmt.Sprintf("/reports/%d", reportId), users["mod_login"],
+				dto.ReqResolution{Status: model.ReportAuthorSuspended, SuspendDays: 7}, status, nil)
+		}
+		statusOf := func(login string) string {
+			user, err := app.svc.users.GetUserByID(ctx, ids[login])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return user.Status
+		}
+
+		// a moderator can't suspend another one
+		suspend(reportPost("carol_login"), http.StatusForbidden)
+		if got := statusOf("carol_login"); got != model.UserActive {
+			t.Fatalf("moderator status = %q, want %q", got, model.UserActive)
+		}
+
+		// a ban isn't turned into a suspension
+		bannedReport := reportPost("alice_login")
+		err := app.svc.users.UpdateStatus(ctx, &model.UserStatus{ID: ids["alice_login"], Status: model.UserBanned})
+		if err != nil {
+			t.Fatal(err)
+		}
+		suspend(bannedReport, http.StatusOK)
+		if got := statusOf("alice_login"); got != model.UserBanned {
+			t.Fatalf("banned author status = %q, want %q", got, model.UserBanned)
+		}
+
+		setRole("carol_login", model.RoleUser)
+		suspend(reportPost("carol_login"), http.StatusOK)
+		if got := statusOf("carol_login"); got != model.UserSuspended {
+			t.Fatalf("author status = %q, want %q", got, model.UserSuspended)
+		}
+	})
+}
+
+func TestDeleteAccount(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		hash, err := password.NewHasher(passwordHashing).Hash("Correct-horse-42")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// signed up by a provider: the password only stands in for its sign-in here
+		_, err = app.svc.users.CreateUser(context.Background(), &model.User{
+			Login:         "oidc_login",
+			Password:      hash,
+			Email:         "oidc@example.com",
+			EmailVerified: true,
+			Role:          model.RoleUser,
+			Status:        model.UserActive,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var session dto.RespToken
+		app.doJSON(t, http.MethodPost, "/users/signin", "",
+			dto.ReqSign{Login: "oidc_login", Password: "Correct-horse-42"}, http.StatusOK, &session)
+		passwordless := session.Token
+
+		// the public login doesn't confirm anything
+		app.doJSON(t, http.MethodDelete, "/users/me", passwordless,
+			dto.ReqDeleteAccount{Password: "oidc_login"}, http.StatusBadRequest, nil)
+		app.doJSON(t, http.MethodDelete, "/users/me", passwordless,
+			dto.ReqDeleteAccount{Code: "guessed"}, http.StatusBadRequest, nil)
+
+		app.doJSON(t, http.MethodPost, "/users/me/deletion-code", passwordless, nil, http.StatusNoContent, nil)
+		code := regexp.MustCompile(`code confirming it: (\S+)`).FindStringSubmatch(app.svc.mail.(*testMailer).lastMail("oidc@example.com"))
+		if code == nil {
+			t.Fatal("no deletion code mailed")
+		}
+		app.doJSON(t, http.MethodDelete, "/users/me", passwordless,
+			dto.ReqDeleteAccount{Code: code[1]}, http.StatusAccepted, nil)
+
+		// the others confirm with the password and get no code
+		alice := app.signUp(t, "alice_login")
+		app.doJSON(t, http.MethodPost, "/users/me/deletion-code", alice, nil, http.StatusBadRequest, nil)
+		app.doJSON(t, http.MethodDelete, "/users/me", alice,
+			dto.ReqDeleteAccount{Password: "Wrong-horse-42"}, http.StatusBadRequest, nil)
+		app.doJSON(t, http.MethodDelete, "/users/me", alice,
+			dto.ReqDeleteAccount{Password: "Correct-horse-42"}, http.StatusAccepted, nil)
+	})
+}
+
+func TestRoleChangeAppliesToSessions(t *testing.T) {
+	forEachServices(t, func(t *testing.T, app *testApp) {
+		admin := app.signUpAdmin(t, "admin_login")
+		alice := app.signUp(t, "alice_login")
+		mod := app.signUp(t, "mod_login")
+
+		var me dto.RespUser
+		app.doJSON(t, http.MethodGet, "/users/me", mod, nil, http.StatusOK, &me)
+		rolePath := fmt.Sprintf("/users/%d/role", me.ID)
+
+		newPost := func() string {
+			imageId := app.uploadImage(t, alice, []byte("\x89PNG not really"))
+
+			var post dto.RespPost
+			app.doJSON(t, http.MethodPost, "/posts", alice, dto.ReqPost{
+				ImageID: imageId, Category: "shoes", Sex: "female", Brand: "brand", Description: "description", Link: "link",
+			}, http.StatusCreated, &post)
+			return fmt.Sprintf("/posts/%d", post.ID)
+		}
+
+		// the session signed in as a user gets the new role without signing in again
+		app.doJSON(t, http.MethodPut, rolePath, admin, dto.ReqRole{Role: model.RoleModerator}, http.StatusOK, nil)
+		app.doJSON(t, http.MethodDelete, newPost(), mod, nil, http.StatusOK, nil)
+
+		// and loses it the same way
+		app.doJSON(t, http.MethodPut, rolePath, admin, dto.ReqRole{Role: model.RoleUser}, http.StatusOK, nil)
+		app.doJSON(t, http.MethodDelete, newPost(), mod, nil, http.StatusForbidden, nil)
+		app.doJSON(t, http.MethodGet, "/reports", mod, nil, http.StatusForbidden, nil)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// jwtkey manages the session signing keys:
+//
+//	jwtkey -kid key-2 -alg ed25519   creates keys/key-2.pem
+//	jwtkey -retire key-1             keeps only the public part of key-1 for verification
+func main() {
+	dir := flag.String("dir", "keys", "key directory")
+	kid := flag.String("kid", "", "id of the new key")
+	alg := flag.String("alg", "ed25519", "ed25519 or rsa")
+	retire := flag.String("retire", "", "id of the key to retire")
+	flag.Parse()
+
+	var err error
+	switch {
+	case *retire != "":
+		err = retireKey(*dir, *retire)
+	case *kid != "":
+		err = generateKey(*dir, *kid, *alg)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func generateKey(dir, kid, alg string) error {
+	var private crypto.Signer
+	var err error
+
+	switch alg {
+	case "ed25519":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	default:
+		log.Fatalf("unknown algorithm %q", alg)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, kid+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	log.Printf("created %s", path)
+	return pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func retireKey(dir, kid string) error {
+	privatePath := filepath.Join(dir, kid+".pem")
+	data, err := os.ReadFile(privatePath)
+	if err != nil {
+		return err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		log.Fatalf("no PEM block in %s", privatePath)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(private.(crypto.Signer).Public())
+	if err != nil {
+		return err
+	}
+
+	publicPath := filepath.Join(dir, kid+".pub.pem")
+	err = os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("retired %s, public part in %s", privatePath, publicPath)
+	return os.Remove(privatePath)
+}
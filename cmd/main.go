@@ -1,18 +1,35 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
 	"github.com/ell1jah/bmstu_web/cmd/server"
-	commentDelivery "github.com/ell1jah/bmstu_web/internal/comment/delivery"
-	commentLogic "github.com/ell1jah/bmstu_web/internal/comment/logic"
+	accountLogic "github.com/ell1jah/bmstu_web/internal/account/logic"
+	collectionRepository "github.com/ell1jah/bmstu_web/internal/collection/repository"
 	commentRepository "github.com/ell1jah/bmstu_web/internal/comment/repository"
-	imageDelivery "github.com/ell1jah/bmstu_web/internal/image/delivery"
-	imageLogic "github.com/ell1jah/bmstu_web/internal/image/logic"
-	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
-	postDelivery "github.com/ell1jah/bmstu_web/internal/post/delivery"
-	postLogic "github.com/ell1jah/bmstu_web/internal/post/logic"
+	followRepository "github.com/ell1jah/bmstu_web/internal/follow/repository"
+	"github.com/ell1jah/bmstu_web/internal/migrations"
+	"github.com/ell1jah/bmstu_web/internal/pkg/dbtimeout"
+	"github.com/ell1jah/bmstu_web/internal/pkg/eventbus"
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/mailer"
+	"github.com/ell1jah/bmstu_web/internal/pkg/metrics"
+	"github.com/ell1jah/bmstu_web/internal/pkg/middleware"
+	"github.com/ell1jah/bmstu_web/internal/pkg/migrate"
+	"github.com/ell1jah/bmstu_web/internal/pkg/oidc"
+	"github.com/ell1jah/bmstu_web/internal/pkg/password"
+	"github.com/ell1jah/bmstu_web/internal/pkg/ratelimit"
+	"github.com/ell1jah/bmstu_web/internal/pkg/replica"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
 	postRepository "github.com/ell1jah/bmstu_web/internal/post/repository"
 	rateRepository "github.com/ell1jah/bmstu_web/internal/rate/repository"
-	userDelivery "github.com/ell1jah/bmstu_web/internal/user/delivery"
+	reportRepository "github.com/ell1jah/bmstu_web/internal/report/repository"
 	userLogic "github.com/ell1jah/bmstu_web/internal/user/logic"
 	userRepository "github.com/ell1jah/bmstu_web/internal/user/repository"
 
@@ -24,13 +41,10 @@ import (
 	"github.com/GoAdminGroup/go-admin/modules/language"
 	"github.com/GoAdminGroup/themes/adminlte"
 	"github.com/asaskevich/govalidator"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo-contrib/prometheus"
-	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
-	echoMiddleware "github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
-	echoSwagger "github.com/swaggo/echo-swagger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -42,7 +56,162 @@ import (
 // var testCfgPg = postgres.Config{DSN: "host=localhost user=postgres password=postgres port=13080"}
 
 var prodCfgPg = postgres.Config{DSN: "host=cloth_pg user=postgres password=postgres port=5432"}
-var jwtKey = []byte("sdoBsm#vpw,vsdS3902F,dvd]s")
+
+// reads go to the replicas keeping up with prodCfgPg, writes and transactions to prodCfgPg itself
+var prodReplicaCfgsPg = map[string]postgres.Config{
+	"cloth_pg_replica": {DSN: "host=cloth_pg_replica user=postgres password=postgres port=5432"},
+}
+
+var replicaRouting = replica.Config{
+	MaxLag:      5 * time.Second,
+	CheckPeriod: 5 * time.Second,
+	StickyFor:   10 * time.Second,
+}
+
+// session tokens are signed with jwtActiveKey from jwtKeysDir, keys are made with cmd/jwtkey
+const (
+	jwtKeysDir   = "keys"
+	jwtActiveKey = "key-1"
+	jwtIssuer    = "cloth-api"
+	jwtAudience  = "cloth"
+	sessionTTL   = 72 * time.Hour
+)
+
+// logLevels are the default log levels of the packages; CLOTH_LOG replaces
+// them, e.g. CLOTH_LOG="info,db=debug,replica=warn", and at debug "db" logs
+// every query
+var logLevels = logger.Config{
+	Level: zapcore.InfoLevel,
+}
+
+const logLevelsEnv = "CLOTH_LOG"
+
+// spans go to the collector of docker-compose, sampled at SampleRatio
+// unless the caller's traceparent has decided already
+var tracingCfg = tracing.Config{
+	ServiceName: "cloth-api",
+	Endpoint:    "jaeger:4318",
+	Insecure:    true,
+	SampleRatio: 1,
+}
+
+// queries taking longer are logged as warnings
+const slowQuery = 200 * time.Millisecond
+
+// every server applies the pending migrations on start, one at a time
+const migrateOnStart = true
+
+// sends the text of unexpected errors to clients, never on in production
+const debugErrors = false
+
+const (
+	// number of distinct reports after which a post or comment is hidden
+	reportHideThreshold = 5
+	// how long a server trusts a cached user status before rechecking for bans
+	userStatusTTL = 30 * time.Second
+	// default deadline of a single query, dbtimeout.WithTimeout changes it for a context
+	queryTimeout = 5 * time.Second
+	// how often the size of the image directory is measured for the metrics
+	imageScanPeriod = time.Minute
+	// how often the hot and trending ranks of the posts are recomputed
+	scoringPeriod = 5 * time.Minute
+)
+
+// transactions are serializable, the one losing to a concurrent one is run again
+var txConfig = txmanager.Config{
+	Isolation:  sql.LevelSerializable,
+	MaxRetries: 3,
+	RetryDelay: 10 * time.Millisecond,
+}
+
+// the network nginx connects from, its X-Real-IP is the client address;
+// requests from anywhere else are taken by their peer address, so a client
+// can't pick the address its limits are counted against
+const trustedProxies = "172.16.0.0/12"
+
+// per-client limits of the rate limited routes
+var routeLimits = map[string]middleware.RateLimit{
+	"signin":  {Limit: 10, Window: time.Minute},
+	"signup":  {Limit: 5, Window: time.Hour},
+	"upload":  {Limit: 30, Window: time.Minute},
+	"comment": {Limit: 20, Window: time.Minute},
+	"mail":    {Limit: 5, Window: time.Hour},
+	"export":  {Limit: 5, Window: time.Hour},
+}
+
+// failed sign-ins tolerated per login and per client address before a lockout
+var loginBackoff = ratelimit.BackoffConfig{
+	MaxFailures: 5,
+	BaseLockout: 30 * time.Second,
+	MaxLockout:  time.Hour,
+	FailureTTL:  24 * time.Hour,
+}
+var ipBackoff = ratelimit.BackoffConfig{
+	MaxFailures: 20,
+	BaseLockout: time.Minute,
+	MaxLockout:  time.Hour,
+	FailureTTL:  24 * time.Hour,
+}
+
+var accountCfg = userLogic.Config{
+	PublicURL:      "http://localhost",
+	VerifyTokenTTL: 48 * time.Hour,
+	ResetTokenTTL:  time.Hour,
+
+	TOTPIssuer:         "Cloth",
+	SignInChallengeTTL: 5 * time.Minute,
+	OIDCLoginTTL:       10 * time.Minute,
+}
+
+// identity providers users can sign in with, "mock" is cmd/mockoidc run locally
+var oidcProviders = []oidc.ProviderConfig{
+	{
+		Name:         "mock",
+		Issuer:       "http://localhost:9999",
+		ClientID:     "cloth",
+		ClientSecret: "cloth-secret",
+		RedirectURL:  "http://localhost:8080/users/oidc/mock/callback",
+		Scopes:       []string{"email", "profile"},
+	},
+}
+
+var passwordPolicy = password.Policy{
+	MinLength:   8,
+	MaxLength:   128,
+	MinClasses:  2,
+	CheckCommon: true,
+}
+
+// existing bcrypt hashes are upgraded on the next successful sign-in
+var passwordHashing = password.HashConfig{
+	Algorithm:     password.Argon2id,
+	BcryptCost:    12,
+	Argon2Memory:  64 * 1024,
+	Argon2Time:    3,
+	Argon2Threads: 2,
+}
+
+// what is left of a deleted account: posts and comments stay under an
+// anonymous user, ratings go
+var accountDeletion = accountLogic.Config{
+	Policy: accountLogic.Policy{
+		Posts:    accountLogic.Anonymize,
+		Comments: accountLogic.Anonymize,
+		Rates:    accountLogic.Cascade,
+	},
+	PollPeriod: time.Minute,
+	Lease:      30 * time.Minute,
+	CodeTTL:    15 * time.Minute,
+}
+
+const mailFrom = "Cloth <noreply@localhost>"
+
+// used instead of the mail directory when Host is set
+var smtpCfg = mailer.SMTPConfig{
+	Host: "",
+	Port: 587,
+	From: mailFrom,
+}
 
 func initAdmin(e *echo.Echo) {
 	eng := engine.Default()
@@ -76,67 +245,179 @@ func initAdmin(e *echo.Echo) {
 	eng.HTML("GET", "/admin", datamodel.GetContent)
 }
 
+type Migrator interface {
+	Up() (int, error)
+	Down(steps int) (int, error)
+	Status() ([]migrate.Status, error)
+}
+
+// runMigrate serves "main migrate up|down [steps]|status".
+func runMigrate(migrator Migrator, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s migrate up|down [steps]|status", os.Args[0])
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migrations applied\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("bad number of steps %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migrations reverted\n", reverted)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+
+		for _, st := range statuses {
+			applied := "pending"
+			if st.Applied {
+				applied = st.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d  %-32s %s\n", st.Version, st.Name, applied)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+
+	return nil
+}
+
 func main() {
+	logCfg := logLevels
+	if levels := os.Getenv(logLevelsEnv); levels != "" {
+		var err error
+		logCfg, err = logger.ParseConfig(levels)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	logger.Init(logCfg)
+	lg := logger.Ctx(context.Background(), "main")
+
 	govalidator.SetFieldsRequiredByDefault(true)
 
+	shutdownTracing, err := tracing.Init(context.Background(), tracingCfg)
+	if err != nil {
+		lg.Fatal("tracing", zap.Error(err))
+	}
+
 	db, err := gorm.Open(postgres.New(prodCfgPg),
-		&gorm.Config{})
+		&gorm.Config{Logger: logger.NewGormLogger(slowQuery)})
 	if err != nil {
-		log.Fatal(err)
+		lg.Fatal("postgres connect", zap.Error(err))
 	}
-	log.Info("postgres connect success")
+	lg.Info("postgres connect success")
 
-	userRepo := userRepository.NewPgRepo(db)
-	postRepo := postRepository.NewPgRepo(db)
-	rateRepo := rateRepository.NewPgRepo(db)
-	commentRepo := commentRepository.NewPgRepo(db)
+	migrator, err := migrate.NewMigrator(db, migrations.FS)
+	if err != nil {
+		lg.Fatal("migrations", zap.Error(err))
+	}
 
-	userLogic := userLogic.NewLogic(userRepo)
-	postLogic := postLogic.NewLogic(postRepo, userRepo, rateRepo)
-	commentLogic := commentLogic.NewLogic(commentRepo, userRepo)
-	imageLogic := imageLogic.NewLogic()
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err = runMigrate(migrator, os.Args[2:])
+		if err != nil {
+			lg.Fatal("migrate command", zap.Error(err))
+		}
+		return
+	}
 
-	e := echo.New()
-	initAdmin(e)
+	if migrateOnStart {
+		applied, err := migrator.Up()
+		if err != nil {
+			lg.Fatal("migrate on start", zap.Error(err))
+		}
+		lg.Info("migrations applied", zap.Int("applied", applied))
+	}
 
-	e.Logger.SetHeader(`time=${time_rfc3339} level=${level} prefix=${prefix} ` +
-		`file=${short_file} line=${line} message:`)
-	e.Logger.SetLevel(log.INFO)
+	// set after the migrations, they may run much longer than a query should
+	err = db.Use(dbtimeout.New(queryTimeout))
+	if err != nil {
+		lg.Fatal("query timeout plugin", zap.Error(err))
+	}
 
-	p := prometheus.NewPrometheus("echo", nil)
-	p.MetricsPath = "/prometheus"
-	p.SetMetricsPath(e)
-	p.Use(e)
+	err = db.Use(tracing.NewGormPlugin())
+	if err != nil {
+		lg.Fatal("tracing plugin", zap.Error(err))
+	}
 
-	e.Use(echoMiddleware.LoggerWithConfig(echoMiddleware.LoggerConfig{
-		Format: `time=${time_custom} remote_ip=${remote_ip} ` +
-			`host=${host} method=${method} uri=${uri} user_agent=${user_agent} ` +
-			`status=${status} error="${error}" ` +
-			`bytes_in=${bytes_in} bytes_out=${bytes_out}` + "\n",
-		CustomTimeFormat: "2006-01-02 15:04:05",
-	}))
+	err = db.Use(metrics.NewGormPlugin())
+	if err != nil {
+		lg.Fatal("metrics plugin", zap.Error(err))
+	}
 
-	e.Use(echoMiddleware.Recover())
+	replicas := make(map[string]gorm.Dialector, len(prodReplicaCfgsPg))
+	for name, cfg := range prodReplicaCfgsPg {
+		replicas[name] = postgres.New(cfg)
+	}
+	replicaRouter := replica.NewRouter(replicas, replicaRouting)
+	err = db.Use(replicaRouter)
+	if err != nil {
+		lg.Fatal("replica router plugin", zap.Error(err))
+	}
+	go replicaRouter.RunLagChecks(context.Background())
 
-	e.GET("/swagger/*", echoSwagger.WrapHandler)
+	svc := &services{
+		users:       userRepository.NewPgRepo(db),
+		posts:       postRepository.NewPgRepo(db),
+		rates:       rateRepository.NewPgRepo(db),
+		comments:    commentRepository.NewPgRepo(db),
+		follows:     followRepository.NewPgRepo(db),
+		collections: collectionRepository.NewPgRepo(db),
+		reports:     reportRepository.NewPgRepo(db),
 
-	sessionManager := jwtManager.NewJWTSessionsManager(jwtKey, jwt.SigningMethodHS256)
+		// Postgres keeps the limits shared by all servers, ratelimit.NewMemoryStore() keeps them per server
+		rateStore: ratelimit.NewPgStore(db),
+		txManager: txmanager.NewManager(db, txConfig),
+		mail:      mailer.NewFileMailer("./mail", mailFrom),
+	}
+	if smtpCfg.Host != "" {
+		svc.mail = mailer.NewSMTPMailer(smtpCfg)
+	}
 
-	authMiddleware := echojwt.WithConfig(echojwt.Config{
-		SigningKey:    jwtKey,
-		SigningMethod: jwt.SigningMethodHS256.Alg(),
-		NewClaimsFunc: func(c echo.Context) jwt.Claims {
-			return new(jwtManager.Claims)
-		},
-	})
+	eventBroker := eventbus.NewPgBroker(db, prodCfgPg.DSN, eventbus.NewBus())
+	go eventBroker.Listen(context.Background())
+	svc.events = eventBroker
+
+	e := echo.New()
+	initAdmin(e)
 
-	userDelivery.NewHandler(userLogic, sessionManager).SetRoutes(e, authMiddleware)
-	postDelivery.NewHandler(postLogic).SetRoutes(e, authMiddleware)
-	commentDelivery.NewHandler(commentLogic).SetRoutes(e, authMiddleware)
-	imageDelivery.NewHandler(imageLogic).SetRoutes(e, authMiddleware)
+	p := prometheus.NewPrometheus("echo", nil)
+	p.MetricsPath = "/prometheus"
+	p.SetMetricsPath(e)
+	p.Use(e)
+	err = metrics.Register()
+	if err != nil {
+		lg.Fatal("domain metrics", zap.Error(err))
+	}
+
+	err = setUp(context.Background(), e, svc)
+	if err != nil {
+		lg.Fatal("app setup", zap.Error(err))
+	}
 
 	s := server.NewServer(e)
-	if err := s.Start(); err != nil {
-		e.Logger.Fatal(err)
+	err = s.Start()
+	// Fatal exits without running deferred calls
+	shutdownTracing(context.Background())
+	if err != nil {
+		lg.Fatal("server", zap.Error(err))
 	}
 }
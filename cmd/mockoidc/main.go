@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/oidcmock"
+)
+
+// mockoidc runs an OpenID Connect provider that signs in anyone,
+// so the OIDC login can be tried locally without a real provider.
+func main() {
+	addr := flag.String("addr", ":9999", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9999", "issuer URL the provider is reachable at")
+	flag.Parse()
+
+	srv, err := oidcmock.NewServer(*issuer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("mock oidc provider %s listening on %s", *issuer, *addr)
+	log.Fatal(http.ListenAndServe(*addr, srv))
+}
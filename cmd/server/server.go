@@ -1,11 +1,14 @@
 package server
 
 import (
-	"log"
+	"context"
 	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
 )
 
 type server struct {
@@ -25,6 +28,6 @@ func NewServer(e *echo.Echo) *server {
 }
 
 func (s *server) Start() error {
-	log.Println("start serving in :8080")
+	logger.Ctx(context.Background(), "main").Info("start serving", zap.String("addr", s.Addr))
 	return s.ListenAndServe()
 }
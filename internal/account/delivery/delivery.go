@@ -0,0 +1,182 @@
+package delivery
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+const imageExt = ".png"
+
+type AccountLogic interface {
+	ExportAccount(ctx context.Context, userId uint64) (*model.AccountExport, error)
+	GetImage(ctx context.Context, imageId string) (io.Reader, error)
+	SendDeletionCode(ctx context.Context, userId uint64) error
+	DeleteAccount(ctx context.Context, userId uint64, confirm *model.DeletionConfirm) error
+}
+
+type RateLimiter interface {
+	Limit(name string) echo.MiddlewareFunc
+}
+
+type handler struct {
+	accountService AccountLogic
+}
+
+func NewHandler(accountService AccountLogic) *handler {
+	return &handler{
+		accountService: accountService,
+	}
+}
+
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, limits RateLimiter) {
+	e.GET("/users/me/export", h.ExportAccount, auth, limits.Limit("export"))
+	e.POST("/users/me/deletion-code", h.SendDeletionCode, auth, limits.Limit("mail"))
+	e.DELETE("/users/me", h.DeleteAccount, auth, limits.Limit("signin"))
+}
+
+// ExportAccount streams a ZIP with JSON files and the original images.
+// Errors after the first byte can only be logged, the archive is cut short then.
+func (h *handler) ExportAccount(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	export, err := h.accountService.ExportAccount(c.Request().Context(), userClaims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("cloth-export-%s-%s.zip", export.User.Login, time.Now().Format("20060102"))
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	c.Response().WriteHeader(http.StatusOK)
+
+	err = h.writeExport(c.Request().Context(), zip.NewWriter(c.Response()), export)
+	if err != nil {
+		logger.Ctx(c.Request().Context(), "account").Error("export", zap.Error(err))
+	}
+
+	return nil
+}
+
+func (h *handler) writeExport(ctx context.Context, zw *zip.Writer, export *model.AccountExport) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", dto.RespExportProfileFromExport(export)},
+		{"posts.json", dto.RespExportPostsFromPosts(export.Posts)},
+		{"comments.json", dto.RespExportCommentsFromComments(export.Comments)},
+		{"ratings.json", dto.RespExportRatesFromRates(export.Rates)},
+	}
+
+	for _, file := range files {
+		w, err := zw.Create(file.name)
+		if err != nil {
+			return errors.Wrap(err, "zip create error")
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(file.data)
+		if err != nil {
+			return errors.Wrap(err, "json encode error")
+		}
+	}
+
+	for _, imageId := range export.ImageIDs {
+		err := h.writeImage(ctx, zw, imageId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrap(zw.Close(), "zip close error")
+}
+
+func (h *handler) writeImage(ctx context.Context, zw *zip.Writer, imageId string) error {
+	image, err := h.accountService.GetImage(ctx, imageId)
+	if err != nil {
+		// an image lost on disk shouldn't cost the user the rest of the export
+		return nil
+	}
+	if closer, ok := image.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	// PNG is compressed already
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:   "images/" + imageId + imageExt,
+		Method: zip.Store,
+	})
+	if err != nil {
+		return errors.Wrap(err, "zip create error")
+	}
+
+	_, err = io.Copy(w, image)
+	if err != nil {
+		return errors.Wrap(err, "io copy error")
+	}
+
+	return nil
+}
+
+// SendDeletionCode mails the code DeleteAccount takes from the accounts
+// without a password.
+func (h *handler) SendDeletionCode(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err := h.accountService.SendDeletionCode(c.Request().Context(), userClaims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DeleteAccount answers 202: the account is locked right away,
+// its content is removed in background.
+func (h *handler) DeleteAccount(c echo.Context) error {
+	var reqDelete dto.ReqDeleteAccount
+	err := c.Bind(&reqDelete)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqDelete)
+	if err != nil {
+		return err
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.accountService.DeleteAccount(c.Request().Context(), userClaims.User.ID, reqDelete.ToDeletionConfirm())
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
@@ -0,0 +1,458 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+// what happens to a kind of content when its author deletes the account:
+// anonymized content stays under a faceless user, cascaded content is removed
+const (
+	Anonymize = "anonymize"
+	Cascade   = "cascade"
+)
+
+type Policy struct {
+	Posts    string
+	Comments string
+	Rates    string
+}
+
+// Config.Lease is how long a server owns a deletion before another one
+// may take it over, it must exceed the time to delete the largest account.
+type Config struct {
+	Policy     Policy
+	PollPeriod time.Duration
+	Lease      time.Duration
+	// time to confirm the deletion of an account without a password
+	CodeTTL time.Duration
+}
+
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	GetUserIdentities(ctx context.Context, userId uint64) ([]*model.UserIdentity, error)
+	UpdateStatus(ctx context.Context, status *model.UserStatus) error
+	CreateToken(ctx context.Context, token *model.UserToken) error
+	UseToken(ctx context.Context, purpose, hash string) (*model.UserToken, error)
+	RequestDeletion(ctx context.Context, userId uint64) error
+	ClaimDeletion(ctx context.Context, lease time.Duration) (uint64, error)
+	FinishDeletion(ctx context.Context, userId uint64) error
+	AnonymizeUser(ctx context.Context, userId uint64, login string) error
+	DeleteUser(ctx context.Context, userId uint64) error
+}
+
+type PostRepository interface {
+	GetAllUsersPosts(ctx context.Context, ownerId uint64) ([]*model.Post, error)
+	IsImageUsed(ctx context.Context, imageId string) (bool, error)
+	DeletePost(ctx context.Context, postId uint64) error
+}
+
+type CommentRepository interface {
+	GetAllUsersComments(ctx context.Context, userId uint64) ([]*model.Comment, error)
+	DeleteUsersComments(ctx context.Context, userId uint64) error
+}
+
+type RateRepository interface {
+	GetUsersRates(ctx context.Context, userId uint64) ([]*model.PostRate, error)
+	DeleteUsersRates(ctx context.Context, userId uint64) error
+}
+
+type ImageLogic interface {
+	GetImage(ctx context.Context, imageId string) (io.Reader, error)
+	DeleteImage(ctx context.Context, imageId string) error
+}
+
+type TxManager interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type PasswordHasher interface {
+	Compare(hash, password string) error
+}
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type logic struct {
+	userRepository    UserRepository
+	postRepository    PostRepository
+	commentRepository CommentRepository
+	rateRepository    RateRepository
+	imageLogic        ImageLogic
+	passwords         PasswordHasher
+	mailer            Mailer
+	txManager         TxManager
+	cfg               Config
+
+	wake chan struct{}
+}
+
+func NewLogic(userRepository UserRepository, postRepository PostRepository, commentRepository CommentRepository,
+	rateRepository RateRepository, imageLogic ImageLogic, passwords PasswordHasher, mailer Mailer, txManager TxManager,
+	cfg Config) *logic {
+	return &logic{
+		userRepository:    userRepository,
+		postRepository:    postRepository,
+		commentRepository: commentRepository,
+		rateRepository:    rateRepository,
+		imageLogic:        imageLogic,
+		passwords:         passwords,
+		mailer:            mailer,
+		txManager:         txManager,
+		cfg:               cfg,
+		wake:              make(chan struct{}, 1),
+	}
+}
+
+func (l *logic) ExportAccount(ctx context.Context, userId uint64) (*model.AccountExport, error) {
+	ctx, span := tracing.Start(ctx, "account.ExportAccount")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+	user.Password = ""
+
+	identities, err := l.userRepository.GetUserIdentities(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	posts, err := l.postRepository.GetAllUsersPosts(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "post repository error")
+	}
+
+	comments, err := l.commentRepository.GetAllUsersComments(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "comment repository error")
+	}
+
+	rates, err := l.rateRepository.GetUsersRates(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "rate repository error")
+	}
+
+	export := &model.AccountExport{
+		User:       user,
+		Identities: identities,
+		Posts:      posts,
+		Comments:   comments,
+		Rates:      rates,
+	}
+
+	seen := make(map[string]bool, len(posts)+1)
+	for _, post := range posts {
+		if post.ImageID != "" && !seen[post.ImageID] {
+			seen[post.ImageID] = true
+			export.ImageIDs = append(export.ImageIDs, post.ImageID)
+		}
+	}
+	if user.AvatarID != "" && !seen[user.AvatarID] {
+		export.ImageIDs = append(export.ImageIDs, user.AvatarID)
+	}
+
+	return export, nil
+}
+
+func (l *logic) GetImage(ctx context.Context, imageId string) (io.Reader, error) {
+	ctx, span := tracing.Start(ctx, "account.GetImage")
+	defer span.End()
+
+	image, err := l.imageLogic.GetImage(ctx, imageId)
+	if err != nil {
+		return nil, errors.Wrap(err, "image logic error")
+	}
+
+	return image, nil
+}
+
+// SendDeletionCode mails a single-use code confirming the deletion of an
+// account without a password to its verified email.
+func (l *logic) SendDeletionCode(ctx context.Context, userId uint64) error {
+	ctx, span := tracing.Start(ctx, "account.SendDeletionCode")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if user.HasPassword {
+		return errors.Wrap(model.ErrBadRequest, "the deletion is confirmed with the password")
+	}
+	if !user.EmailVerified {
+		return errors.Wrap(model.ErrBadRequest, "no verified email to send the code to")
+	}
+
+	code, err := randomCode()
+	if err != nil {
+		return err
+	}
+
+	err = l.userRepository.CreateToken(ctx, &model.UserToken{
+		UserID:    user.ID,
+		Purpose:   model.TokenDeleteAccount,
+		Hash:      hashCode(code),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(l.cfg.CodeTTL),
+	})
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	body := "Someone asked to delete the account " + user.Login + " with everything in it.\n" +
+		"The code confirming it: " + code + "\n" +
+		"If it wasn't you, ignore this mail, the account stays."
+	err = l.mailer.Send(user.Email, "Account deletion", body)
+	if err != nil {
+		return errors.Wrap(err, "mailer error")
+	}
+
+	return nil
+}
+
+// DeleteAccount locks the account at once and leaves the content to
+// RunDeletions. Accounts without a password confirm with a code from
+// SendDeletionCode instead.
+func (l *logic) DeleteAccount(ctx context.Context, userId uint64, confirm *model.DeletionConfirm) error {
+	ctx, span := tracing.Start(ctx, "account.DeleteAccount")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if user.HasPassword {
+		err = l.passwords.Compare(user.Password, confirm.Password)
+		if err != nil {
+			return errors.Wrap(err, "password hasher error")
+		}
+	} else if confirm.Code == "" {
+		return errors.Wrap(model.ErrBadRequest, "no deletion code")
+	}
+
+	// a locked account nobody is going to delete would be stuck, and the
+	// code is spent only along with the lock
+	err = l.txManager.Do(ctx, func(ctx context.Context) error {
+		if !user.HasPassword {
+			token, err := l.userRepository.UseToken(ctx, model.TokenDeleteAccount, hashCode(confirm.Code))
+			if errors.Is(err, model.ErrNotFound) || (err == nil && token.UserID != userId) {
+				return model.ErrInvalidToken
+			} else if err != nil {
+				return errors.Wrap(err, "user repository error")
+			}
+		}
+
+		err := l.userRepository.UpdateStatus(ctx, &model.UserStatus{
+			ID:        userId,
+			Status:    model.UserDeleted,
+			ChangedBy: userId,
+		})
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		err = l.userRepository.RequestDeletion(ctx, userId)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// RunDeletions deletes requested accounts until ctx is done. Every server
+// runs it, the repository hands each deletion to one of them.
+func (l *logic) RunDeletions(ctx context.Context) {
+	ticker := time.NewTicker(l.cfg.PollPeriod)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			userId, err := l.userRepository.ClaimDeletion(ctx, l.cfg.Lease)
+			if errors.Is(err, model.ErrNotFound) {
+				break
+			} else if err != nil {
+				logger.Ctx(ctx, "account").Error("claim deletion", zap.Error(err))
+				break
+			}
+
+			l.runDeletion(ctx, userId)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-l.wake:
+		}
+	}
+}
+
+// runDeletion is traced on its own, it isn't part of any request.
+func (l *logic) runDeletion(ctx context.Context, userId uint64) {
+	ctx, span := tracing.Start(ctx, "account.runDeletion", attribute.Int64("user.id", int64(userId)))
+
+	err := l.purge(ctx, userId)
+	if err != nil {
+		// the lease runs out and the deletion is retried
+		logger.Ctx(ctx, "account").Error("account deletion", zap.Uint64("user_id", userId), zap.Error(err))
+		tracing.End(span, err)
+		return
+	}
+
+	err = l.userRepository.FinishDeletion(ctx, userId)
+	if err != nil {
+		logger.Ctx(ctx, "account").Error("finish deletion", zap.Uint64("user_id", userId), zap.Error(err))
+	}
+	tracing.End(span, err)
+}
+
+// purge is safe to repeat: whatever a failed run has removed is just not found again.
+func (l *logic) purge(ctx context.Context, userId uint64) error {
+	user, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if l.cfg.Policy.Posts == Cascade {
+		err = l.deletePosts(ctx, userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.cfg.Policy.Comments == Cascade {
+		err = l.commentRepository.DeleteUsersComments(ctx, userId)
+		if err != nil {
+			return errors.Wrap(err, "comment repository error")
+		}
+	}
+
+	if l.cfg.Policy.Rates == Cascade {
+		err = l.rateRepository.DeleteUsersRates(ctx, userId)
+		if err != nil {
+			return errors.Wrap(err, "rate repository error")
+		}
+	}
+
+	if user.AvatarID != "" {
+		err = l.deleteImage(ctx, user.AvatarID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.cfg.Policy.Posts == Cascade && l.cfg.Policy.Comments == Cascade && l.cfg.Policy.Rates == Cascade {
+		err = l.userRepository.DeleteUser(ctx, userId)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		return nil
+	}
+
+	login, err := anonymousLogin()
+	if err != nil {
+		return err
+	}
+
+	err = l.userRepository.AnonymizeUser(ctx, userId, login)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) deletePosts(ctx context.Context, userId uint64) error {
+	posts, err := l.postRepository.GetAllUsersPosts(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "post repository error")
+	}
+
+	for _, post := range posts {
+		err = l.postRepository.DeletePost(ctx, post.ID)
+		if err != nil {
+			return errors.Wrap(err, "post repository error")
+		}
+
+		if post.ImageID == "" {
+			continue
+		}
+
+		err = l.deleteImage(ctx, post.ImageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteImage keeps images some remaining post still shows.
+func (l *logic) deleteImage(ctx context.Context, imageId string) error {
+	used, err := l.postRepository.IsImageUsed(ctx, imageId)
+	if err != nil {
+		return errors.Wrap(err, "post repository error")
+	} else if used {
+		return nil
+	}
+
+	err = l.imageLogic.DeleteImage(ctx, imageId)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return errors.Wrap(err, "image logic error")
+	}
+
+	return nil
+}
+
+func anonymousLogin() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", errors.Wrap(err, "rand read error")
+	}
+
+	return "deleted-" + hex.EncodeToString(buf), nil
+}
+
+func randomCode() (string, error) {
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", errors.Wrap(err, "rand read error")
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+func hashCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,219 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+type CollectionLogic interface {
+	GetCollection(ctx context.Context, askerId, collectionId uint64) (*model.Collection, error)
+	GetUsersCollections(ctx context.Context, askerId, ownerId uint64) ([]*model.Collection, error)
+	CreateCollection(ctx context.Context, collection *model.Collection) error
+	UpdateCollection(ctx context.Context, userId uint64, collection *model.Collection) (*model.Collection, error)
+	DeleteCollection(ctx context.Context, userId, collectionId uint64) error
+	AddPost(ctx context.Context, userId, collectionId, postId uint64) error
+	RemovePost(ctx context.Context, userId, collectionId, postId uint64) error
+}
+
+type ScopeMiddleware interface {
+	Scope(scope string) echo.MiddlewareFunc
+}
+
+type handler struct {
+	collectionService CollectionLogic
+}
+
+func NewHandler(collectionService CollectionLogic) *handler {
+	return &handler{
+		collectionService: collectionService,
+	}
+}
+
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, scopes ScopeMiddleware) {
+	write := scopes.Scope(model.ScopeCollectionsWrite)
+	e.POST("/collections", h.CreateCollection, write, auth)
+	e.PUT("/collections/:collectionID", h.UpdateCollection, write, auth)
+	e.DELETE("/collections/:collectionID", h.DeleteCollection, write, auth)
+	e.PUT("/collections/:collectionID/posts/:postID", h.AddPost, write, auth)
+	e.DELETE("/collections/:collectionID/posts/:postID", h.RemovePost, write, auth)
+
+	read := scopes.Scope(model.ScopeRead)
+	e.GET("/collections/:collectionID", h.GetCollection, read, auth)
+	e.GET("/users/:userID/collections", h.GetUsersCollections, read, auth)
+}
+
+func (h *handler) GetCollection(c echo.Context) error {
+	collectionId, err := strconv.ParseUint(c.Param("collectionID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	collection, err := h.collectionService.GetCollection(c.Request().Context(), userClaims.User.ID, collectionId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespCollectionFromCollection(collection))
+}
+
+func (h *handler) GetUsersCollections(c echo.Context) error {
+	ownerId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	collections, err := h.collectionService.GetUsersCollections(c.Request().Context(), userClaims.User.ID, ownerId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespCollectionsFromCollections(collections))
+}
+
+func (h *handler) CreateCollection(c echo.Context) error {
+	var reqCollection dto.ReqCollection
+	err := c.Bind(&reqCollection)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqCollection)
+	if err != nil {
+		return err
+	}
+
+	collection := reqCollection.ToCollection()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	collection.UserID = userClaims.User.ID
+
+	err = h.collectionService.CreateCollection(c.Request().Context(), collection)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, dto.RespCollectionFromCollection(collection))
+}
+
+func (h *handler) UpdateCollection(c echo.Context) error {
+	collectionId, err := strconv.ParseUint(c.Param("collectionID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	var reqCollection dto.ReqCollection
+	err = c.Bind(&reqCollection)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqCollection)
+	if err != nil {
+		return err
+	}
+
+	collection := reqCollection.ToCollection()
+	collection.ID = collectionId
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	collection, err = h.collectionService.UpdateCollection(c.Request().Context(), userClaims.User.ID, collection)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespCollectionFromCollection(collection))
+}
+
+func (h *handler) DeleteCollection(c echo.Context) error {
+	collectionId, err := strconv.ParseUint(c.Param("collectionID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.collectionService.DeleteCollection(c.Request().Context(), userClaims.User.ID, collectionId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) AddPost(c echo.Context) error {
+	collectionId, err := strconv.ParseUint(c.Param("collectionID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.collectionService.AddPost(c.Request().Context(), userClaims.User.ID, collectionId, postId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) RemovePost(c echo.Context) error {
+	collectionId, err := strconv.ParseUint(c.Param("collectionID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.collectionService.RemovePost(c.Request().Context(), userClaims.User.ID, collectionId, postId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,181 @@
+package logic
+
+import (
+	"context"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type CollectionRepository interface {
+	GetCollection(ctx context.Context, collectionId uint64) (*model.Collection, error)
+	GetUsersCollections(ctx context.Context, ownerId uint64, onlyPublic bool) ([]*model.Collection, error)
+	CreateCollection(ctx context.Context, collection *model.Collection) error
+	UpdateCollection(ctx context.Context, collection *model.Collection) error
+	DeleteCollection(ctx context.Context, collectionId uint64) error
+	GetCollectionPosts(ctx context.Context, collectionId uint64) ([]uint64, error)
+	AddPost(ctx context.Context, collectionId, postId uint64) error
+	RemovePost(ctx context.Context, collectionId, postId uint64) error
+}
+
+type PostLogic interface {
+	GetPost(ctx context.Context, userId, postId uint64) (*model.Post, error)
+}
+
+type logic struct {
+	collectionRepository CollectionRepository
+	postService          PostLogic
+}
+
+func NewLogic(collectionRepository CollectionRepository, postService PostLogic) *logic {
+	return &logic{
+		collectionRepository: collectionRepository,
+		postService:          postService,
+	}
+}
+
+func (l *logic) GetCollection(ctx context.Context, askerId, collectionId uint64) (*model.Collection, error) {
+	ctx, span := tracing.Start(ctx, "collection.GetCollection")
+	defer span.End()
+
+	collection, err := l.collectionRepository.GetCollection(ctx, collectionId)
+	if err != nil {
+		return nil, errors.Wrap(err, "collection repository error")
+	}
+
+	if !collection.IsPublic && collection.UserID != askerId {
+		return nil, model.ErrNotFound
+	}
+
+	postIds, err := l.collectionRepository.GetCollectionPosts(ctx, collectionId)
+	if err != nil {
+		return nil, errors.Wrap(err, "collection repository error")
+	}
+
+	collection.Posts = make([]*model.Post, 0, len(postIds))
+	for _, postId := range postIds {
+		post, err := l.postService.GetPost(ctx, askerId, postId)
+		if errors.Is(err, model.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return nil, errors.Wrap(err, "post service error")
+		}
+
+		collection.Posts = append(collection.Posts, post)
+	}
+
+	return collection, nil
+}
+
+func (l *logic) GetUsersCollections(ctx context.Context, askerId, ownerId uint64) ([]*model.Collection, error) {
+	ctx, span := tracing.Start(ctx, "collection.GetUsersCollections")
+	defer span.End()
+
+	collections, err := l.collectionRepository.GetUsersCollections(ctx, ownerId, askerId != ownerId)
+	if err != nil {
+		return nil, errors.Wrap(err, "collection repository error")
+	}
+
+	return collections, nil
+}
+
+func (l *logic) CreateCollection(ctx context.Context, collection *model.Collection) error {
+	ctx, span := tracing.Start(ctx, "collection.CreateCollection")
+	defer span.End()
+
+	err := l.collectionRepository.CreateCollection(ctx, collection)
+	if err != nil {
+		return errors.Wrap(err, "collection repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) UpdateCollection(ctx context.Context, userId uint64, collection *model.Collection) (*model.Collection, error) {
+	ctx, span := tracing.Start(ctx, "collection.UpdateCollection")
+	defer span.End()
+
+	oldCollection, err := l.getOwnCollection(ctx, userId, collection.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getOwnCollection error")
+	}
+
+	oldCollection.Name = collection.Name
+	oldCollection.IsPublic = collection.IsPublic
+
+	err = l.collectionRepository.UpdateCollection(ctx, oldCollection)
+	if err != nil {
+		return nil, errors.Wrap(err, "collection repository error")
+	}
+
+	return oldCollection, nil
+}
+
+func (l *logic) DeleteCollection(ctx context.Context, userId, collectionId uint64) error {
+	ctx, span := tracing.Start(ctx, "collection.DeleteCollection")
+	defer span.End()
+
+	_, err := l.getOwnCollection(ctx, userId, collectionId)
+	if err != nil {
+		return errors.Wrap(err, "getOwnCollection error")
+	}
+
+	err = l.collectionRepository.DeleteCollection(ctx, collectionId)
+	if err != nil {
+		return errors.Wrap(err, "collection repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) AddPost(ctx context.Context, userId, collectionId, postId uint64) error {
+	ctx, span := tracing.Start(ctx, "collection.AddPost")
+	defer span.End()
+
+	_, err := l.getOwnCollection(ctx, userId, collectionId)
+	if err != nil {
+		return errors.Wrap(err, "getOwnCollection error")
+	}
+
+	_, err = l.postService.GetPost(ctx, userId, postId)
+	if err != nil {
+		return errors.Wrap(err, "post service error")
+	}
+
+	err = l.collectionRepository.AddPost(ctx, collectionId, postId)
+	if err != nil {
+		return errors.Wrap(err, "collection repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) RemovePost(ctx context.Context, userId, collectionId, postId uint64) error {
+	ctx, span := tracing.Start(ctx, "collection.RemovePost")
+	defer span.End()
+
+	_, err := l.getOwnCollection(ctx, userId, collectionId)
+	if err != nil {
+		return errors.Wrap(err, "getOwnCollection error")
+	}
+
+	err = l.collectionRepository.RemovePost(ctx, collectionId, postId)
+	if err != nil {
+		return errors.Wrap(err, "collection repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) getOwnCollection(ctx context.Context, userId, collectionId uint64) (*model.Collection, error) {
+	collection, err := l.collectionRepository.GetCollection(ctx, collectionId)
+	if err != nil {
+		return nil, errors.Wrap(err, "collection repository error")
+	}
+
+	if collection.UserID != userId {
+		return nil, model.ErrPermissionDenied
+	}
+
+	return collection, nil
+}
@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) GetCollection(_ context.Context, collectionId uint64) (*model.Collection, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	col := mr.find(collectionId)
+	if col == nil {
+		return nil, model.ErrNotFound
+	}
+
+	return mr.withPostCnt(col), nil
+}
+
+func (mr *memoryRepo) GetUsersCollections(_ context.Context, ownerId uint64, onlyPublic bool) ([]*model.Collection, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	collections := memdb.Filter(mr.db.Collections, func(c *model.Collection) bool {
+		return c.UserID == ownerId && (c.IsPublic || !onlyPublic)
+	})
+
+	// newest first
+	copied := make([]*model.Collection, len(collections))
+	for i, col := range collections {
+		copied[len(collections)-1-i] = mr.withPostCnt(col)
+	}
+
+	return copied, nil
+}
+
+func (mr *memoryRepo) CreateCollection(_ context.Context, collection *model.Collection) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	collection.Date = time.Now()
+	collection.ID = mr.db.NextID("collections")
+	mr.db.Collections = append(mr.db.Collections, &model.Collection{
+		ID:       collection.ID,
+		UserID:   collection.UserID,
+		Date:     collection.Date,
+		Name:     collection.Name,
+		IsPublic: collection.IsPublic,
+	})
+
+	return nil
+}
+
+func (mr *memoryRepo) UpdateCollection(_ context.Context, collection *model.Collection) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	col := mr.find(collection.ID)
+	if col == nil {
+		return model.ErrNotFound
+	}
+
+	col.Name = collection.Name
+	col.IsPublic = collection.IsPublic
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteCollection(_ context.Context, collectionId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Collections, func(c *model.Collection) bool { return c.ID == collectionId })
+	memdb.Delete(&mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool { return cp.CollectionID == collectionId })
+
+	return nil
+}
+
+func (mr *memoryRepo) GetCollectionPosts(_ context.Context, collectionId uint64) ([]uint64, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	entries := memdb.Filter(mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool {
+		return cp.CollectionID == collectionId
+	})
+
+	// newest first
+	ids := make([]uint64, len(entries))
+	for i, cp := range entries {
+		ids[len(entries)-1-i] = cp.PostID
+	}
+
+	return ids, nil
+}
+
+func (mr *memoryRepo) AddPost(_ context.Context, collectionId, postId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	added := memdb.Find(mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool {
+		return cp.CollectionID == collectionId && cp.PostID == postId
+	})
+	if added == nil {
+		mr.db.CollectionPosts = append(mr.db.CollectionPosts, &memdb.CollectionPost{
+			CollectionID: collectionId,
+			PostID:       postId,
+			CreatedAt:    time.Now(),
+		})
+	}
+
+	return nil
+}
+
+func (mr *memoryRepo) RemovePost(_ context.Context, collectionId, postId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool {
+		return cp.CollectionID == collectionId && cp.PostID == postId
+	})
+
+	return nil
+}
+
+func (mr *memoryRepo) RemovePostFromAll(_ context.Context, postId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool { return cp.PostID == postId })
+
+	return nil
+}
+
+func (mr *memoryRepo) GetSavedPosts(_ context.Context, userId uint64, postIds []uint64) (map[uint64]bool, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	byPost := make(map[uint64]bool)
+	for _, postId := range postIds {
+		saved := memdb.Find(mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool {
+			col := mr.find(cp.CollectionID)
+			return cp.PostID == postId && col != nil && col.UserID == userId
+		})
+		if saved != nil {
+			byPost[postId] = true
+		}
+	}
+
+	return byPost, nil
+}
+
+func (mr *memoryRepo) GetSaveCnts(_ context.Context, postIds []uint64) (map[uint64]int, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	byPost := make(map[uint64]int)
+	for _, postId := range postIds {
+		// users, not collections: saving a post twice counts once
+		users := make(map[uint64]struct{})
+		for _, cp := range mr.db.CollectionPosts {
+			if col := mr.find(cp.CollectionID); cp.PostID == postId && col != nil {
+				users[col.UserID] = struct{}{}
+			}
+		}
+
+		if len(users) > 0 {
+			byPost[postId] = len(users)
+		}
+	}
+
+	return byPost, nil
+}
+
+func (mr *memoryRepo) find(collectionId uint64) *model.Collection {
+	return memdb.Find(mr.db.Collections, func(c *model.Collection) bool { return c.ID == collectionId })
+}
+
+func (mr *memoryRepo) withPostCnt(col *model.Collection) *model.Collection {
+	copied := *col
+	copied.PostCnt = memdb.Count(mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool {
+		return cp.CollectionID == col.ID
+	})
+
+	return &copied
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const postCntSelect = "collections.*, " +
+	"(SELECT COUNT(*) FROM collection_posts WHERE collection_posts.collection_id = collections.id) AS post_cnt"
+
+type pgCollection struct {
+	ID        uint64
+	UserID    uint64
+	CreatedAt time.Time
+	Name      string
+	IsPublic  bool
+	PostCnt   int `gorm:"->"`
+}
+
+func (c pgCollection) toModelCollection() *model.Collection {
+	return &model.Collection{
+		ID:       c.ID,
+		UserID:   c.UserID,
+		Date:     c.CreatedAt,
+		Name:     c.Name,
+		IsPublic: c.IsPublic,
+		PostCnt:  c.PostCnt,
+	}
+}
+
+func toModelCollections(pg []*pgCollection) []*model.Collection {
+	collections := make([]*model.Collection, len(pg))
+
+	for i := range collections {
+		collections[i] = pg[i].toModelCollection()
+	}
+
+	return collections
+}
+
+func fromModelCollection(c *model.Collection) *pgCollection {
+	return &pgCollection{
+		ID:        c.ID,
+		UserID:    c.UserID,
+		CreatedAt: c.Date,
+		Name:      c.Name,
+		IsPublic:  c.IsPublic,
+	}
+}
+
+func (pgCollection) TableName() string {
+	return "collections"
+}
+
+type pgCollectionPost struct {
+	CollectionID uint64
+	PostID       uint64
+}
+
+func (pgCollectionPost) TableName() string {
+	return "collection_posts"
+}
+
+type pgRepo struct {
+	db *gorm.DB
+}
+
+func NewPgRepo(db *gorm.DB) *pgRepo {
+	return &pgRepo{
+		db: db,
+	}
+}
+
+func (pr *pgRepo) GetCollection(ctx context.Context, collectionId uint64) (*model.Collection, error) {
+	var col pgCollection
+
+	tx := txmanager.DB(ctx, pr.db).Select(postCntSelect).Where("id = ?", collectionId).Take(&col)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table collections)")
+	}
+
+	return col.toModelCollection(), nil
+}
+
+func (pr *pgRepo) GetUsersCollections(ctx context.Context, ownerId uint64, onlyPublic bool) ([]*model.Collection, error) {
+	collections := make([]*pgCollection, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Select(postCntSelect).Where("user_id = ?", ownerId)
+	if onlyPublic {
+		tx = tx.Where("is_public")
+	}
+
+	tx = tx.Order("id desc").Find(&collections)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table collections)")
+	}
+
+	return toModelCollections(collections), nil
+}
+
+func (pr *pgRepo) CreateCollection(ctx context.Context, collection *model.Collection) error {
+	collection.Date = time.Now()
+	pgCol := fromModelCollection(collection)
+
+	tx := txmanager.DB(ctx, pr.db).Create(pgCol)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table collections)")
+	}
+
+	collection.ID = pgCol.ID
+	return nil
+}
+
+func (pr *pgRepo) UpdateCollection(ctx context.Context, collection *model.Collection) error {
+	pgCol := fromModelCollection(collection)
+
+	tx := txmanager.DB(ctx, pr.db).Select("name", "is_public").Updates(pgCol)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table collections)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) DeleteCollection(ctx context.Context, collectionId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Delete(&pgCollection{}, collectionId)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table collections)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) GetCollectionPosts(ctx context.Context, collectionId uint64) ([]uint64, error) {
+	ids := make([]uint64, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgCollectionPost{}).Where(&pgCollectionPost{CollectionID: collectionId}).
+		Order("created_at desc, post_id desc").Pluck("post_id", &ids)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table collection_posts)")
+	}
+
+	return ids, nil
+}
+
+func (pr *pgRepo) AddPost(ctx context.Context, collectionId, postId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&pgCollectionPost{CollectionID: collectionId, PostID: postId})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table collection_posts)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) RemovePost(ctx context.Context, collectionId, postId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where(&pgCollectionPost{CollectionID: collectionId, PostID: postId}).Delete(&pgCollectionPost{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table collection_posts)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) RemovePostFromAll(ctx context.Context, postId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where(&pgCollectionPost{PostID: postId}).Delete(&pgCollectionPost{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table collection_posts)")
+	}
+
+	return nil
+}
+
+// GetSavedPosts returns which of the posts userId saved to any of their
+// collections.
+func (pr *pgRepo) GetSavedPosts(ctx context.Context, userId uint64, postIds []uint64) (map[uint64]bool, error) {
+	var saved []uint64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgCollectionPost{}).
+		Joins("JOIN collections ON collections.id = collection_posts.collection_id").
+		Where("collections.user_id = ? AND collection_posts.post_id IN ?", userId, postIds).
+		Distinct().Pluck("collection_posts.post_id", &saved)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table collection_posts)")
+	}
+
+	byPost := make(map[uint64]bool, len(saved))
+	for _, postId := range saved {
+		byPost[postId] = true
+	}
+
+	return byPost, nil
+}
+
+// GetSaveCnts returns how many users saved each of the posts by post id,
+// leaving out the posts nobody saved.
+func (pr *pgRepo) GetSaveCnts(ctx context.Context, postIds []uint64) (map[uint64]int, error) {
+	var rows []struct {
+		PostId  uint64
+		SaveCnt int
+	}
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgCollectionPost{}).
+		Select("collection_posts.post_id, COUNT(DISTINCT collections.user_id) AS save_cnt").
+		Joins("JOIN collections ON collections.id = collection_posts.collection_id").
+		Where("collection_posts.post_id IN ?", postIds).Group("collection_posts.post_id").Scan(&rows)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table collection_posts)")
+	}
+
+	byPost := make(map[uint64]int, len(rows))
+	for _, row := range rows {
+		byPost[row.PostId] = row.SaveCnt
+	}
+
+	return byPost, nil
+}
@@ -1,13 +1,13 @@
 package delivery
 
 import (
+	"context"
 	"net/http"
 	"strconv"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
-	"github.com/pkg/errors"
 
 	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
 	"github.com/ell1jah/bmstu_web/model"
@@ -15,8 +15,17 @@ import (
 )
 
 type CommentLogic interface {
-	GetPostComments(postId uint64) ([]*model.Comment, error)
-	CreateComment(comment *model.Comment) error
+	GetPostComments(ctx context.Context, postId uint64) ([]*model.Comment, error)
+	CreateComment(ctx context.Context, comment *model.Comment) error
+	DeleteComment(ctx context.Context, userId uint64, userRole string, commentId uint64) error
+}
+
+type ScopeMiddleware interface {
+	Scope(scope string) echo.MiddlewareFunc
+}
+
+type RateLimiter interface {
+	Limit(name string) echo.MiddlewareFunc
 }
 
 type handler struct {
@@ -29,9 +38,12 @@ func NewHandler(commentService CommentLogic) *handler {
 	}
 }
 
-func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
-	e.GET("/posts/:postID/comments", h.GetPostComments, auth)
-	e.POST("/posts/:postID/comments", h.CreateComment, auth)
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, scopes ScopeMiddleware, limits RateLimiter) {
+	e.GET("/posts/:postID/comments", h.GetPostComments, scopes.Scope(model.ScopeRead), auth)
+
+	write := scopes.Scope(model.ScopeCommentsWrite)
+	e.POST("/posts/:postID/comments", h.CreateComment, write, auth, limits.Limit("comment"))
+	e.DELETE("/comments/:commentID", h.DeleteComment, write, auth)
 }
 
 // GetPostComments godoc
@@ -50,14 +62,12 @@ func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
 func (h *handler) GetPostComments(c echo.Context) error {
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
-	comments, err := h.commentService.GetPostComments(postId)
+	comments, err := h.commentService.GetPostComments(c.Request().Context(), postId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusOK, dto.RespCommentsFromComments(comments))
@@ -81,57 +91,65 @@ func (h *handler) CreateComment(c echo.Context) error {
 	var reqComment dto.ReqComment
 	err := c.Bind(&reqComment)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	_, err = govalidator.ValidateStruct(reqComment)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	comment := reqComment.ToComment()
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
 	comment.UserID = userClaims.User.ID
 
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	comment.PostID = postId
 
-	err = h.commentService.CreateComment(comment)
+	err = h.commentService.CreateComment(c.Request().Context(), comment)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, dto.RespCommentFromComment(comment))
 }
 
-func handleError(err error) *echo.HTTPError {
-	causeErr := errors.Cause(err)
-	switch {
-	case errors.Is(causeErr, model.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, model.ErrNotFound.Error())
-	case errors.Is(causeErr, model.ErrBadRequest):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
-	case errors.Is(causeErr, model.ErrPermissionDenied):
-		return echo.NewHTTPError(http.StatusForbidden, model.ErrPermissionDenied.Error())
-	case errors.Is(causeErr, model.ErrInvalidPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrInvalidPassword.Error())
-	case errors.Is(causeErr, model.ErrConflictPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrConflictPassword.Error())
-	default:
-		return echo.NewHTTPError(http.StatusInternalServerError, causeErr.Error())
+// DeleteComment godoc
+// @Summary      Delete a comment
+// @Description  Delete a comment, allowed to its author and moderators
+// @Tags     comments
+// @Param commentID path int true "comment ID"
+// @Success  200 "success delete comment"
+// @Failure 400 {object} echo.HTTPError "bad request"
+// @Failure 403 {object} echo.HTTPError "permission denied"
+// @Failure 404 {object} echo.HTTPError "item not found"
+// @Failure 500 {object} echo.HTTPError "internal server error"
+// @Failure 401 {object} echo.HTTPError "no auth"
+// @Router   /comments/{commentID} [delete]
+func (h *handler) DeleteComment(c echo.Context) error {
+	commentId, err := strconv.ParseUint(c.Param("commentID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
 	}
+
+	err = h.commentService.DeleteComment(c.Request().Context(), userClaims.User.ID, userClaims.User.Role, commentId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
 }
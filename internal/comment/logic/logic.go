@@ -1,39 +1,53 @@
 package logic
 
 import (
+	"context"
+	"github.com/ell1jah/bmstu_web/internal/pkg/metrics"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
 )
 
 type CommentRepository interface {
-	GetPostComments(postId uint64) ([]*model.Comment, error)
-	CreateComment(comment *model.Comment) error
+	GetComment(ctx context.Context, commentId uint64) (*model.Comment, error)
+	GetPostComments(ctx context.Context, postId uint64) ([]*model.Comment, error)
+	CreateComment(ctx context.Context, comment *model.Comment) error
+	DeleteComment(ctx context.Context, commentId uint64) error
 }
 
 type UserRepository interface {
-	GetUserByID(id uint64) (*model.User, error)
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, event *model.Event)
 }
 
 type logic struct {
 	commentRepository CommentRepository
 	userRepository    UserRepository
+	eventPublisher    EventPublisher
 }
 
-func NewLogic(commentRepository CommentRepository, userRepository UserRepository) *logic {
+func NewLogic(commentRepository CommentRepository, userRepository UserRepository, eventPublisher EventPublisher) *logic {
 	return &logic{
 		commentRepository: commentRepository,
 		userRepository:    userRepository,
+		eventPublisher:    eventPublisher,
 	}
 }
 
-func (l *logic) GetPostComments(postId uint64) ([]*model.Comment, error) {
-	comments, err := l.commentRepository.GetPostComments(postId)
+func (l *logic) GetPostComments(ctx context.Context, postId uint64) ([]*model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "comment.GetPostComments")
+	defer span.End()
+
+	comments, err := l.commentRepository.GetPostComments(ctx, postId)
 	if err != nil {
 		return nil, errors.Wrap(err, "comment repository error")
 	}
 
 	for _, comment := range comments {
-		err = l.addUserInfo(comment)
+		err = l.addUserInfo(ctx, comment)
 		if err != nil {
 			return nil, errors.Wrap(err, "addUserInfo error")
 		}
@@ -42,22 +56,59 @@ func (l *logic) GetPostComments(postId uint64) ([]*model.Comment, error) {
 	return comments, nil
 }
 
-func (l *logic) CreateComment(comment *model.Comment) error {
-	err := l.commentRepository.CreateComment(comment)
+func (l *logic) CreateComment(ctx context.Context, comment *model.Comment) error {
+	ctx, span := tracing.Start(ctx, "comment.CreateComment")
+	defer span.End()
+
+	err := l.commentRepository.CreateComment(ctx, comment)
 	if err != nil {
 		return errors.Wrap(err, "comment repository error")
 	}
+	metrics.CommentsCreated.Inc()
 
-	err = l.addUserInfo(comment)
+	err = l.addUserInfo(ctx, comment)
 	if err != nil {
 		return errors.Wrap(err, "addUserInfo error")
 	}
 
+	l.eventPublisher.Publish(ctx, &model.Event{
+		Type:    model.EventComment,
+		PostID:  comment.PostID,
+		Comment: comment,
+	})
+
+	return nil
+}
+
+func (l *logic) DeleteComment(ctx context.Context, userId uint64, userRole string, commentId uint64) error {
+	ctx, span := tracing.Start(ctx, "comment.DeleteComment")
+	defer span.End()
+
+	comment, err := l.commentRepository.GetComment(ctx, commentId)
+	if err != nil {
+		return errors.Wrap(err, "comment repository error")
+	}
+
+	if comment.UserID != userId && !model.HasRole(userRole, model.RoleModerator) {
+		return model.ErrPermissionDenied
+	}
+
+	err = l.commentRepository.DeleteComment(ctx, commentId)
+	if err != nil {
+		return errors.Wrap(err, "comment repository error")
+	}
+
+	l.eventPublisher.Publish(ctx, &model.Event{
+		Type:    model.EventCommentDeleted,
+		PostID:  comment.PostID,
+		Comment: comment,
+	})
+
 	return nil
 }
 
-func (l *logic) addUserInfo(comment *model.Comment) error {
-	user, err := l.userRepository.GetUserByID(comment.UserID)
+func (l *logic) addUserInfo(ctx context.Context, comment *model.Comment) error {
+	user, err := l.userRepository.GetUserByID(ctx, comment.UserID)
 	if err != nil {
 		return errors.Wrap(err, "user repository error")
 	}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) GetComment(_ context.Context, commentId uint64) (*model.Comment, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	cmt := memdb.Find(mr.db.Comments, func(c *model.Comment) bool { return c.ID == commentId })
+	if cmt == nil {
+		return nil, model.ErrNotFound
+	}
+
+	return copyComment(cmt), nil
+}
+
+func (mr *memoryRepo) GetPostComments(_ context.Context, postId uint64) ([]*model.Comment, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	comments := memdb.Filter(mr.db.Comments, func(c *model.Comment) bool {
+		return c.PostID == postId && mr.visible(c)
+	})
+
+	// newest first
+	copied := make([]*model.Comment, len(comments))
+	for i, cmt := range comments {
+		copied[len(comments)-1-i] = copyComment(cmt)
+	}
+
+	return copied, nil
+}
+
+// GetAllUsersComments returns hidden comments too, it's for the owner's own data only.
+func (mr *memoryRepo) GetAllUsersComments(_ context.Context, userId uint64) ([]*model.Comment, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	comments := memdb.Filter(mr.db.Comments, func(c *model.Comment) bool { return c.UserID == userId })
+
+	copied := make([]*model.Comment, len(comments))
+	for i, cmt := range comments {
+		copied[i] = copyComment(cmt)
+	}
+
+	return copied, nil
+}
+
+func (mr *memoryRepo) CreateComment(_ context.Context, comment *model.Comment) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	comment.Date = time.Now()
+	comment.ID = mr.db.NextID("comments")
+	mr.db.Comments = append(mr.db.Comments, &model.Comment{
+		ID:       comment.ID,
+		UserID:   comment.UserID,
+		PostID:   comment.PostID,
+		Date:     comment.Date,
+		Body:     comment.Body,
+		IsHidden: comment.IsHidden,
+	})
+
+	return nil
+}
+
+func (mr *memoryRepo) SetCommentHidden(_ context.Context, commentId uint64, hidden bool) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	cmt := memdb.Find(mr.db.Comments, func(c *model.Comment) bool { return c.ID == commentId })
+	if cmt != nil {
+		cmt.IsHidden = hidden
+	}
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteComment(_ context.Context, commentId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Comments, func(c *model.Comment) bool { return c.ID == commentId })
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteUsersComments(_ context.Context, userId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Comments, func(c *model.Comment) bool { return c.UserID == userId })
+
+	return nil
+}
+
+// visible tells whether the comment is shown to others: not hidden
+// and not by a banned author.
+func (mr *memoryRepo) visible(cmt *model.Comment) bool {
+	if cmt.IsHidden {
+		return false
+	}
+
+	author := memdb.Find(mr.db.Users, func(u *model.User) bool { return u.ID == cmt.UserID })
+	return author == nil || author.Status != model.UserBanned
+}
+
+func copyComment(cmt *model.Comment) *model.Comment {
+	copied := *cmt
+	return &copied
+}
@@ -1,28 +1,34 @@
 package repository
 
 import (
+	"context"
 	"time"
 
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
+const notBannedAuthor = "user_id NOT IN (SELECT id FROM users WHERE status = 'banned')"
+
 type pgComment struct {
 	ID        uint64
 	UserID    uint64
 	PostID    uint64
 	CreatedAt time.Time
 	Text      string
+	IsHidden  bool
 }
 
 func (c pgComment) toModelComment() *model.Comment {
 	return &model.Comment{
-		ID:     c.ID,
-		UserID: c.UserID,
-		PostID: c.PostID,
-		Date:   c.CreatedAt,
-		Body:   c.Text,
+		ID:       c.ID,
+		UserID:   c.UserID,
+		PostID:   c.PostID,
+		Date:     c.CreatedAt,
+		Body:     c.Text,
+		IsHidden: c.IsHidden,
 	}
 }
 
@@ -43,6 +49,7 @@ func fromModelComment(c *model.Comment) *pgComment {
 		PostID:    c.PostID,
 		CreatedAt: c.Date,
 		Text:      c.Body,
+		IsHidden:  c.IsHidden,
 	}
 }
 
@@ -60,10 +67,23 @@ func NewPgRepo(db *gorm.DB) *pgRepo {
 	}
 }
 
-func (pr *pgRepo) GetPostComments(postId uint64) ([]*model.Comment, error) {
+func (pr *pgRepo) GetComment(ctx context.Context, commentId uint64) (*model.Comment, error) {
+	var cmt pgComment
+
+	tx := txmanager.DB(ctx, pr.db).Where("id = ?", commentId).Take(&cmt)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table comments)")
+	}
+
+	return cmt.toModelComment(), nil
+}
+
+func (pr *pgRepo) GetPostComments(ctx context.Context, postId uint64) ([]*model.Comment, error) {
 	comments := make([]*pgComment, 0, 10)
 
-	tx := pr.db.Where(&pgComment{PostID: postId}).Order("id desc").Find(&comments)
+	tx := txmanager.DB(ctx, pr.db).Where(&pgComment{PostID: postId}).Where("NOT is_hidden").Where(notBannedAuthor).Order("id desc").Find(&comments)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -73,11 +93,23 @@ func (pr *pgRepo) GetPostComments(postId uint64) ([]*model.Comment, error) {
 	return toModelComments(comments), nil
 }
 
-func (pr *pgRepo) CreateComment(comment *model.Comment) error {
+// GetAllUsersComments returns hidden comments too, it's for the owner's own data only.
+func (pr *pgRepo) GetAllUsersComments(ctx context.Context, userId uint64) ([]*model.Comment, error) {
+	comments := make([]*pgComment, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Where(&pgComment{UserID: userId}).Order("id").Find(&comments)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table comments)")
+	}
+
+	return toModelComments(comments), nil
+}
+
+func (pr *pgRepo) CreateComment(ctx context.Context, comment *model.Comment) error {
 	comment.Date = time.Now()
 	pgComment := fromModelComment(comment)
 
-	tx := pr.db.Create(pgComment)
+	tx := txmanager.DB(ctx, pr.db).Create(pgComment)
 	if tx.Error != nil {
 		return errors.Wrap(tx.Error, "database error (table comments)")
 	}
@@ -85,3 +117,30 @@ func (pr *pgRepo) CreateComment(comment *model.Comment) error {
 	comment.ID = pgComment.ID
 	return nil
 }
+
+func (pr *pgRepo) SetCommentHidden(ctx context.Context, commentId uint64, hidden bool) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgComment{ID: commentId}).Update("is_hidden", hidden)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table comments)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) DeleteComment(ctx context.Context, commentId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Delete(&pgComment{}, commentId)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table comments)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) DeleteUsersComments(ctx context.Context, userId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Delete(&pgComment{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table comments)")
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+const keepAlivePeriod = 15 * time.Second
+
+type EventLogic interface {
+	SubscribePost(ctx context.Context, postId uint64) (<-chan *model.Event, func(), error)
+}
+
+type ScopeMiddleware interface {
+	Scope(scope string) echo.MiddlewareFunc
+}
+
+type handler struct {
+	eventService EventLogic
+}
+
+func NewHandler(eventService EventLogic) *handler {
+	return &handler{
+		eventService: eventService,
+	}
+}
+
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, scopes ScopeMiddleware) {
+	e.GET("/posts/:postID/events", h.GetPostEvents, scopes.Scope(model.ScopeRead), auth)
+}
+
+// GetPostEvents godoc
+// @Summary      Subscribe to post events
+// @Description  Server-sent events stream with new comments and rating changes of the post
+// @Tags     events
+// @Produce  text/event-stream
+// @Param postID path int true "post ID"
+// @Success  200 {object} dto.RespEvent "event stream"
+// @Failure 400 {object} echo.HTTPError "bad request"
+// @Failure 404 {object} echo.HTTPError "item not found"
+// @Failure 401 {object} echo.HTTPError "no auth"
+// @Failure 500 {object} echo.HTTPError "internal server error"
+// @Router   /posts/{postID}/events [get]
+func (h *handler) GetPostEvents(c echo.Context) error {
+	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	events, unsubscribe, err := h.eventService.SubscribePost(c.Request().Context(), postId)
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	res := c.Response()
+
+	// the stream outlives the server WriteTimeout
+	err = http.NewResponseController(res).SetWriteDeadline(time.Time{})
+	if err != nil {
+		return errors.Wrap(err, "response controller error")
+	}
+
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	ticker := time.NewTicker(keepAlivePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request().Context().Done():
+			return nil
+		case <-ticker.C:
+			if _, err = fmt.Fprint(res, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+			res.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			data, err := json.Marshal(dto.RespEventFromEvent(event))
+			if err != nil {
+				logger.Ctx(c.Request().Context(), "event").Error("event marshal", zap.Error(err))
+				continue
+			}
+
+			if _, err = fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return nil
+			}
+			res.Flush()
+		}
+	}
+}
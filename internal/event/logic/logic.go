@@ -0,0 +1,41 @@
+package logic
+
+import (
+	"context"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type PostRepository interface {
+	GetPost(ctx context.Context, postId uint64) (*model.Post, error)
+}
+
+type EventSubscriber interface {
+	Subscribe(postId uint64) (<-chan *model.Event, func())
+}
+
+type logic struct {
+	postRepository  PostRepository
+	eventSubscriber EventSubscriber
+}
+
+func NewLogic(postRepository PostRepository, eventSubscriber EventSubscriber) *logic {
+	return &logic{
+		postRepository:  postRepository,
+		eventSubscriber: eventSubscriber,
+	}
+}
+
+func (l *logic) SubscribePost(ctx context.Context, postId uint64) (<-chan *model.Event, func(), error) {
+	ctx, span := tracing.Start(ctx, "event.SubscribePost")
+	defer span.End()
+
+	_, err := l.postRepository.GetPost(ctx, postId)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "post repository error")
+	}
+
+	events, unsubscribe := l.eventSubscriber.Subscribe(postId)
+	return events, unsubscribe, nil
+}
@@ -0,0 +1,110 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+type FollowLogic interface {
+	Follow(ctx context.Context, followerId, followeeId uint64) error
+	Unfollow(ctx context.Context, followerId, followeeId uint64) error
+	GetFollowers(ctx context.Context, userId uint64) ([]*model.User, error)
+	GetFollowing(ctx context.Context, userId uint64) ([]*model.User, error)
+}
+
+type ScopeMiddleware interface {
+	Scope(scope string) echo.MiddlewareFunc
+}
+
+type handler struct {
+	followService FollowLogic
+}
+
+func NewHandler(followService FollowLogic) *handler {
+	return &handler{
+		followService: followService,
+	}
+}
+
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, scopes ScopeMiddleware) {
+	e.PUT("/users/:userID/follow", h.Follow, auth)
+	e.DELETE("/users/:userID/follow", h.Unfollow, auth)
+
+	read := scopes.Scope(model.ScopeRead)
+	e.GET("/users/:userID/followers", h.GetFollowers, read, auth)
+	e.GET("/users/:userID/following", h.GetFollowing, read, auth)
+}
+
+func (h *handler) Follow(c echo.Context) error {
+	followeeId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.followService.Follow(c.Request().Context(), userClaims.User.ID, followeeId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) Unfollow(c echo.Context) error {
+	followeeId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.followService.Unfollow(c.Request().Context(), userClaims.User.ID, followeeId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) GetFollowers(c echo.Context) error {
+	userId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	users, err := h.followService.GetFollowers(c.Request().Context(), userId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespUsersFromUsers(users))
+}
+
+func (h *handler) GetFollowing(c echo.Context) error {
+	userId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	users, err := h.followService.GetFollowing(c.Request().Context(), userId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespUsersFromUsers(users))
+}
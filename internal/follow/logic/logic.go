@@ -0,0 +1,122 @@
+package logic
+
+import (
+	"context"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type FollowRepository interface {
+	GetFollowers(ctx context.Context, followeeId uint64) ([]uint64, error)
+	GetFollowing(ctx context.Context, followerId uint64) ([]uint64, error)
+	Create(ctx context.Context, followerId, followeeId uint64) error
+	Delete(ctx context.Context, followerId, followeeId uint64) error
+}
+
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error)
+}
+
+type logic struct {
+	followRepository FollowRepository
+	userRepository   UserRepository
+}
+
+func NewLogic(followRepository FollowRepository, userRepository UserRepository) *logic {
+	return &logic{
+		followRepository: followRepository,
+		userRepository:   userRepository,
+	}
+}
+
+func (l *logic) Follow(ctx context.Context, followerId, followeeId uint64) error {
+	ctx, span := tracing.Start(ctx, "follow.Follow")
+	defer span.End()
+
+	if followerId == followeeId {
+		return errors.Wrap(model.ErrBadRequest, "can't follow yourself")
+	}
+
+	_, err := l.userRepository.GetUserByID(ctx, followeeId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	err = l.followRepository.Create(ctx, followerId, followeeId)
+	if err != nil {
+		return errors.Wrap(err, "follow repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) Unfollow(ctx context.Context, followerId, followeeId uint64) error {
+	ctx, span := tracing.Start(ctx, "follow.Unfollow")
+	defer span.End()
+
+	err := l.followRepository.Delete(ctx, followerId, followeeId)
+	if err != nil {
+		return errors.Wrap(err, "follow repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) GetFollowers(ctx context.Context, userId uint64) ([]*model.User, error) {
+	ctx, span := tracing.Start(ctx, "follow.GetFollowers")
+	defer span.End()
+
+	_, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	ids, err := l.followRepository.GetFollowers(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "follow repository error")
+	}
+
+	users, err := l.getUsers(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "getUsers error")
+	}
+
+	return users, nil
+}
+
+func (l *logic) GetFollowing(ctx context.Context, userId uint64) ([]*model.User, error) {
+	ctx, span := tracing.Start(ctx, "follow.GetFollowing")
+	defer span.End()
+
+	_, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	ids, err := l.followRepository.GetFollowing(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "follow repository error")
+	}
+
+	users, err := l.getUsers(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "getUsers error")
+	}
+
+	return users, nil
+}
+
+func (l *logic) getUsers(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	users, err := l.userRepository.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	for _, user := range users {
+		user.Password = ""
+	}
+
+	return users, nil
+}
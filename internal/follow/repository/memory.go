@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) IsFollowing(_ context.Context, followerId, followeeId uint64) (bool, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return mr.find(followerId, followeeId) != nil, nil
+}
+
+func (mr *memoryRepo) GetFollowers(_ context.Context, followeeId uint64) ([]uint64, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	follows := memdb.Filter(mr.db.Follows, func(f *memdb.Follow) bool { return f.FolloweeID == followeeId })
+
+	// newest first
+	ids := make([]uint64, len(follows))
+	for i, f := range follows {
+		ids[len(follows)-1-i] = f.FollowerID
+	}
+
+	return ids, nil
+}
+
+func (mr *memoryRepo) GetFollowing(_ context.Context, followerId uint64) ([]uint64, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	follows := memdb.Filter(mr.db.Follows, func(f *memdb.Follow) bool { return f.FollowerID == followerId })
+
+	// newest first
+	ids := make([]uint64, len(follows))
+	for i, f := range follows {
+		ids[len(follows)-1-i] = f.FolloweeID
+	}
+
+	return ids, nil
+}
+
+func (mr *memoryRepo) GetFollowCnts(_ context.Context, userId uint64) (model.FollowCnts, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return model.FollowCnts{
+		FollowerCnt:  memdb.Count(mr.db.Follows, func(f *memdb.Follow) bool { return f.FolloweeID == userId }),
+		FollowingCnt: memdb.Count(mr.db.Follows, func(f *memdb.Follow) bool { return f.FollowerID == userId }),
+	}, nil
+}
+
+// Create returns model.ErrConflictFriend if the follow exists already.
+func (mr *memoryRepo) Create(_ context.Context, followerId, followeeId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	if followerId == followeeId {
+		return errors.New("database error (table follows): self follow")
+	} else if mr.find(followerId, followeeId) != nil {
+		return model.ErrConflictFriend
+	}
+
+	mr.db.Follows = append(mr.db.Follows, &memdb.Follow{FollowerID: followerId, FolloweeID: followeeId, CreatedAt: time.Now()})
+
+	return nil
+}
+
+func (mr *memoryRepo) Delete(_ context.Context, followerId, followeeId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Follows, func(f *memdb.Follow) bool {
+		return f.FollowerID == followerId && f.FolloweeID == followeeId
+	})
+
+	return nil
+}
+
+func (mr *memoryRepo) find(followerId, followeeId uint64) *memdb.Follow {
+	return memdb.Find(mr.db.Follows, func(f *memdb.Follow) bool {
+		return f.FollowerID == followerId && f.FolloweeID == followeeId
+	})
+}
@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgFollow struct {
+	FollowerId uint64
+	FolloweeId uint64
+	CreatedAt  time.Time
+}
+
+func (pgFollow) TableName() string {
+	return "follows"
+}
+
+type pgRepo struct {
+	db *gorm.DB
+}
+
+func NewPgRepo(db *gorm.DB) *pgRepo {
+	return &pgRepo{
+		db: db,
+	}
+}
+
+func (pr *pgRepo) IsFollowing(ctx context.Context, followerId, followeeId uint64) (bool, error) {
+	var cnt int64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgFollow{}).Where(&pgFollow{FollowerId: followerId, FolloweeId: followeeId}).Count(&cnt)
+	if tx.Error != nil {
+		return false, errors.Wrap(tx.Error, "database error (table follows)")
+	}
+
+	return cnt > 0, nil
+}
+
+func (pr *pgRepo) GetFollowers(ctx context.Context, followeeId uint64) ([]uint64, error) {
+	ids := make([]uint64, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgFollow{}).Where(&pgFollow{FolloweeId: followeeId}).
+		Order("created_at desc").Pluck("follower_id", &ids)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table follows)")
+	}
+
+	return ids, nil
+}
+
+func (pr *pgRepo) GetFollowing(ctx context.Context, followerId uint64) ([]uint64, error) {
+	ids := make([]uint64, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgFollow{}).Where(&pgFollow{FollowerId: followerId}).
+		Order("created_at desc").Pluck("followee_id", &ids)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table follows)")
+	}
+
+	return ids, nil
+}
+
+func (pr *pgRepo) GetFollowCnts(ctx context.Context, userId uint64) (model.FollowCnts, error) {
+	var followers, following int64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgFollow{}).Where(&pgFollow{FolloweeId: userId}).Count(&followers)
+	if tx.Error != nil {
+		return model.FollowCnts{}, errors.Wrap(tx.Error, "database error (table follows)")
+	}
+
+	tx = txmanager.DB(ctx, pr.db).Model(&pgFollow{}).Where(&pgFollow{FollowerId: userId}).Count(&following)
+	if tx.Error != nil {
+		return model.FollowCnts{}, errors.Wrap(tx.Error, "database error (table follows)")
+	}
+
+	return model.FollowCnts{FollowerCnt: int(followers), FollowingCnt: int(following)}, nil
+}
+
+// Create returns model.ErrConflictFriend if the follow exists already.
+func (pr *pgRepo) Create(ctx context.Context, followerId, followeeId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&pgFollow{FollowerId: followerId, FolloweeId: followeeId})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table follows)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrConflictFriend
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) Delete(ctx context.Context, followerId, followeeId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where(&pgFollow{FollowerId: followerId, FolloweeId: followeeId}).Delete(&pgFollow{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table follows)")
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package delivery
 
 import (
+	"context"
 	"io"
 	"net/http"
 
@@ -12,8 +13,16 @@ import (
 )
 
 type ImageLogic interface {
-	GetImage(imageId string) (io.Reader, error)
-	CreateImage(io.Reader) (string, error)
+	GetImage(ctx context.Context, imageId string) (io.Reader, error)
+	CreateImage(ctx context.Context, file io.Reader) (string, error)
+}
+
+type ScopeMiddleware interface {
+	Scope(scope string) echo.MiddlewareFunc
+}
+
+type RateLimiter interface {
+	Limit(name string) echo.MiddlewareFunc
 }
 
 type handler struct {
@@ -26,22 +35,23 @@ func NewHandler(imageService ImageLogic) *handler {
 	}
 }
 
-func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
-	e.GET("/images/:imageID", h.GetImage, auth)
-	e.POST("/images", h.CreateImage, auth)
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, scopes ScopeMiddleware, limits RateLimiter) {
+	e.GET("/images/:imageID", h.GetImage, scopes.Scope(model.ScopeRead), auth)
+	e.POST("/images", h.CreateImage, scopes.Scope(model.ScopeImagesWrite), auth, limits.Limit("upload"))
 }
 
 func (h *handler) GetImage(c echo.Context) error {
 	imageId := c.Param("imageID")
 	if imageId == "" {
-		c.Logger().Error("empty imageId")
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
-	image, err := h.imageService.GetImage(imageId)
+	image, err := h.imageService.GetImage(c.Request().Context(), imageId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
+	}
+	if closer, ok := image.(io.Closer); ok {
+		defer closer.Close()
 	}
 
 	return c.Stream(http.StatusOK, "Image/png", image)
@@ -50,39 +60,18 @@ func (h *handler) GetImage(c echo.Context) error {
 func (h *handler) CreateImage(c echo.Context) error {
 	file, err := c.FormFile("Image")
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "Not Attachment in form")
+		return errors.Wrap(model.ErrBadRequest, "no attachment in form")
 	}
 	src, err := file.Open()
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal server error")
+		return errors.Wrap(err, "form file open error")
 	}
 	defer src.Close()
 
-	id, err := h.imageService.CreateImage(src)
+	id, err := h.imageService.CreateImage(c.Request().Context(), src)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, dto.RespImageFromID(id))
 }
-
-func handleError(err error) *echo.HTTPError {
-	causeErr := errors.Cause(err)
-	switch {
-	case errors.Is(causeErr, model.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, model.ErrNotFound.Error())
-	case errors.Is(causeErr, model.ErrBadRequest):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
-	case errors.Is(causeErr, model.ErrPermissionDenied):
-		return echo.NewHTTPError(http.StatusForbidden, model.ErrPermissionDenied.Error())
-	case errors.Is(causeErr, model.ErrInvalidPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrInvalidPassword.Error())
-	case errors.Is(causeErr, model.ErrConflictPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrConflictPassword.Error())
-	default:
-		return echo.NewHTTPError(http.StatusInternalServerError, "internal error")
-	}
-}
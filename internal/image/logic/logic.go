@@ -1,11 +1,20 @@
 package logic
 
 import (
+	"context"
 	"io"
 	"os"
+	"time"
 
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/metrics"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
 	"github.com/rs/xid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
 )
 
 const (
@@ -13,6 +22,46 @@ const (
 	pngExt   = ".png"
 )
 
+// ctxReader stops reading once ctx is done, so a gone client doesn't keep
+// a copy of a large file running.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(p []byte) (int, error) {
+	err := cr.ctx.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	return cr.r.Read(p)
+}
+
+// ctxFile is a ctxReader still closed by the caller, closing it ends the
+// span of reading the image.
+type ctxFile struct {
+	ctxReader
+	f    *os.File
+	span trace.Span
+	read int64
+}
+
+func (cf *ctxFile) Read(p []byte) (int, error) {
+	n, err := cf.ctxReader.Read(p)
+	cf.read += int64(n)
+	return n, err
+}
+
+func (cf *ctxFile) Close() error {
+	err := cf.f.Close()
+
+	cf.span.SetAttributes(attribute.Int64("image.bytes", cf.read))
+	tracing.End(cf.span, err)
+
+	return err
+}
+
 type logic struct {
 }
 
@@ -20,17 +69,43 @@ func NewLogic() *logic {
 	return &logic{}
 }
 
-func (l *logic) GetImage(imageId string) (io.Reader, error) {
+func (l *logic) GetImage(ctx context.Context, imageId string) (io.Reader, error) {
+	ctx, span := tracing.Start(ctx, "image.read", attribute.String("image.id", imageId))
+
 	f, err := os.Open(imageDir + imageId + pngExt)
-	if err != nil {
-		return nil, errors.Wrap(err, "os create error")
+	if errors.Is(err, os.ErrNotExist) {
+		span.End()
+		return nil, errors.Wrap(model.ErrNotFound, "no image")
+	} else if err != nil {
+		tracing.End(span, err)
+		return nil, errors.Wrap(err, "os open error")
 	}
 
-	return f, nil
+	return &ctxFile{ctxReader: ctxReader{ctx: ctx, r: f}, f: f, span: span}, nil
 }
 
-func (l *logic) CreateImage(file io.Reader) (string, error) {
-	id := xid.New().String()
+func (l *logic) CheckImage(ctx context.Context, imageId string) error {
+	_, span := tracing.Start(ctx, "image.stat", attribute.String("image.id", imageId))
+
+	_, err := os.Stat(imageDir + imageId + pngExt)
+	if errors.Is(err, os.ErrNotExist) {
+		span.End()
+		return errors.Wrap(model.ErrNotFound, "no image")
+	} else if err != nil {
+		tracing.End(span, err)
+		return errors.Wrap(err, "os stat error")
+	}
+
+	span.End()
+	return nil
+}
+
+func (l *logic) CreateImage(ctx context.Context, file io.Reader) (id string, err error) {
+	start := time.Now()
+	id = xid.New().String()
+
+	ctx, span := tracing.Start(ctx, "image.write", attribute.String("image.id", id))
+	defer func() { tracing.End(span, err) }()
 
 	dst, err := os.Create(imageDir + id + pngExt)
 	if err != nil {
@@ -39,9 +114,77 @@ func (l *logic) CreateImage(file io.Reader) (string, error) {
 	}
 	defer dst.Close()
 
-	if _, err = io.Copy(dst, file); err != nil {
+	written, err := io.Copy(dst, &ctxReader{ctx: ctx, r: file})
+	span.SetAttributes(attribute.Int64("image.bytes", written))
+	if err != nil {
+		// a canceled upload mustn't leave half an image behind
+		os.Remove(dst.Name())
 		return "", errors.Wrap(err, "io copy error")
 	}
+	metrics.ImageUploadBytes.Observe(float64(written))
+	metrics.ImageProcessing.Observe(time.Since(start).Seconds())
 
 	return id, nil
 }
+
+func (l *logic) DeleteImage(ctx context.Context, imageId string) error {
+	_, span := tracing.Start(ctx, "image.delete", attribute.String("image.id", imageId))
+
+	err := os.Remove(imageDir + imageId + pngExt)
+	if errors.Is(err, os.ErrNotExist) {
+		span.End()
+		return errors.Wrap(model.ErrNotFound, "no image")
+	} else if err != nil {
+		tracing.End(span, err)
+		return errors.Wrap(err, "os remove error")
+	}
+
+	span.End()
+	return nil
+}
+
+// RunStorageScan sets the stored image bytes metric every period until ctx
+// is done. The directory is shared by the servers, so it is summed up
+// rather than tracked by the uploads of one of them.
+func (l *logic) RunStorageScan(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		size, err := storedBytes()
+		if err != nil {
+			logger.Ctx(ctx, "image").Error("storage scan", zap.Error(err))
+		} else {
+			metrics.StoredImageBytes.Set(float64(size))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func storedBytes() (int64, error) {
+	entries, err := os.ReadDir(imageDir)
+	if err != nil {
+		return 0, errors.Wrap(err, "os read dir error")
+	}
+
+	var size int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			// deleted while scanning
+			continue
+		} else if err != nil {
+			return 0, errors.Wrap(err, "os stat error")
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+	}
+
+	return size, nil
+}
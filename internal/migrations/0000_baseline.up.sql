@@ -0,0 +1,214 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	login VARCHAR(30) NOT NULL UNIQUE,
+	password VARCHAR(128) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS posts (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+    created_at DATE NOT NULL,
+    image_id VARCHAR(260) NOT NULL,
+    category VARCHAR(64) NOT NULL,
+    sex VARCHAR(16) NOT NULL,
+    brand VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL,
+    link VARCHAR(260) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id),
+    post_id INT NOT NULL REFERENCES posts(id),
+    created_at DATE NOT NULL,
+    text TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS post_rates (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    rate BOOLEAN NOT NULL,
+	PRIMARY KEY (user_id, post_id)
+);
+
+-- the go-admin panel, seeded with its admin and operator accounts
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_menu_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_menu (
+	id INT DEFAULT nextval('goadmin_menu_myid_seq') PRIMARY KEY,
+	parent_id INT NOT NULL DEFAULT 0,
+	type INT DEFAULT 0,
+	"order" INT NOT NULL DEFAULT 0,
+	title VARCHAR(50) NOT NULL,
+	header VARCHAR(100),
+	plugin_name VARCHAR(100) NOT NULL,
+	icon VARCHAR(50) NOT NULL,
+	uri VARCHAR(3000) NOT NULL,
+	uuid VARCHAR(100),
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_operation_log_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_operation_log (
+	id INT DEFAULT nextval('goadmin_operation_log_myid_seq') PRIMARY KEY,
+	user_id INT NOT NULL,
+	path VARCHAR(255) NOT NULL,
+	method VARCHAR(10) NOT NULL,
+	ip VARCHAR(15) NOT NULL,
+	input TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_site_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_site (
+	id INT DEFAULT nextval('goadmin_site_myid_seq') PRIMARY KEY,
+	key VARCHAR(100) NOT NULL,
+	value TEXT NOT NULL,
+	type INT DEFAULT 0,
+	description VARCHAR(3000),
+	state INT DEFAULT 0,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_permissions_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_permissions (
+	id INT DEFAULT nextval('goadmin_permissions_myid_seq') PRIMARY KEY,
+	name VARCHAR(50) NOT NULL,
+	slug VARCHAR(50) NOT NULL,
+	http_method VARCHAR(255),
+	http_path TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS goadmin_role_menu (
+	role_id INT NOT NULL,
+	menu_id INT NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS goadmin_role_permissions (
+	role_id INT NOT NULL,
+	permission_id INT NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS goadmin_role_users (
+	role_id INT NOT NULL,
+	user_id INT NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_roles_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_roles (
+	id INT DEFAULT nextval('goadmin_roles_myid_seq') PRIMARY KEY,
+	name VARCHAR NOT NULL,
+	slug VARCHAR NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_session_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_session (
+	id INT DEFAULT nextval('goadmin_session_myid_seq') PRIMARY KEY,
+	sid VARCHAR(50) NOT NULL,
+	"values" VARCHAR(3000) NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS goadmin_user_permissions (
+	user_id INT NOT NULL,
+	permission_id INT NOT NULL,
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+CREATE SEQUENCE IF NOT EXISTS goadmin_users_myid_seq MAXVALUE 99999999;
+
+CREATE TABLE IF NOT EXISTS goadmin_users (
+	id INT DEFAULT nextval('goadmin_users_myid_seq') PRIMARY KEY,
+	username VARCHAR(100) NOT NULL,
+	password VARCHAR(100) NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	avatar VARCHAR(255),
+	remember_token VARCHAR(100),
+	created_at TIMESTAMP DEFAULT now(),
+	updated_at TIMESTAMP DEFAULT now()
+);
+
+INSERT INTO goadmin_menu (id, parent_id, type, "order", title, plugin_name, header, icon, uri, created_at, updated_at) VALUES
+	(1, 0, 1, 2, 'Admin', '', NULL, 'fa-tasks', '', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(2, 1, 1, 2, 'Users', '', NULL, 'fa-users', '/info/manager', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(3, 1, 1, 3, 'Roles', '', NULL, 'fa-user', '/info/roles', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(4, 1, 1, 4, 'Permission', '', NULL, 'fa-ban', '/info/permission', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(5, 1, 1, 5, 'Menu', '', NULL, 'fa-bars', '/menu', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(6, 1, 1, 6, 'Operation log', '', NULL, 'fa-history', '/info/op', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(7, 0, 1, 1, 'Dashboard', '', NULL, 'fa-bar-chart', '/', '2019-09-10 00:00:00', '2019-09-10 00:00:00')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO goadmin_permissions (id, name, slug, http_method, http_path, created_at, updated_at) VALUES
+	(1, 'All permission', '*', '', '*', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(2, 'Dashboard', 'dashboard', 'GET,PUT,POST,DELETE', '/', '2019-09-10 00:00:00', '2019-09-10 00:00:00')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO goadmin_roles (id, name, slug, created_at, updated_at) VALUES
+	(1, 'Administrator', 'administrator', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(2, 'Operator', 'operator', '2019-09-10 00:00:00', '2019-09-10 00:00:00')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO goadmin_users (id, username, password, name, avatar, remember_token, created_at, updated_at) VALUES
+	(1, 'admin', '$2a$10$OxWYJJGTP2gi00l2x06QuOWqw5VR47MQCJ0vNKnbMYfrutij10Hwe', 'admin', '', 'tlNcBVK9AvfYH7WEnwB1RKvocJu8FfRy4um3DJtwdHuJy0dwFsLOgAc0xUfh', '2019-09-10 00:00:00', '2019-09-10 00:00:00'),
+	(2, 'operator', '$2a$10$rVqkOzHjN2MdlEprRflb1eGP0oZXuSrbJLOmJagFsCd81YZm0bsh.', 'Operator', '', NULL, '2019-09-10 00:00:00', '2019-09-10 00:00:00')
+ON CONFLICT DO NOTHING;
+
+-- the link tables have no key to conflict on, they are seeded only while empty
+
+INSERT INTO goadmin_role_menu (role_id, menu_id, created_at, updated_at)
+SELECT * FROM (VALUES
+	(1, 1, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00'),
+	(1, 7, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00'),
+	(2, 7, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00')
+) AS seed
+WHERE NOT EXISTS (SELECT 1 FROM goadmin_role_menu);
+
+INSERT INTO goadmin_role_permissions (role_id, permission_id, created_at, updated_at)
+SELECT * FROM (VALUES
+	(1, 1, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00'),
+	(1, 2, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00'),
+	(2, 2, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00')
+) AS seed
+WHERE NOT EXISTS (SELECT 1 FROM goadmin_role_permissions);
+
+INSERT INTO goadmin_role_users (role_id, user_id, created_at, updated_at)
+SELECT * FROM (VALUES
+	(1, 1, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00'),
+	(2, 2, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00')
+) AS seed
+WHERE NOT EXISTS (SELECT 1 FROM goadmin_role_users);
+
+INSERT INTO goadmin_user_permissions (user_id, permission_id, created_at, updated_at)
+SELECT * FROM (VALUES
+	(1, 1, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00'),
+	(2, 2, TIMESTAMP '2019-09-10 00:00:00', TIMESTAMP '2019-09-10 00:00:00')
+) AS seed
+WHERE NOT EXISTS (SELECT 1 FROM goadmin_user_permissions);
+
+-- the seeded ids were given explicitly, new rows go after them
+
+SELECT setval('goadmin_menu_myid_seq', max(id)) FROM goadmin_menu;
+SELECT setval('goadmin_permissions_myid_seq', max(id)) FROM goadmin_permissions;
+SELECT setval('goadmin_roles_myid_seq', max(id)) FROM goadmin_roles;
+SELECT setval('goadmin_users_myid_seq', max(id)) FROM goadmin_users;
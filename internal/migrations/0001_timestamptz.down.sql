@@ -0,0 +1,3 @@
+ALTER TABLE comments ALTER COLUMN created_at TYPE DATE;
+
+ALTER TABLE posts ALTER COLUMN created_at TYPE DATE;
@@ -0,0 +1,5 @@
+-- dates lost the time of day
+
+ALTER TABLE posts ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE comments ALTER COLUMN created_at TYPE TIMESTAMPTZ;
@@ -0,0 +1,6 @@
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS display_name VARCHAR(64) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS bio TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS avatar_id VARCHAR(260) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS website VARCHAR(260) NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS follows (
+	follower_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	followee_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (follower_id, followee_id),
+	CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followee_idx ON follows (followee_id);
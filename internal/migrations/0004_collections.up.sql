@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS collections (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL,
+	name VARCHAR(64) NOT NULL,
+	is_public BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS collection_posts (
+	collection_id INT NOT NULL REFERENCES collections(id) ON DELETE CASCADE,
+	post_id INT NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (collection_id, post_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_posts_post_idx ON collection_posts (post_id);
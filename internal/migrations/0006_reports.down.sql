@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS reports;
+
+ALTER TABLE comments
+	DROP CONSTRAINT IF EXISTS comments_post_id_fkey,
+	ADD CONSTRAINT comments_post_id_fkey FOREIGN KEY (post_id) REFERENCES posts(id);
+
+ALTER TABLE comments DROP COLUMN IF EXISTS is_hidden;
+
+ALTER TABLE posts DROP COLUMN IF EXISTS is_hidden;
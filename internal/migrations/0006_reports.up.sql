@@ -0,0 +1,26 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS is_hidden BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- moderators delete reported posts along with their comments
+ALTER TABLE comments
+	DROP CONSTRAINT IF EXISTS comments_post_id_fkey,
+	ADD CONSTRAINT comments_post_id_fkey FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE;
+
+CREATE TABLE IF NOT EXISTS reports (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	reporter_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	target_type VARCHAR(16) NOT NULL CHECK (target_type IN ('post', 'comment')),
+	target_id INT NOT NULL,
+	author_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	reason VARCHAR(16) NOT NULL CHECK (reason IN ('spam', 'counterfeit', 'offensive', 'other')),
+	details TEXT NOT NULL DEFAULT '',
+	status VARCHAR(16) NOT NULL DEFAULT 'open',
+	created_at TIMESTAMPTZ NOT NULL,
+	moderator_id INT REFERENCES users(id) ON DELETE SET NULL,
+	resolved_at TIMESTAMPTZ,
+	UNIQUE (reporter_id, target_type, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS reports_target_idx ON reports (target_type, target_id);
+CREATE INDEX IF NOT EXISTS reports_status_idx ON reports (status);
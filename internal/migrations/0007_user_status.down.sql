@@ -0,0 +1,6 @@
+ALTER TABLE users
+	DROP COLUMN IF EXISTS status_changed_at,
+	DROP COLUMN IF EXISTS status_changed_by,
+	DROP COLUMN IF EXISTS status_reason,
+	DROP COLUMN IF EXISTS suspended_until,
+	DROP COLUMN IF EXISTS status;
@@ -0,0 +1,11 @@
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active',
+	ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS status_changed_by INT REFERENCES users(id) ON DELETE SET NULL,
+	ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMPTZ;
+
+-- named, later migrations widen it
+ALTER TABLE users
+	DROP CONSTRAINT IF EXISTS users_status_check,
+	ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'banned'));
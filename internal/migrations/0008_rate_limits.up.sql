@@ -0,0 +1,10 @@
+-- counters of the sign-in lockout and the route limits, losing them on a crash is fine
+
+CREATE UNLOGGED TABLE IF NOT EXISTS rate_limits (
+	key VARCHAR(255) PRIMARY KEY,
+	count INT NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limits_expires_idx ON rate_limits (expires_at);
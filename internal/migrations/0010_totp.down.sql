@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+
+-- the challenges live minutes, the pending sign-ins start over
+DELETE FROM user_tokens WHERE purpose = 'signin_challenge';
+
+ALTER TABLE user_tokens
+	DROP CONSTRAINT IF EXISTS user_tokens_purpose_check,
+	ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('verify_email', 'reset_password'));
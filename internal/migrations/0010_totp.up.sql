@@ -0,0 +1,19 @@
+ALTER TABLE user_tokens
+	DROP CONSTRAINT IF EXISTS user_tokens_purpose_check,
+	ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('verify_email', 'reset_password', 'signin_challenge'));
+
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR(64) NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT false,
+	last_step BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash CHAR(64) NOT NULL,
+	used_at TIMESTAMPTZ,
+	UNIQUE (user_id, code_hash)
+);
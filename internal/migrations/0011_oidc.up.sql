@@ -0,0 +1,22 @@
+-- false for the users signed up through a provider, their password is random
+ALTER TABLE users ADD COLUMN IF NOT EXISTS has_password BOOLEAN NOT NULL DEFAULT true;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider VARCHAR(32) NOT NULL,
+	subject VARCHAR(255) NOT NULL,
+	email VARCHAR(254) NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (provider, subject),
+	UNIQUE (user_id, provider)
+);
+
+CREATE TABLE IF NOT EXISTS oidc_logins (
+	state_hash CHAR(64) PRIMARY KEY,
+	provider VARCHAR(32) NOT NULL,
+	code_verifier VARCHAR(128) NOT NULL,
+	nonce VARCHAR(128) NOT NULL,
+	user_id INT REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMPTZ NOT NULL
+);
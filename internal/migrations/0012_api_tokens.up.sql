@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id INT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name VARCHAR(64) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	prefix VARCHAR(16) NOT NULL,
+	scopes VARCHAR(255) NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	last_used_at TIMESTAMPTZ,
+	expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_tokens_user_id_idx ON api_tokens (user_id);
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS account_deletions;
+
+DELETE FROM user_tokens WHERE purpose = 'delete_account';
+
+ALTER TABLE user_tokens
+	DROP CONSTRAINT IF EXISTS user_tokens_purpose_check,
+	ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('verify_email', 'reset_password', 'signin_challenge'));
+
+-- the deleted accounts are anonymized, they stay locked out as banned
+UPDATE users SET status = 'banned' WHERE status = 'deleted';
+
+ALTER TABLE users
+	DROP CONSTRAINT IF EXISTS users_status_check,
+	ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'banned'));
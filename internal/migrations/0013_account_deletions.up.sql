@@ -0,0 +1,14 @@
+ALTER TABLE users
+	DROP CONSTRAINT IF EXISTS users_status_check,
+	ADD CONSTRAINT users_status_check CHECK (status IN ('active', 'suspended', 'banned', 'deleted'));
+
+-- accounts without a password confirm their deletion with a mailed code
+ALTER TABLE user_tokens
+	DROP CONSTRAINT IF EXISTS user_tokens_purpose_check,
+	ADD CONSTRAINT user_tokens_purpose_check CHECK (purpose IN ('verify_email', 'reset_password', 'signin_challenge', 'delete_account'));
+
+CREATE TABLE IF NOT EXISTS account_deletions (
+	user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	requested_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS comments_post_idx;
+DROP INDEX IF EXISTS post_rates_post_idx;
+DROP INDEX IF EXISTS posts_created_at_idx;
+
+DROP TABLE IF EXISTS post_scores;
@@ -0,0 +1,15 @@
+-- the ranks of the posts, rewritten by the scoring of every server
+
+CREATE TABLE IF NOT EXISTS post_scores (
+	post_id INT PRIMARY KEY REFERENCES posts(id) ON DELETE CASCADE,
+	score INT NOT NULL,
+	hot DOUBLE PRECISION NOT NULL,
+	computed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS post_scores_hot_idx ON post_scores (hot DESC);
+
+-- the scoring counts the rates and comments of the recent posts
+CREATE INDEX IF NOT EXISTS posts_created_at_idx ON posts (created_at);
+CREATE INDEX IF NOT EXISTS post_rates_post_idx ON post_rates (post_id);
+CREATE INDEX IF NOT EXISTS comments_post_idx ON comments (post_id);
@@ -0,0 +1,8 @@
+-- the posts are scored by one server at a time, the one holding the lease
+
+CREATE TABLE IF NOT EXISTS scoring_lease (
+	id INT PRIMARY KEY CHECK (id = 1),
+	locked_until TIMESTAMPTZ
+);
+
+INSERT INTO scoring_lease (id) VALUES (1) ON CONFLICT DO NOTHING;
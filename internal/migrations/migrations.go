@@ -0,0 +1,11 @@
+// Package migrations holds the database schema as numbered migrations,
+// NNNN_name.up.sql with a NNNN_name.down.sql undoing it. 0000 creates the
+// schema from before the migrations, the app tables and the seeded go-admin
+// ones, skipping what a database created back then already has; every later
+// change is a migration of its own.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
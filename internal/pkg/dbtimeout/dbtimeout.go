@@ -0,0 +1,107 @@
+package dbtimeout
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	parentKey = "dbtimeout:parent"
+	cancelKey = "dbtimeout:cancel"
+)
+
+type timeoutKey struct{}
+
+// WithTimeout makes the queries run with ctx wait up to d instead of the
+// default. Zero turns the limit off, e.g. for bulk jobs.
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// plugin gives every query a deadline, so a stuck query can't hold a
+// connection for longer than the request needs it.
+type plugin struct {
+	timeout time.Duration
+}
+
+func New(timeout time.Duration) *plugin {
+	return &plugin{
+		timeout: timeout,
+	}
+}
+
+func (p *plugin) Name() string {
+	return "dbtimeout"
+}
+
+func (p *plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	errs := []error{
+		// create, update and delete get the deadline before their implicit transaction begins
+		cb.Create().Before("gorm:begin_transaction").Register("dbtimeout:before", p.before),
+		cb.Create().After("gorm:commit_or_rollback_transaction").Register("dbtimeout:after", p.after),
+		cb.Update().Before("gorm:begin_transaction").Register("dbtimeout:before", p.before),
+		cb.Update().After("gorm:commit_or_rollback_transaction").Register("dbtimeout:after", p.after),
+		cb.Delete().Before("gorm:begin_transaction").Register("dbtimeout:before", p.before),
+		cb.Delete().After("gorm:commit_or_rollback_transaction").Register("dbtimeout:after", p.after),
+		cb.Query().Before("gorm:query").Register("dbtimeout:before", p.before),
+		cb.Query().After("gorm:after_query").Register("dbtimeout:after", p.after),
+		cb.Raw().Before("gorm:raw").Register("dbtimeout:before", p.before),
+		cb.Raw().After("gorm:raw").Register("dbtimeout:after", p.after),
+		// Row and Rows leave reading the result to the caller, canceling right
+		// after the query would break it, so the deadline is just left to expire
+		cb.Row().Before("gorm:row").Register("dbtimeout:before", p.before),
+		cb.Row().After("gorm:row").Register("dbtimeout:after", p.restore),
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *plugin) before(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := p.timeout
+	if d, ok := ctx.Value(timeoutKey{}).(time.Duration); ok {
+		timeout = d
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	// an earlier deadline of the caller wins anyway
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	db.Statement.Settings.Store(parentKey, ctx)
+	db.Statement.Settings.Store(cancelKey, cancel)
+	db.Statement.Context = timeoutCtx
+}
+
+func (p *plugin) after(db *gorm.DB) {
+	if cancel, ok := db.Statement.Settings.LoadAndDelete(cancelKey); ok {
+		cancel.(context.CancelFunc)()
+	}
+	p.restore(db)
+}
+
+// restore gives the statement its own context back: a chain like
+// tx.Count(...).Find(...) must not run the second query on a spent deadline.
+func (p *plugin) restore(db *gorm.DB) {
+	if parent, ok := db.Statement.Settings.LoadAndDelete(parentKey); ok {
+		db.Statement.Context = parent.(context.Context)
+	}
+	db.Statement.Settings.Delete(cancelKey)
+}
@@ -0,0 +1,62 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+const subscriberBufSize = 16
+
+type bus struct {
+	mu   sync.RWMutex
+	subs map[uint64]map[chan *model.Event]struct{}
+}
+
+func NewBus() *bus {
+	return &bus{
+		subs: make(map[uint64]map[chan *model.Event]struct{}),
+	}
+}
+
+// Publish delivers event to the subscribers of event.PostID in this process.
+// Subscribers that are not keeping up miss the event instead of blocking the publisher.
+func (b *bus) Publish(_ context.Context, event *model.Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for ch := range b.subs[event.PostID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func (b *bus) Subscribe(postId uint64) (<-chan *model.Event, func()) {
+	ch := make(chan *model.Event, subscriberBufSize)
+
+	b.mu.Lock()
+	if b.subs[postId] == nil {
+		b.subs[postId] = make(map[chan *model.Event]struct{})
+	}
+	b.subs[postId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			delete(b.subs[postId], ch)
+			if len(b.subs[postId]) == 0 {
+				delete(b.subs, postId)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
@@ -0,0 +1,119 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+const (
+	notifyChannel    = "post_events"
+	maxNotifyPayload = 8000
+	reconnectDelay   = 3 * time.Second
+)
+
+// pgBroker fans events out to every server through Postgres LISTEN/NOTIFY.
+// An event published on one server reaches the local bus of all servers,
+// including the publishing one, via the notification loop in Listen.
+type pgBroker struct {
+	db    *gorm.DB
+	dsn   string
+	local *bus
+}
+
+func NewPgBroker(db *gorm.DB, dsn string, local *bus) *pgBroker {
+	return &pgBroker{
+		db:    db,
+		dsn:   dsn,
+		local: local,
+	}
+}
+
+// Publish notifies within ctx, so the deadline and the trace of the request
+// publishing the event cover it too.
+func (pb *pgBroker) Publish(ctx context.Context, event *model.Event) {
+	ctx, span := tracing.Start(ctx, "eventbus.Publish")
+	var err error
+	defer func() { tracing.End(span, err) }()
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Ctx(ctx, "eventbus").Error("event marshal", zap.Error(err))
+		return
+	}
+
+	if len(payload) > maxNotifyPayload {
+		logger.Ctx(ctx, "eventbus").Warn("event is too large for NOTIFY, delivering locally", zap.Uint64("post_id", event.PostID))
+		pb.local.Publish(ctx, event)
+		return
+	}
+
+	// a standby can't notify, a SELECT would go to one
+	err = pb.db.WithContext(ctx).Clauses(dbresolver.Write).Exec("SELECT pg_notify(?, ?)", notifyChannel, string(payload)).Error
+	if err != nil {
+		logger.Ctx(ctx, "eventbus").Error("pg_notify", zap.Error(err))
+		pb.local.Publish(ctx, event)
+	}
+}
+
+func (pb *pgBroker) Subscribe(postId uint64) (<-chan *model.Event, func()) {
+	return pb.local.Subscribe(postId)
+}
+
+// Listen blocks until ctx is done, reconnecting to Postgres whenever the
+// listening connection breaks.
+func (pb *pgBroker) Listen(ctx context.Context) {
+	for {
+		err := pb.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Ctx(ctx, "eventbus").Error("event listener", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+func (pb *pgBroker) listen(ctx context.Context) error {
+	conn, err := pgx.Connect(ctx, pb.dsn)
+	if err != nil {
+		return errors.Wrap(err, "pgx connect error")
+	}
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "LISTEN "+notifyChannel)
+	if err != nil {
+		return errors.Wrap(err, "pgx listen error")
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return errors.Wrap(err, "pgx wait error")
+		}
+
+		var event model.Event
+		err = json.Unmarshal([]byte(notification.Payload), &event)
+		if err != nil {
+			logger.Ctx(ctx, "eventbus").Error("event unmarshal", zap.Error(err))
+			continue
+		}
+
+		pb.local.Publish(ctx, &event)
+	}
+}
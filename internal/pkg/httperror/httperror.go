@@ -1,28 +1,193 @@
 package httperror
 
 import (
+	"context"
 	"net/http"
+	"strings"
 
-	"github.com/ell1jah/bmstu_web/model"
-	"github.com/labstack/echo"
+	"github.com/asaskevich/govalidator"
+	"github.com/labstack/echo/v4"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/model"
 )
 
-// TODO удалить
-func HandleError(err error) *echo.HTTPError {
-	causeErr := errors.Cause(err)
-	switch {
-	case errors.Is(causeErr, model.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, model.ErrNotFound.Error())
-	case errors.Is(causeErr, model.ErrBadRequest):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
-	case errors.Is(causeErr, model.ErrPermissionDenied):
-		return echo.NewHTTPError(http.StatusForbidden, model.ErrPermissionDenied.Error())
-	case errors.Is(causeErr, model.ErrInvalidPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrInvalidPassword.Error())
-	case errors.Is(causeErr, model.ErrConflictPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrConflictPassword.Error())
-	default:
-		return echo.NewHTTPError(http.StatusInternalServerError, causeErr.Error())
+const MIMEProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem document. Code is stable and meant for
+// programs, Title and Detail are for people and may change.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type kind struct {
+	err    error
+	status int
+	code   string
+	// the whole error text is written for the client, not only the model error
+	public bool
+}
+
+var kinds = []kind{
+	{model.ErrNotFound, http.StatusNotFound, "not_found", false},
+	{model.ErrBadRequest, http.StatusBadRequest, "bad_request", false},
+	{model.ErrUnauthorized, http.StatusUnauthorized, "unauthorized", false},
+	{model.ErrPermissionDenied, http.StatusForbidden, "permission_denied", false},
+	{model.ErrEmptyCsrf, http.StatusForbidden, "csrf_missing", false},
+	{model.ErrInvalidCsrf, http.StatusForbidden, "csrf_invalid", false},
+	{model.ErrInvalidPassword, http.StatusBadRequest, "invalid_password", false},
+	{model.ErrConflictPassword, http.StatusBadRequest, "password_unchanged", false},
+	{model.ErrWeakPassword, http.StatusBadRequest, "weak_password", true},
+	{model.ErrInvalidToken, http.StatusBadRequest, "invalid_token", false},
+	{model.ErrInvalidCode, http.StatusUnauthorized, "invalid_code", false},
+	{model.ErrUserSuspended, http.StatusForbidden, "user_suspended", false},
+	{model.ErrUserBanned, http.StatusForbidden, "user_banned", false},
+	{model.ErrUserDeleted, http.StatusForbidden, "user_deleted", false},
+	{model.ErrConflictNickname, http.StatusConflict, "nickname_taken", false},
+	{model.ErrConflictEmail, http.StatusConflict, "email_taken", false},
+	{model.ErrConflictFriend, http.StatusConflict, "already_following", false},
+	{model.ErrConflictReport, http.StatusConflict, "already_reported", false},
+	{model.ErrConflictTwoFactor, http.StatusConflict, "two_factor_enabled", false},
+	{model.ErrConflictIdentity, http.StatusConflict, "identity_taken", false},
+	{model.ErrTooManyRequests, http.StatusTooManyRequests, "too_many_requests", false},
+	{model.ErrInternalServerError, http.StatusInternalServerError, "internal_error", false},
+	// a query ran out of its deadline
+	{context.DeadlineExceeded, http.StatusServiceUnavailable, "timeout", false},
+}
+
+// NewHandler returns the echo error handler writing every error as a
+// problem document. Unexpected errors are logged and only with debug
+// their text reaches the client.
+func NewHandler(debug bool) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		problem := toProblem(err, debug)
+		problem.Instance = c.Request().URL.Path
+		problem.RequestID = c.Response().Header().Get(echo.HeaderXRequestID)
+
+		if problem.Status >= http.StatusInternalServerError {
+			logger.Ctx(c.Request().Context(), "http").Error("request failed", zap.Error(err))
+		}
+
+		c.Response().Header().Set(echo.HeaderContentType, MIMEProblemJSON)
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(problem.Status)
+		} else {
+			err = c.JSON(problem.Status, problem)
+		}
+		if err != nil {
+			logger.Ctx(c.Request().Context(), "http").Error("problem response", zap.Error(err))
+		}
+	}
+}
+
+func toProblem(err error, debug bool) *Problem {
+	var validationErrs govalidator.Errors
+	if errors.As(err, &validationErrs) {
+		problem := newProblem(http.StatusBadRequest, "validation_failed")
+		problem.Detail = "request fields are invalid"
+		problem.Errors = fieldErrors(validationErrs)
+		return problem
+	}
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fromHTTPError(httpErr, debug)
+	}
+
+	for _, k := range kinds {
+		if errors.Is(err, k.err) {
+			problem := newProblem(k.status, k.code)
+			problem.Detail = k.err.Error()
+			if k.public {
+				problem.Detail = err.Error()
+			}
+			return problem
+		}
+	}
+
+	problem := newProblem(http.StatusInternalServerError, "internal_error")
+	if debug {
+		problem.Detail = err.Error()
 	}
+	return problem
+}
+
+// fromHTTPError handles the errors of echo itself and its middleware,
+// like an unknown route or a malformed body.
+func fromHTTPError(httpErr *echo.HTTPError, debug bool) *Problem {
+	problem := newProblem(httpErr.Code, statusCode(httpErr.Code))
+
+	message, ok := httpErr.Message.(string)
+	if ok && (httpErr.Code < http.StatusInternalServerError || debug) {
+		problem.Detail = message
+	}
+	if debug && httpErr.Internal != nil {
+		problem.Detail += ": " + httpErr.Internal.Error()
+	}
+
+	return problem
+}
+
+func newProblem(status int, code string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+	}
+}
+
+// statusCode makes a code like "method_not_allowed" from the status text.
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "http_error"
+	}
+
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text))
+}
+
+// fieldErrors doesn't repeat the rejected values: they may be passwords.
+func fieldErrors(errs govalidator.Errors) []FieldError {
+	var fields []FieldError
+	for _, err := range errs.Errors() {
+		switch e := err.(type) {
+		case govalidator.Errors:
+			fields = append(fields, fieldErrors(e)...)
+		case govalidator.Error:
+			message := "is required"
+			if e.CustomErrorMessageExists {
+				message = e.Err.Error()
+			} else if e.Validator != "" && e.Validator != "required" {
+				message = "does not validate as " + e.Validator
+			}
+
+			fields = append(fields, FieldError{
+				Field:   strings.Join(append(e.Path, e.Name), "."),
+				Message: message,
+			})
+		default:
+			fields = append(fields, FieldError{Message: err.Error()})
+		}
+	}
+
+	return fields
 }
@@ -11,12 +11,14 @@ import (
 type UserClaims struct {
 	ID    uint64 `json:"id"`
 	Login string `json:"login"`
+	Role  string `json:"role"`
 }
 
 func FromModelUsertoUserClaims(user *model.User) *UserClaims {
 	return &UserClaims{
 		ID:    user.ID,
 		Login: user.Login,
+		Role:  user.Role,
 	}
 }
 
@@ -26,32 +28,61 @@ type Claims struct {
 }
 
 type jwtSessionsManager struct {
-	key    []byte
-	method jwt.SigningMethod
+	keys     *keySet
+	issuer   string
+	audience string
+	ttl      time.Duration
+	parser   *jwt.Parser
 }
 
-func NewJWTSessionsManager(key []byte, method jwt.SigningMethod) *jwtSessionsManager {
+func NewJWTSessionsManager(keys *keySet, issuer, audience string, ttl time.Duration) *jwtSessionsManager {
 	return &jwtSessionsManager{
-		key:    key,
-		method: method,
+		keys:     keys,
+		issuer:   issuer,
+		audience: audience,
+		ttl:      ttl,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(keys.Methods()),
+			jwt.WithIssuer(issuer),
+			jwt.WithAudience(audience),
+		),
 	}
 }
 
 func (jsm *jwtSessionsManager) CreateSession(user *UserClaims) (string, error) {
+	now := time.Now()
 	claims := Claims{
 		*user,
 		jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 72)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    jsm.issuer,
+			Audience:  jwt.ClaimStrings{jsm.audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(jsm.ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jsm.method, claims)
+	token := jwt.NewWithClaims(jsm.keys.signing.method, claims)
+	token.Header["kid"] = jsm.keys.signing.kid
 
-	tokenString, err := token.SignedString(jsm.key)
+	tokenString, err := token.SignedString(jsm.keys.signing.private)
 	if err != nil {
 		return "", errors.Wrap(err, "jwt error")
 	}
 
 	return tokenString, nil
 }
+
+// ParseSession verifies the signature, issuer, audience and expiry of a session token.
+func (jsm *jwtSessionsManager) ParseSession(tokenString string) (*jwt.Token, error) {
+	token, err := jsm.parser.ParseWithClaims(tokenString, new(Claims), jsm.keys.Keyfunc)
+	if err != nil {
+		return nil, errors.Wrap(err, "jwt error")
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.ExpiresAt == nil {
+		return nil, errors.New("jwt without expiry")
+	}
+
+	return token, nil
+}
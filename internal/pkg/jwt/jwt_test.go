@@ -0,0 +1,164 @@
+package jwt
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "cloth"
+	testAudience = "cloth-api"
+)
+
+func newManager(t *testing.T, dir, activeKid string) *jwtSessionsManager {
+	t.Helper()
+
+	ks, err := LoadKeySet(dir, activeKid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewJWTSessionsManager(ks, testIssuer, testAudience, time.Hour)
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	writePrivate(t, dir, "ed", newEd25519Key(t))
+
+	jsm := newManager(t, dir, "ed")
+	tokenString, err := jsm.CreateSession(&UserClaims{ID: 7, Login: "alice_login", Role: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jsm.ParseSession(tokenString)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := token.Claims.(*Claims)
+	if claims.User.ID != 7 || claims.User.Login != "alice_login" || token.Header["kid"] != "ed" {
+		t.Fatalf("claims = %+v, header = %v", claims, token.Header)
+	}
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	old, next := newEd25519Key(t), newRSAKey(t)
+	writePrivate(t, dir, "old", old)
+
+	oldToken, err := newManager(t, dir, "old").CreateSession(&UserClaims{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key is added and made active, the old one is retired
+	writePrivate(t, dir, "next", next)
+	err = os.Remove(filepath.Join(dir, "old"+privateKeySuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePublic(t, dir, "old", old)
+
+	jsm := newManager(t, dir, "next")
+	newToken, err := jsm.CreateSession(&UserClaims{ID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := jsm.ParseSession(newToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "next" || token.Method.Alg() != "RS256" {
+		t.Fatalf("signed with %v %s, want next RS256", token.Header["kid"], token.Method.Alg())
+	}
+
+	_, err = jsm.ParseSession(oldToken)
+	if err != nil {
+		t.Fatalf("token of the retired key: %v", err)
+	}
+
+	// and removed once its tokens have expired
+	err = os.Remove(filepath.Join(dir, "old"+publicKeySuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newManager(t, dir, "next").ParseSession(oldToken)
+	if err == nil {
+		t.Fatal("token of the removed key accepted")
+	}
+}
+
+func TestParseSessionRejects(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey := newRSAKey(t)
+	writePrivate(t, dir, "ed", newEd25519Key(t))
+	writePrivate(t, dir, "rsa", rsaKey)
+
+	jsm := newManager(t, dir, "ed")
+	ed := jsm.keys.keys["ed"]
+
+	claims := func(change func(c *Claims)) *Claims {
+		c := &Claims{
+			User: UserClaims{ID: 1},
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    testIssuer,
+				Audience:  jwt.ClaimStrings{testAudience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	sign := func(method jwt.SigningMethod, kid string, c *Claims, key interface{}) string {
+		token := jwt.NewWithClaims(method, c)
+		token.Header["kid"] = kid
+
+		tokenString, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenString
+	}
+
+	// what an attacker has of the key, the PEM served to verify tokens
+	der, err := x509.MarshalPKIXPublicKey(rsaKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPublic := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	tests := map[string]string{
+		"wrong issuer": sign(ed.method, "ed", claims(func(c *Claims) { c.Issuer = "other" }), ed.private),
+		"no issuer":    sign(ed.method, "ed", claims(func(c *Claims) { c.Issuer = "" }), ed.private),
+		"wrong audience": sign(ed.method, "ed",
+			claims(func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }), ed.private),
+		"expired": sign(ed.method, "ed",
+			claims(func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }), ed.private),
+		"no expiry":   sign(ed.method, "ed", claims(func(c *Claims) { c.ExpiresAt = nil }), ed.private),
+		"unknown kid": sign(ed.method, "missing", claims(nil), ed.private),
+		"no kid":      sign(ed.method, "", claims(nil), ed.private),
+		// the key is verified with the algorithm it is for, not the one the token names
+		"other key's alg":          sign(jwt.SigningMethodRS256, "ed", claims(nil), rsaKey),
+		"HMAC with the public key": sign(jwt.SigningMethodHS256, "rsa", claims(nil), rsaPublic),
+		"alg none":                 sign(jwt.SigningMethodNone, "ed", claims(nil), jwt.UnsafeAllowNoneSignatureType),
+		"forged signature":         sign(ed.method, "ed", claims(nil), newEd25519Key(t)),
+	}
+
+	for name, tokenString := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := jsm.ParseSession(tokenString)
+			if err == nil {
+				t.Fatal("token accepted")
+			}
+		})
+	}
+}
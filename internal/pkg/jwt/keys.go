@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pkg/errors"
+)
+
+const (
+	privateKeySuffix = ".pem"
+	publicKeySuffix  = ".pub.pem"
+)
+
+type key struct {
+	kid    string
+	method jwt.SigningMethod
+	public crypto.PublicKey
+	// nil for retired keys which only verify tokens issued before
+	private crypto.Signer
+}
+
+// JWK is a public key in the JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type keySet struct {
+	signing *key
+	keys    map[string]*key
+}
+
+// LoadKeySet reads the keys from dir: <kid>.pem holds a PKCS #8 RSA or
+// Ed25519 private key, <kid>.pub.pem a PKIX public key of a retired one.
+// Tokens are signed with activeKid and verified with any key in dir, so a key
+// is rotated by adding a new one, making it active, and removing the old one
+// once the tokens signed with it have expired.
+func LoadKeySet(dir, activeKid string) (*keySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+privateKeySuffix))
+	if err != nil {
+		return nil, errors.Wrap(err, "key dir")
+	}
+
+	ks := &keySet{
+		keys: make(map[string]*key),
+	}
+
+	for _, path := range paths {
+		k, err := loadKey(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "key %s", path)
+		}
+
+		if _, ok := ks.keys[k.kid]; ok {
+			return nil, errors.Errorf("duplicate key id %q", k.kid)
+		}
+		ks.keys[k.kid] = k
+	}
+
+	active, ok := ks.keys[activeKid]
+	if !ok || active.private == nil {
+		return nil, errors.Errorf("no private key %q in %s", activeKid, dir)
+	}
+	ks.signing = active
+
+	return ks, nil
+}
+
+// Keyfunc picks the verification key by the kid header and checks the
+// algorithm is the one of that key.
+func (ks *keySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.Errorf("unknown key id %q", kid)
+	}
+
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, errors.Errorf("key %q doesn't sign with %s", kid, token.Method.Alg())
+	}
+
+	return k.public, nil
+}
+
+func (ks *keySet) Methods() []string {
+	methods := make(map[string]struct{})
+	for _, k := range ks.keys {
+		methods[k.method.Alg()] = struct{}{}
+	}
+
+	algs := make([]string, 0, len(methods))
+	for alg := range methods {
+		algs = append(algs, alg)
+	}
+
+	return algs
+}
+
+func (ks *keySet) JWKS() *JWKS {
+	set := &JWKS{
+		Keys: make([]JWK, 0, len(ks.keys)),
+	}
+
+	for _, k := range ks.keys {
+		jwk := JWK{
+			Kid: k.kid,
+			Use: "sig",
+			Alg: k.method.Alg(),
+		}
+
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	name := filepath.Base(path)
+	k := &key{}
+
+	if strings.HasSuffix(name, publicKeySuffix) {
+		k.kid = strings.TrimSuffix(name, publicKeySuffix)
+		k.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		k.kid = strings.TrimSuffix(name, privateKeySuffix)
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("key can't sign")
+		}
+		k.private = signer
+		k.public = signer.Public()
+	}
+
+	switch k.public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return k, nil
+}
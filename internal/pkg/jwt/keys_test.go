@@ -0,0 +1,194 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private
+}
+
+// writePrivate writes the key as dir/<kid>.pem.
+func writePrivate(t *testing.T, dir, kid string, private crypto.Signer) {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, kid+privateKeySuffix), "PRIVATE KEY", der)
+}
+
+// writePublic writes the public part of the key as dir/<kid>.pub.pem, which is how a key is retired.
+func writePublic(t *testing.T, dir, kid string, private crypto.Signer) {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, filepath.Join(dir, kid+publicKeySuffix), "PUBLIC KEY", der)
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, edKey := newRSAKey(t), newEd25519Key(t)
+	writePrivate(t, dir, "rsa", rsaKey)
+	writePrivate(t, dir, "ed", edKey)
+	writePublic(t, dir, "retired", newEd25519Key(t))
+
+	ks, err := LoadKeySet(dir, "ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ks.signing.kid != "ed" || ks.signing.method.Alg() != "EdDSA" {
+		t.Fatalf("signing with %s %s, want ed EdDSA", ks.signing.kid, ks.signing.method.Alg())
+	}
+	if ks.keys["rsa"].method.Alg() != "RS256" || ks.keys["retired"].private != nil {
+		t.Fatal("keys loaded wrong")
+	}
+	if len(ks.Methods()) != 2 {
+		t.Fatalf("methods = %v, want RS256 and EdDSA", ks.Methods())
+	}
+
+	// a retired key only verifies
+	_, err = LoadKeySet(dir, "retired")
+	if err == nil {
+		t.Fatal("retired key made active")
+	}
+
+	_, err = LoadKeySet(dir, "missing")
+	if err == nil {
+		t.Fatal("missing key made active")
+	}
+}
+
+func TestLoadKeySetRejects(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, dir string)
+	}{
+		{"no PEM", func(t *testing.T, dir string) {
+			err := os.WriteFile(filepath.Join(dir, "bad.pem"), []byte("not a key"), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"not PKCS #8", func(t *testing.T, dir string) {
+			writePEM(t, filepath.Join(dir, "bad.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(newRSAKey(t)))
+		}},
+		{"unsupported key", func(t *testing.T, dir string) {
+			writePrivate(t, dir, "bad", ecKey)
+		}},
+		{"duplicate key id", func(t *testing.T, dir string) {
+			writePublic(t, dir, "active", newEd25519Key(t))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePrivate(t, dir, "active", newEd25519Key(t))
+			tt.write(t, dir)
+
+			_, err := LoadKeySet(dir, "active")
+			if err == nil {
+				t.Fatal("key set loaded")
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, edKey, retired := newRSAKey(t), newEd25519Key(t), newEd25519Key(t)
+	writePrivate(t, dir, "rsa", rsaKey)
+	writePrivate(t, dir, "ed", edKey)
+	writePublic(t, dir, "retired", retired)
+
+	ks, err := LoadKeySet(dir, "ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// retired keys are published while the tokens they signed live
+	keys := ks.JWKS().Keys
+	if len(keys) != 3 {
+		t.Fatalf("%d keys published, want 3", len(keys))
+	}
+
+	for _, jwk := range keys {
+		if jwk.Use != "sig" {
+			t.Fatalf("key %s use = %q", jwk.Kid, jwk.Use)
+		}
+
+		switch jwk.Kid {
+		case "rsa":
+			n, e := new(big.Int).SetBytes(decode(jwk.N)), new(big.Int).SetBytes(decode(jwk.E))
+			if jwk.Kty != "RSA" || jwk.Alg != "RS256" || n.Cmp(rsaKey.N) != 0 || int(e.Int64()) != rsaKey.E {
+				t.Fatalf("rsa key = %+v", jwk)
+			}
+		case "ed", "retired":
+			want := edKey.Public().(ed25519.PublicKey)
+			if jwk.Kid == "retired" {
+				want = retired.Public().(ed25519.PublicKey)
+			}
+			if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.Alg != "EdDSA" || !want.Equal(ed25519.PublicKey(decode(jwk.X))) {
+				t.Fatalf("%s key = %+v", jwk.Kid, jwk)
+			}
+		default:
+			t.Fatalf("unknown key %q published", jwk.Kid)
+		}
+	}
+}
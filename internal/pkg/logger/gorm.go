@@ -0,0 +1,107 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// gormPkg is the package name queries are logged under, at debug level
+// every query is.
+const gormPkg = "db"
+
+const thisPkg = "github.com/ell1jah/bmstu_web/internal/pkg/logger."
+
+type gormAdapter struct {
+	slowQuery time.Duration
+}
+
+// NewGormLogger returns the gorm logger writing through Ctx, so queries
+// are logged with the fields of the request making them. Failed queries
+// are errors, the ones taking longer than slowQuery warnings.
+func NewGormLogger(slowQuery time.Duration) gormLogger.Interface {
+	return &gormAdapter{
+		slowQuery: slowQuery,
+	}
+}
+
+// LogMode is ignored, the level of the "db" package is set in Config.
+func (ga *gormAdapter) LogMode(gormLogger.LogLevel) gormLogger.Interface {
+	return ga
+}
+
+func (ga *gormAdapter) Info(ctx context.Context, msg string, args ...interface{}) {
+	ga.logger(ctx).Info(fmt.Sprintf(msg, args...), zap.String("caller", queryCaller()))
+}
+
+func (ga *gormAdapter) Warn(ctx context.Context, msg string, args ...interface{}) {
+	ga.logger(ctx).Warn(fmt.Sprintf(msg, args...), zap.String("caller", queryCaller()))
+}
+
+func (ga *gormAdapter) Error(ctx context.Context, msg string, args ...interface{}) {
+	ga.logger(ctx).Error(fmt.Sprintf(msg, args...), zap.String("caller", queryCaller()))
+}
+
+func (ga *gormAdapter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l := ga.logger(ctx)
+	elapsed := time.Since(begin)
+
+	// the query text is only made if it is going to be written
+	fields := func(extra ...zap.Field) []zap.Field {
+		sql, rows := fc()
+		return append([]zap.Field{
+			zap.String("caller", queryCaller()),
+			zap.String("sql", sql),
+			zap.Int64("rows", rows),
+			zap.Duration("elapsed", elapsed),
+		}, extra...)
+	}
+
+	switch {
+	// not found is an answer, not a failure
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		if ce := l.Check(zap.ErrorLevel, "query failed"); ce != nil {
+			ce.Write(fields(zap.Error(err))...)
+		}
+	case ga.slowQuery > 0 && elapsed > ga.slowQuery:
+		if ce := l.Check(zap.WarnLevel, "slow query"); ce != nil {
+			ce.Write(fields()...)
+		}
+	default:
+		if ce := l.Check(zap.DebugLevel, "query"); ce != nil {
+			ce.Write(fields()...)
+		}
+	}
+}
+
+// logger leaves the caller to queryCaller, the one of the adapter is
+// somewhere in gorm.
+func (ga *gormAdapter) logger(ctx context.Context) *zap.Logger {
+	return Ctx(ctx, gormPkg).WithOptions(zap.WithCaller(false))
+}
+
+// queryCaller returns the file:line of the code which made the query,
+// usually a repository.
+func queryCaller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "gorm.io/") && !strings.HasPrefix(frame.Function, thisPkg) {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// Package logger writes JSON log lines with the fields of the request
+// being served. The middleware puts a logger with the request id and route
+// into the request context, the layers below log through Ctx with that
+// context, so every line of a request can be found by its id.
+//
+// Each package logs under its own name, and its level can be set apart
+// from the rest, e.g. "info,db=debug,replica=warn".
+package logger
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type Config struct {
+	// of the packages not in Packages
+	Level    zapcore.Level
+	Packages map[string]zapcore.Level
+	// os.Stdout if nil
+	Output io.Writer
+}
+
+type state struct {
+	// at the lowest level of cfg, Ctx raises it to the package's one
+	root *zap.Logger
+	cfg  Config
+}
+
+var current atomic.Pointer[state]
+
+func init() {
+	current.Store(newState(Config{Level: zapcore.InfoLevel}))
+}
+
+// Init makes every logger, the ones already in contexts too, log with cfg.
+func Init(cfg Config) {
+	current.Store(newState(cfg))
+}
+
+func newState(cfg Config) *state {
+	lowest := cfg.Level
+	for _, level := range cfg.Packages {
+		if level < lowest {
+			lowest = level
+		}
+	}
+
+	encoderCfg := zap.NewProductionEncoderConfig()
+	encoderCfg.TimeKey = "time"
+	encoderCfg.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+
+	out := cfg.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderCfg), zapcore.Lock(zapcore.AddSync(out)), lowest)
+
+	return &state{
+		root: zap.New(core, zap.AddCaller()),
+		cfg:  cfg,
+	}
+}
+
+// ParseConfig reads the "<level>,<package>=<level>,..." form, the first
+// level being that of all the packages not named.
+func ParseConfig(s string) (Config, error) {
+	cfg := Config{
+		Level:    zapcore.InfoLevel,
+		Packages: make(map[string]zapcore.Level),
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pkg, levelText, named := strings.Cut(part, "=")
+		if !named {
+			levelText = pkg
+		}
+
+		level, err := zapcore.ParseLevel(levelText)
+		if err != nil {
+			return Config{}, errors.Wrapf(err, "log level of %q", part)
+		}
+
+		if named {
+			cfg.Packages[pkg] = level
+		} else {
+			cfg.Level = level
+		}
+	}
+
+	return cfg, nil
+}
+
+type ctxKey struct{}
+
+// fields are kept instead of a logger, so the loggers made before Init
+// follow it as well.
+type ctxFields struct {
+	fields []zap.Field
+}
+
+// WithFields returns ctx whose log lines have fields added to the ones
+// already there.
+func WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	var all []zap.Field
+	if parent, ok := ctx.Value(ctxKey{}).(*ctxFields); ok {
+		all = append(all, parent.fields...)
+	}
+	all = append(all, fields...)
+
+	return context.WithValue(ctx, ctxKey{}, &ctxFields{fields: all})
+}
+
+// Ctx returns the logger of pkg with the fields of ctx.
+func Ctx(ctx context.Context, pkg string) *zap.Logger {
+	st := current.Load()
+
+	level, ok := st.cfg.Packages[pkg]
+	if !ok {
+		level = st.cfg.Level
+	}
+
+	l := st.root.Named(pkg).WithOptions(zap.IncreaseLevel(level))
+	if ctxFields, ok := ctx.Value(ctxKey{}).(*ctxFields); ok {
+		l = l.With(ctxFields.fields...)
+	}
+
+	return l
+}
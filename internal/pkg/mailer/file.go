@@ -0,0 +1,45 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+)
+
+// fileMailer writes every mail to a separate .eml file in dir instead of
+// sending it, for local development.
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *fileMailer {
+	return &fileMailer{
+		dir:  dir,
+		from: from,
+	}
+}
+
+func (fm *fileMailer) Send(to, subject, body string) error {
+	err := os.MkdirAll(fm.dir, 0o755)
+	if err != nil {
+		return errors.Wrap(err, "mail dir error")
+	}
+
+	path := filepath.Join(fm.dir, strconv.FormatInt(time.Now().UnixNano(), 10)+".eml")
+	err = os.WriteFile(path, buildMessage(fm.from, to, subject, body), 0o644)
+	if err != nil {
+		return errors.Wrap(err, "mail file error")
+	}
+
+	logger.Ctx(context.Background(), "mailer").Info("mail saved", zap.String("subject", subject), zap.String("to", to), zap.String("path", path))
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *smtpMailer {
+	return &smtpMailer{
+		cfg: cfg,
+	}
+}
+
+func (sm *smtpMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if sm.cfg.Username != "" {
+		auth = smtp.PlainAuth("", sm.cfg.Username, sm.cfg.Password, sm.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(sm.cfg.Host, strconv.Itoa(sm.cfg.Port))
+	err := smtp.SendMail(addr, auth, sm.cfg.From, []string{to}, buildMessage(sm.cfg.From, to, subject, body))
+	if err != nil {
+		return errors.Wrap(err, "smtp error")
+	}
+
+	return nil
+}
+
+func buildMessage(from, to, subject, body string) []byte {
+	var msg bytes.Buffer
+
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(body)
+
+	return msg.Bytes()
+}
@@ -0,0 +1,230 @@
+// Package memdb keeps the tables of the schema in memory. The memory
+// repositories share one DB the way the Postgres ones share the database,
+// so a post sees the status of its author and a deleted post takes its
+// comments and rates along. Nothing is persisted, it's for tests and
+// local runs without Postgres.
+package memdb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type UserToken struct {
+	model.UserToken
+	Used bool
+}
+
+type RecoveryCode struct {
+	UserID   uint64
+	CodeHash string
+	Used     bool
+}
+
+type AccountDeletion struct {
+	UserID      uint64
+	RequestedAt time.Time
+	LockedUntil time.Time
+}
+
+type Rate struct {
+	UserID uint64
+	PostID uint64
+	Rate   model.Rate
+}
+
+type Follow struct {
+	FollowerID uint64
+	FolloweeID uint64
+	CreatedAt  time.Time
+}
+
+type CollectionPost struct {
+	CollectionID uint64
+	PostID       uint64
+	CreatedAt    time.Time
+}
+
+// tables hold the rows in the order they were inserted, which is the id order.
+type tables struct {
+	ids map[string]uint64
+
+	Users            []*model.User
+	UserTokens       []*UserToken
+	UserTOTPs        []*model.UserTOTP
+	RecoveryCodes    []*RecoveryCode
+	UserIdentities   []*model.UserIdentity
+	OIDCLogins       []*model.OIDCLogin
+	APITokens        []*model.APIToken
+	AccountDeletions []*AccountDeletion
+	Posts            []*model.Post
+	PostScores       []*model.PostScore
+	ScoringLease     time.Time
+	Rates            []*Rate
+	Comments         []*model.Comment
+	Follows          []*Follow
+	Collections      []*model.Collection
+	CollectionPosts  []*CollectionPost
+	Reports          []*model.Report
+}
+
+func (t *tables) clone() tables {
+	ids := make(map[string]uint64, len(t.ids))
+	for table, id := range t.ids {
+		ids[table] = id
+	}
+
+	return tables{
+		ids:              ids,
+		Users:            cloneRows(t.Users),
+		UserTokens:       cloneRows(t.UserTokens),
+		UserTOTPs:        cloneRows(t.UserTOTPs),
+		RecoveryCodes:    cloneRows(t.RecoveryCodes),
+		UserIdentities:   cloneRows(t.UserIdentities),
+		OIDCLogins:       cloneRows(t.OIDCLogins),
+		APITokens:        cloneRows(t.APITokens),
+		AccountDeletions: cloneRows(t.AccountDeletions),
+		Posts:            cloneRows(t.Posts),
+		PostScores:       cloneRows(t.PostScores),
+		ScoringLease:     t.ScoringLease,
+		Rates:            cloneRows(t.Rates),
+		Comments:         cloneRows(t.Comments),
+		Follows:          cloneRows(t.Follows),
+		Collections:      cloneRows(t.Collections),
+		CollectionPosts:  cloneRows(t.CollectionPosts),
+		Reports:          cloneRows(t.Reports),
+	}
+}
+
+type txKey struct{}
+
+// DB is locked by the repositories for every call, the tables are only
+// touched under the lock.
+type DB struct {
+	mu sync.Mutex
+	tables
+	// held through a transaction
+	txMu sync.Mutex
+}
+
+func New() *DB {
+	return &DB{
+		tables: tables{
+			ids: make(map[string]uint64),
+		},
+	}
+}
+
+func (db *DB) Lock() {
+	db.mu.Lock()
+}
+
+func (db *DB) Unlock() {
+	db.mu.Unlock()
+}
+
+// NextID returns the next id of table, starting from 1 like an identity column.
+func (db *DB) NextID(table string) uint64 {
+	db.ids[table]++
+	return db.ids[table]
+}
+
+// Do runs fn in a transaction, the tables are put back as they were before
+// it if fn fails or panics. Transactions run one at a time, so they are
+// never retried, but a rollback also takes back what was written outside
+// of them meanwhile. Inside another Do, fn just joins the outer transaction.
+func (db *DB) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(txKey{}) != nil {
+		return fn(ctx)
+	}
+
+	db.txMu.Lock()
+	defer db.txMu.Unlock()
+
+	db.mu.Lock()
+	snapshot := db.tables.clone()
+	db.mu.Unlock()
+
+	committed := false
+	defer func() {
+		if !committed {
+			db.mu.Lock()
+			db.tables = snapshot
+			db.mu.Unlock()
+		}
+	}()
+
+	err := fn(context.WithValue(ctx, txKey{}, true))
+	if err != nil {
+		return err
+	}
+
+	committed = true
+	return nil
+}
+
+// Find returns the first row matching, or nil.
+func Find[T any](rows []*T, match func(row *T) bool) *T {
+	for _, row := range rows {
+		if match(row) {
+			return row
+		}
+	}
+
+	return nil
+}
+
+// Filter returns the rows matching in table order.
+func Filter[T any](rows []*T, match func(row *T) bool) []*T {
+	var matched []*T
+	for _, row := range rows {
+		if match(row) {
+			matched = append(matched, row)
+		}
+	}
+
+	return matched
+}
+
+// Delete removes the rows matching from rows and returns their number.
+func Delete[T any](rows *[]*T, match func(row *T) bool) int {
+	kept := (*rows)[:0]
+	for _, row := range *rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+
+	deleted := len(*rows) - len(kept)
+	for i := len(kept); i < len(*rows); i++ {
+		(*rows)[i] = nil
+	}
+	*rows = kept
+
+	return deleted
+}
+
+// Count returns the number of rows matching.
+func Count[T any](rows []*T, match func(row *T) bool) int {
+	cnt := 0
+	for _, row := range rows {
+		if match(row) {
+			cnt++
+		}
+	}
+
+	return cnt
+}
+
+func cloneRows[T any](rows []*T) []*T {
+	cloned := make([]*T, len(rows))
+	for i, row := range rows {
+		copied := *row
+		cloned[i] = &copied
+	}
+
+	return cloned
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"runtime"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	startKey = "metrics:start"
+
+	modulePkg = "github.com/ell1jah/bmstu_web/internal/"
+	thisPkg   = modulePkg + "pkg/metrics."
+)
+
+// gormPlugin times every query into QueryDuration, labeled with the
+// repository method that ran it, e.g. post.GetPostsWithParams.
+type gormPlugin struct {
+}
+
+func NewGormPlugin() *gormPlugin {
+	return &gormPlugin{}
+}
+
+func (p *gormPlugin) Name() string {
+	return "metrics"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	errs := []error{
+		cb.Create().Before("gorm:begin_transaction").Register("metrics:before", p.before),
+		cb.Create().After("gorm:commit_or_rollback_transaction").Register("metrics:after", p.after),
+		cb.Update().Before("gorm:begin_transaction").Register("metrics:before", p.before),
+		cb.Update().After("gorm:commit_or_rollback_transaction").Register("metrics:after", p.after),
+		cb.Delete().Before("gorm:begin_transaction").Register("metrics:before", p.before),
+		cb.Delete().After("gorm:commit_or_rollback_transaction").Register("metrics:after", p.after),
+		cb.Query().Before("gorm:query").Register("metrics:before", p.before),
+		cb.Query().After("gorm:after_query").Register("metrics:after", p.after),
+		cb.Raw().Before("gorm:raw").Register("metrics:before", p.before),
+		cb.Raw().After("gorm:raw").Register("metrics:after", p.after),
+		cb.Row().Before("gorm:row").Register("metrics:before", p.before),
+		cb.Row().After("gorm:row").Register("metrics:after", p.after),
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *gormPlugin) before(db *gorm.DB) {
+	db.Statement.Settings.Store(startKey, time.Now())
+}
+
+func (p *gormPlugin) after(db *gorm.DB) {
+	value, ok := db.Statement.Settings.LoadAndDelete(startKey)
+	if !ok {
+		return
+	}
+
+	repository, method := queryCaller()
+	QueryDuration.WithLabelValues(repository, method).Observe(time.Since(value.(time.Time)).Seconds())
+}
+
+// queryCaller names the first function of this module up the stack:
+// internal/post/repository.(*pgRepo).GetPost is "post", "GetPost",
+// internal/pkg/ratelimit.(*pgStore).Fail is "ratelimit", "Fail".
+func queryCaller() (string, string) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, modulePkg) && !strings.HasPrefix(frame.Function, thisPkg) {
+			return splitFunction(strings.TrimPrefix(frame.Function, modulePkg))
+		}
+		if !more {
+			return "other", "other"
+		}
+	}
+}
+
+func splitFunction(function string) (string, string) {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".") + slash + 1
+	pkg, method := function[:dot], function[dot+1:]
+
+	pkg = strings.TrimSuffix(pkg, "/repository")
+	pkg = strings.TrimPrefix(pkg, "pkg/")
+
+	// the receiver and the closures of the method go
+	if i := strings.Index(method, ")."); i >= 0 {
+		method = method[i+2:]
+	}
+	if i := strings.Index(method, "."); i >= 0 {
+		method = method[:i]
+	}
+
+	return pkg, method
+}
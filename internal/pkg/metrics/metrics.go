@@ -0,0 +1,99 @@
+// Package metrics holds the domain metrics served on /prometheus next to
+// the HTTP ones of echo-contrib. The collectors can be used unregistered,
+// tests do so.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "cloth"
+
+var (
+	// by "password" or "oidc"
+	SignUps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signups_total",
+		Help:      "Users signed up.",
+	}, []string{"method"})
+
+	SignInFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "signin_failures_total",
+		Help:      "Sign-ins refused, by reason.",
+	}, []string{"reason"})
+
+	PostsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "posts_created_total",
+		Help:      "Posts created, by category and sex.",
+	}, []string{"category", "sex"})
+
+	// by "like" or "dislike", a rate changed counts again
+	Rates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rates_total",
+		Help:      "Posts liked or disliked.",
+	}, []string{"rate"})
+
+	CommentsCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "comments_created_total",
+		Help:      "Comments created.",
+	})
+
+	ImageUploadBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_upload_bytes",
+		Help:      "Size of the uploaded images.",
+		// 16KiB to 16MiB
+		Buckets: prometheus.ExponentialBuckets(16<<10, 2, 11),
+	})
+
+	ImageProcessing = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "image_processing_seconds",
+		Help:      "Time to receive and store an uploaded image.",
+		Buckets:   prometheus.DefBuckets,
+	})
+
+	StoredImageBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stored_image_bytes",
+		Help:      "Size of the image directory as of its last scan.",
+	})
+
+	// by the repository and its method running the query, see NewGormPlugin
+	QueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of the database queries, by repository method.",
+		// 0.5ms to 4s
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"repository", "method"})
+)
+
+// Register adds the metrics to the default registry, the one served by
+// echo-contrib's prometheus middleware.
+func Register() error {
+	collectors := []prometheus.Collector{
+		SignUps,
+		SignInFailures,
+		PostsCreated,
+		Rates,
+		CommentsCreated,
+		ImageUploadBytes,
+		ImageProcessing,
+		StoredImageBytes,
+		QueryDuration,
+	}
+
+	for _, collector := range collectors {
+		err := prometheus.Register(collector)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
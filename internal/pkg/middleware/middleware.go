@@ -1,8 +1,222 @@
 package middleware
 
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type StatusChecker interface {
+	GetUserStatus(ctx context.Context, id uint64) (*model.UserStatus, error)
+}
+
+type TokenAuthenticator interface {
+	AuthenticateAPIToken(ctx context.Context, raw string) (*model.User, *model.APIToken, error)
+}
+
+const maxCachedStatuses = 10000
+
+const scopeKey = "scope"
+
+type cachedStatus struct {
+	status  *model.UserStatus
+	expires time.Time
+}
+
 type authMiddleware struct {
+	jwtAuth       echo.MiddlewareFunc
+	statusChecker StatusChecker
+	tokenAuth     TokenAuthenticator
+	statusTTL     time.Duration
+
+	mu       sync.Mutex
+	statuses map[uint64]cachedStatus
+}
+
+// NewAuthMiddleware wraps the JWT middleware with a user status check.
+// Statuses and roles are cached for statusTTL, so a ban or a role change
+// reaches every server within that time.
+func NewAuthMiddleware(jwtAuth echo.MiddlewareFunc, statusChecker StatusChecker,
+	tokenAuth TokenAuthenticator, statusTTL time.Duration) *authMiddleware {
+	return &authMiddleware{
+		jwtAuth:       jwtAuth,
+		statusChecker: statusChecker,
+		tokenAuth:     tokenAuth,
+		statusTTL:     statusTTL,
+		statuses:      make(map[uint64]cachedStatus),
+	}
+}
+
+// Auth authenticates the request by JWT or personal API token and rejects
+// banned and suspended users.
+func (am *authMiddleware) Auth() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		checked := am.checkStatus(next)
+		jwtAuth := am.jwtAuth(checked)
+		tokenAuth := am.apiTokenAuth(checked)
+
+		return func(c echo.Context) error {
+			if strings.HasPrefix(bearerToken(c), model.APITokenPrefix) {
+				return tokenAuth(c)
+			}
+
+			return jwtAuth(c)
+		}
+	}
+}
+
+// apiTokenAuth puts the token owner into the context the way the JWT
+// middleware does, so handlers don't tell the two apart.
+func (am *authMiddleware) apiTokenAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user, token, err := am.tokenAuth.AuthenticateAPIToken(c.Request().Context(), bearerToken(c))
+		if errors.Is(err, model.ErrUnauthorized) {
+			return model.ErrUnauthorized
+		} else if err != nil {
+			return err
+		}
+
+		scope, _ := c.Get(scopeKey).(string)
+		if scope == "" || !token.Allows(scope) {
+			return model.ErrPermissionDenied
+		}
+
+		c.Set("user", &jwt.Token{
+			Claims: &jwtManager.Claims{User: *jwtManager.FromModelUsertoUserClaims(user)},
+			Valid:  true,
+		})
+		c.Set("apiToken", token)
+
+		return next(c)
+	}
+}
+
+// Scope must run before Auth: it declares the scope an API token needs on
+// the route. Routes declaring none take sessions only, tokens get a 403 there.
+func (am *authMiddleware) Scope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(scopeKey, scope)
+			return next(c)
+		}
+	}
 }
 
-func NewAuthMiddleware() *authMiddleware {
-	return &authMiddleware{}
+func bearerToken(c echo.Context) string {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return auth[len("Bearer "):]
+	}
+
+	return ""
+}
+
+// RequireRole must run after Auth: it lets the request through only if the
+// authenticated user currently has at least the given role.
+func (am *authMiddleware) RequireRole(role string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userClaims, err := getUserClaims(c)
+			if err != nil {
+				return model.ErrUnauthorized
+			}
+
+			if !model.HasRole(userClaims.Role, role) {
+				return model.ErrPermissionDenied
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func (am *authMiddleware) checkStatus(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userClaims, err := getUserClaims(c)
+		if err != nil {
+			return model.ErrUnauthorized
+		}
+
+		status, err := am.getStatus(c.Request().Context(), userClaims.ID)
+		if errors.Is(err, model.ErrNotFound) {
+			return model.ErrUnauthorized
+		} else if err != nil {
+			return err
+		}
+
+		err = status.Blocked(time.Now())
+		if err != nil {
+			return err
+		}
+
+		// the role signed into a session is as old as the session, RequireRole
+		// and the handlers get the one loaded with the status instead
+		userClaims.Role = status.Role
+
+		ctx := logger.WithFields(c.Request().Context(), zap.Uint64("user_id", userClaims.ID))
+		c.SetRequest(c.Request().WithContext(ctx))
+
+		return next(c)
+	}
+}
+
+// Forget drops the cached status of the user, so a change made through this
+// server applies to the next request; the others see it within statusTTL.
+func (am *authMiddleware) Forget(id uint64) {
+	am.mu.Lock()
+	delete(am.statuses, id)
+	am.mu.Unlock()
+}
+
+func (am *authMiddleware) getStatus(ctx context.Context, id uint64) (*model.UserStatus, error) {
+	now := time.Now()
+
+	am.mu.Lock()
+	cached, ok := am.statuses[id]
+	am.mu.Unlock()
+	if ok && cached.expires.After(now) {
+		return cached.status, nil
+	}
+
+	status, err := am.statusChecker.GetUserStatus(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "status checker error")
+	}
+
+	am.mu.Lock()
+	if len(am.statuses) >= maxCachedStatuses {
+		for cachedId, cached := range am.statuses {
+			if !cached.expires.After(now) {
+				delete(am.statuses, cachedId)
+			}
+		}
+	}
+	am.statuses[id] = cachedStatus{status: status, expires: now.Add(am.statusTTL)}
+	am.mu.Unlock()
+
+	return status, nil
+}
+
+func getUserClaims(c echo.Context) (*jwtManager.UserClaims, error) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok {
+		return nil, errors.New("no jwt token in context")
+	}
+
+	claims, ok := token.Claims.(*jwtManager.Claims)
+	if !ok {
+		return nil, errors.New("unexpected jwt claims type")
+	}
+
+	return &claims.User, nil
 }
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/ratelimit"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+type rateLimiter struct {
+	store  ratelimit.Store
+	limits map[string]RateLimit
+}
+
+// NewRateLimiter creates a limiter with named per-route limits.
+// Counters live in store, so a shared store makes limits global across servers.
+func NewRateLimiter(store ratelimit.Store, limits map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		store:  store,
+		limits: limits,
+	}
+}
+
+// Limit allows at most the configured number of requests per window for each client:
+// the authenticated user if Auth ran before, the client address otherwise.
+// Unknown names don't limit anything.
+func (rl *rateLimiter) Limit(name string) echo.MiddlewareFunc {
+	limit, ok := rl.limits[name]
+	if !ok {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			now := time.Now()
+			windowStart := now.Truncate(limit.Window)
+			key := "route:" + name + ":" + clientKey(c) + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+
+			counter, err := rl.store.Incr(c.Request().Context(), key, limit.Window)
+			if err != nil {
+				// a broken store must not take the API down with it
+				logger.Ctx(c.Request().Context(), "ratelimit").Error("rate limit store", zap.Error(err))
+				return next(c)
+			}
+
+			if counter.Count > limit.Limit {
+				retryAfter := windowStart.Add(limit.Window).Sub(now)
+				c.Response().Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+				return model.ErrTooManyRequests
+			}
+
+			return next(c)
+		}
+	}
+}
+
+func clientKey(c echo.Context) string {
+	userClaims, err := getUserClaims(c)
+	if err == nil {
+		return "user:" + strconv.FormatUint(userClaims.ID, 10)
+	}
+
+	return "ip:" + c.RealIP()
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/replica"
+)
+
+// wroteCookie holds the time of the client's last write. A cookie, not
+// server memory: nginx sends reads and writes to different servers.
+const wroteCookie = "cloth_wrote"
+
+// wroteHeader carries the same time for clients keeping no cookies: a write
+// returns it, sending it back with the reads makes them see the write.
+// A forged one only moves the client's reads to the primary.
+const wroteHeader = "X-Cloth-Wrote"
+
+type readYourWrites struct {
+	stickyFor time.Duration
+}
+
+// NewReadYourWrites creates a middleware sending the reads of a client that
+// wrote within stickyFor to the primary, so replication lag doesn't hide its
+// writes. Writing requests read from the primary too, they decide on what
+// they read.
+func NewReadYourWrites(stickyFor time.Duration) *readYourWrites {
+	return &readYourWrites{
+		stickyFor: stickyFor,
+	}
+}
+
+func (ryw *readYourWrites) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		now := time.Now()
+
+		switch c.Request().Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if !ryw.wroteRecently(c, now) {
+				return next(c)
+			}
+		default:
+			wroteAt := strconv.FormatInt(now.Unix(), 10)
+			// set before the handler, the response may be committed after it
+			c.SetCookie(&http.Cookie{
+				Name:     wroteCookie,
+				Value:    wroteAt,
+				Path:     "/",
+				MaxAge:   int(ryw.stickyFor.Seconds()) + 1,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			c.Response().Header().Set(wroteHeader, wroteAt)
+		}
+
+		c.SetRequest(c.Request().WithContext(replica.WithPrimary(c.Request().Context())))
+		return next(c)
+	}
+}
+
+func (ryw *readYourWrites) wroteRecently(c echo.Context, now time.Time) bool {
+	values := []string{c.Request().Header.Get(wroteHeader)}
+	if cookie, err := c.Cookie(wroteCookie); err == nil {
+		values = append(values, cookie.Value)
+	}
+
+	for _, value := range values {
+		wroteAt, err := strconv.ParseInt(value, 10, 64)
+		if err == nil && now.Sub(time.Unix(wroteAt, 0)) <= ryw.stickyFor {
+			return true
+		}
+	}
+
+	return false
+}
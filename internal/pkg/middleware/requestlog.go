@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/random"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+)
+
+// an X-Request-ID from nginx is kept if it looks like an id, anything
+// else is replaced rather than written to the logs
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+type requestLogger struct {
+}
+
+// NewRequestLogger creates the outermost middleware: it gives the request
+// an id, puts a logger with the id and the route into the request context
+// and writes one access line per request.
+func NewRequestLogger() *requestLogger {
+	return &requestLogger{}
+}
+
+func (rl *requestLogger) Handle(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		req := c.Request()
+
+		id := req.Header.Get(echo.HeaderXRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = random.String(32)
+		}
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+		fields := []zap.Field{
+			zap.String("request_id", id),
+			zap.String("method", req.Method),
+			zap.String("route", c.Path()),
+		}
+		// ties the request's lines to its trace
+		if span := trace.SpanContextFromContext(req.Context()); span.IsValid() {
+			fields = append(fields, zap.String("trace_id", span.TraceID().String()))
+		}
+		ctx := logger.WithFields(req.Context(), fields...)
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+		if err != nil {
+			// writes the response, so its status is the one logged
+			c.Error(err)
+		}
+
+		res := c.Response()
+		fields = []zap.Field{
+			zap.String("uri", req.RequestURI),
+			zap.Int("status", res.Status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("remote_ip", c.RealIP()),
+			zap.String("user_agent", req.UserAgent()),
+			zap.Int64("bytes_out", res.Size),
+		}
+		// unknown for chunked bodies
+		if req.ContentLength >= 0 {
+			fields = append(fields, zap.Int64("bytes_in", req.ContentLength))
+		}
+		// the user is known once the route's auth middleware has run
+		if userClaims, err := getUserClaims(c); err == nil {
+			fields = append(fields, zap.Uint64("user_id", userClaims.ID))
+		}
+
+		logger.Ctx(ctx, "http").Info("request", fields...)
+
+		return nil
+	}
+}
@@ -0,0 +1,256 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// lockKey is the pg_advisory_lock key held while migrating, so servers
+// starting together apply every migration once.
+const lockKey = 7_140_512_042
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type pgSchemaMigration struct {
+	Version   uint64 `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (pgSchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+}
+
+// NewMigrator reads the migrations from the root of fsys.
+func NewMigrator(db *gorm.DB, fsys fs.FS) (*migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies the pending migrations and returns how many there were.
+func (m *migrator) Up() (int, error) {
+	applied := 0
+
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if done[mig.Version] {
+				continue
+			}
+
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				err := tx.Exec(mig.Up).Error
+				if err != nil {
+					return err
+				}
+
+				return tx.Create(&pgSchemaMigration{
+					Version:   mig.Version,
+					Name:      mig.Name,
+					AppliedAt: time.Now(),
+				}).Error
+			})
+			if err != nil {
+				return errors.Wrapf(err, "migration %04d_%s up", mig.Version, mig.Name)
+			}
+			applied++
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts up to steps latest applied migrations.
+func (m *migrator) Down(steps int) (int, error) {
+	reverted := 0
+
+	err := m.locked(func(conn *gorm.DB) error {
+		done, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			mig := m.migrations[i]
+			if !done[mig.Version] {
+				continue
+			}
+
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				err := tx.Exec(mig.Down).Error
+				if err != nil {
+					return err
+				}
+
+				return tx.Delete(&pgSchemaMigration{}, mig.Version).Error
+			})
+			if err != nil {
+				return errors.Wrapf(err, "migration %04d_%s down", mig.Version, mig.Name)
+			}
+			reverted++
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+func (m *migrator) Status() ([]Status, error) {
+	var records []pgSchemaMigration
+
+	err := m.locked(func(conn *gorm.DB) error {
+		return conn.Find(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[uint64]time.Time, len(records))
+	for _, rec := range records {
+		appliedAt[rec.Version] = rec.AppliedAt
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		at, ok := appliedAt[mig.Version]
+		statuses[i] = Status{Migration: mig, Applied: ok, AppliedAt: at}
+	}
+
+	return statuses, nil
+}
+
+// locked runs fn on a single connection holding the advisory lock,
+// the lock belongs to the session and would be lost on another connection.
+func (m *migrator) locked(fn func(conn *gorm.DB) error) error {
+	err := m.db.Connection(func(conn *gorm.DB) error {
+		err := conn.Exec("SELECT pg_advisory_lock(?)", lockKey).Error
+		if err != nil {
+			return err
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(?)", lockKey)
+
+		err = conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`).Error
+		if err != nil {
+			return err
+		}
+
+		return fn(conn)
+	})
+	if err != nil {
+		return errors.Wrap(err, "database error")
+	}
+
+	return nil
+}
+
+func appliedVersions(conn *gorm.DB) (map[uint64]bool, error) {
+	var versions []uint64
+
+	err := conn.Model(&pgSchemaMigration{}).Pluck("version", &versions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[uint64]bool, len(versions))
+	for _, v := range versions {
+		done[v] = true
+	}
+
+	return done, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, errors.Wrap(err, "read migrations error")
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "migration %s version", entry.Name())
+		}
+
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, errors.Wrap(err, "read migrations error")
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		} else if mig.Name != match[2] {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", mig.Name, match[2], version)
+		}
+
+		if match[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
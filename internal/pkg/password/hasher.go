@@ -0,0 +1,158 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Bcrypt   = "bcrypt"
+	Argon2id = "argon2id"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+type HashConfig struct {
+	// algorithm of new hashes, Bcrypt or Argon2id
+	Algorithm  string
+	BcryptCost int
+	// memory in KiB
+	Argon2Memory  uint32
+	Argon2Time    uint32
+	Argon2Threads uint8
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+type hasher struct {
+	cfg HashConfig
+}
+
+func NewHasher(cfg HashConfig) *hasher {
+	return &hasher{
+		cfg: cfg,
+	}
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.cfg.Algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", errors.Wrap(err, "bcrypt error")
+		}
+
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", errors.Wrap(err, "random error")
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.cfg.Argon2Time, h.cfg.Argon2Memory, h.cfg.Argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.cfg.Argon2Memory, h.cfg.Argon2Time, h.cfg.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Compare returns model.ErrInvalidPassword if password doesn't match hash.
+// Both bcrypt and argon2id hashes are understood whatever the configured algorithm is.
+func (h *hasher) Compare(hash, password string) error {
+	if !strings.HasPrefix(hash, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return model.ErrInvalidPassword
+		} else if err != nil {
+			return errors.Wrap(err, "bcrypt error")
+		}
+
+		return nil
+	}
+
+	params, err := parseArgon2(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return model.ErrInvalidPassword
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or weaker parameters than configured.
+func (h *hasher) NeedsRehash(hash string) bool {
+	if h.cfg.Algorithm == Bcrypt {
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost < h.cfg.BcryptCost
+	}
+
+	params, err := parseArgon2(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.memory < h.cfg.Argon2Memory || params.time < h.cfg.Argon2Time ||
+		params.threads < h.cfg.Argon2Threads
+}
+
+func parseArgon2(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != Argon2id {
+		return nil, errors.New("not an argon2id hash")
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return nil, errors.Wrap(err, "argon2id version")
+	} else if version != argon2.Version {
+		return nil, errors.Errorf("unsupported argon2id version %d", version)
+	}
+
+	var params argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads)
+	if err != nil {
+		return nil, errors.Wrap(err, "argon2id params")
+	} else if params.time == 0 || params.threads == 0 {
+		// argon2 panics on them
+		return nil, errors.New("argon2id params out of range")
+	}
+
+	params.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, errors.Wrap(err, "argon2id salt")
+	} else if len(params.salt) == 0 {
+		return nil, errors.New("argon2id salt is empty")
+	}
+
+	params.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return nil, errors.Wrap(err, "argon2id key")
+	} else if len(params.key) == 0 {
+		return nil, errors.New("argon2id key is empty")
+	}
+
+	return &params, nil
+}
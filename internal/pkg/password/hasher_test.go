@@ -0,0 +1,129 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// cheap parameters, the algorithms are what is tested
+var (
+	testBcrypt = HashConfig{
+		Algorithm:  Bcrypt,
+		BcryptCost: bcrypt.MinCost,
+	}
+	testArgon2 = HashConfig{
+		Algorithm:     Argon2id,
+		Argon2Memory:  1024,
+		Argon2Time:    1,
+		Argon2Threads: 1,
+	}
+)
+
+func mustHash(t *testing.T, cfg HashConfig, password string) string {
+	t.Helper()
+
+	hash, err := NewHasher(cfg).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hash
+}
+
+func TestCompareBothFormats(t *testing.T) {
+	for _, cfg := range []HashConfig{testBcrypt, testArgon2} {
+		hash := mustHash(t, cfg, "Correct-horse-42")
+
+		// whatever the configured algorithm is
+		for _, h := range []*hasher{NewHasher(testBcrypt), NewHasher(testArgon2)} {
+			err := h.Compare(hash, "Correct-horse-42")
+			if err != nil {
+				t.Fatalf("%s hash: %v", cfg.Algorithm, err)
+			}
+
+			err = h.Compare(hash, "Wrong-horse-42")
+			if !errors.Is(err, model.ErrInvalidPassword) {
+				t.Fatalf("%s hash, wrong password: %v, want %v", cfg.Algorithm, err, model.ErrInvalidPassword)
+			}
+		}
+	}
+}
+
+func TestArgon2Format(t *testing.T) {
+	hash := mustHash(t, testArgon2, "Correct-horse-42")
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("hash = %q", hash)
+	}
+
+	// salted
+	if hash == mustHash(t, testArgon2, "Correct-horse-42") {
+		t.Fatal("equal hashes of one password")
+	}
+}
+
+func TestCompareMalformedArgon2(t *testing.T) {
+	valid := strings.Split(mustHash(t, testArgon2, "Correct-horse-42"), "$")
+
+	malformed := map[string]string{
+		"too few parts":  strings.Join(valid[:5], "$"),
+		"other version":  strings.Join([]string{"", "argon2id", "v=16", valid[3], valid[4], valid[5]}, "$"),
+		"bad params":     strings.Join([]string{"", "argon2id", valid[2], "m=1024,t=1", valid[4], valid[5]}, "$"),
+		"no threads":     strings.Join([]string{"", "argon2id", valid[2], "m=1024,t=1,p=0", valid[4], valid[5]}, "$"),
+		"no time":        strings.Join([]string{"", "argon2id", valid[2], "m=1024,t=0,p=1", valid[4], valid[5]}, "$"),
+		"bad salt":       strings.Join([]string{"", "argon2id", valid[2], valid[3], "!!", valid[5]}, "$"),
+		"no salt":        strings.Join([]string{"", "argon2id", valid[2], valid[3], "", valid[5]}, "$"),
+		"bad key":        strings.Join([]string{"", "argon2id", valid[2], valid[3], valid[4], "!!"}, "$"),
+		"no key":         strings.Join([]string{"", "argon2id", valid[2], valid[3], valid[4], ""}, "$"),
+		"not a password": "$argon2id$",
+	}
+
+	h := NewHasher(testArgon2)
+	for name, hash := range malformed {
+		t.Run(name, func(t *testing.T) {
+			err := h.Compare(hash, "Correct-horse-42")
+			if err == nil || errors.Is(err, model.ErrInvalidPassword) {
+				t.Fatalf("compare = %v, want a malformed hash error", err)
+			}
+
+			if !h.NeedsRehash(hash) {
+				t.Fatal("malformed hash kept")
+			}
+		})
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	stronger := testArgon2
+	stronger.Argon2Memory *= 2
+
+	strongerBcrypt := testBcrypt
+	strongerBcrypt.BcryptCost++
+
+	tests := []struct {
+		name string
+		hash HashConfig
+		cfg  HashConfig
+		want bool
+	}{
+		{"bcrypt to argon2id", testBcrypt, testArgon2, true},
+		{"argon2id to bcrypt", testArgon2, testBcrypt, true},
+		{"same argon2id", testArgon2, testArgon2, false},
+		{"weaker argon2id", testArgon2, stronger, true},
+		{"stronger argon2id", stronger, testArgon2, false},
+		{"same bcrypt", testBcrypt, testBcrypt, false},
+		{"weaker bcrypt", testBcrypt, strongerBcrypt, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := mustHash(t, tt.hash, "Correct-horse-42")
+			if got := NewHasher(tt.cfg).NeedsRehash(hash); got != tt.want {
+				t.Fatalf("needs rehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package password
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+// common.txt is a list of the most common and breached passwords, one per line, lower-case.
+//
+//go:embed common.txt
+var commonList string
+
+var commonPasswords = loadCommon(commonList)
+
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// how many of the classes (lower, upper, digits, other) the password must use
+	MinClasses  int
+	CheckCommon bool
+}
+
+// Check returns model.ErrWeakPassword wrapped with the broken rule.
+func (p Policy) Check(password, login string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return errors.Wrapf(model.ErrWeakPassword, "shorter than %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return errors.Wrapf(model.ErrWeakPassword, "longer than %d characters", p.MaxLength)
+	}
+
+	if classes(password) < p.MinClasses {
+		return errors.Wrapf(model.ErrWeakPassword, "uses fewer than %d of lower, upper, digits and symbols", p.MinClasses)
+	}
+
+	if strings.EqualFold(password, login) {
+		return errors.Wrap(model.ErrWeakPassword, "equal to login")
+	}
+
+	if p.CheckCommon && IsCommon(password) {
+		return errors.Wrap(model.ErrWeakPassword, "too common")
+	}
+
+	return nil
+}
+
+func IsCommon(password string) bool {
+	_, ok := commonPasswords[strings.ToLower(password)]
+	return ok
+}
+
+func classes(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
+
+func loadCommon(list string) map[string]struct{} {
+	passwords := make(map[string]struct{})
+
+	scanner := bufio.NewScanner(strings.NewReader(list))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" {
+			passwords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+
+	return passwords
+}
@@ -0,0 +1,60 @@
+package password
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+func TestPolicyCheck(t *testing.T) {
+	policy := Policy{
+		MinLength:   8,
+		MaxLength:   128,
+		MinClasses:  2,
+		CheckCommon: true,
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		login    string
+		weak     bool
+	}{
+		{"strong", "Correct-horse-42", "alice_login", false},
+		{"too short", "Ab-4", "alice_login", true},
+		// runes are counted, not bytes
+		{"short in runes", "Пароль1", "alice_login", true},
+		{"long enough in runes", "Пароль12", "alice_login", false},
+		{"too long", "Aa1" + strings.Repeat("x", 126), "alice_login", true},
+		{"one class", "correcthorsebattery", "alice_login", true},
+		{"two classes", "correcthorse42", "alice_login", false},
+		{"equal to login", "Alice_Login", "alice_login", true},
+		{"common", "password", "alice_login", true},
+		{"common in other case", "Password1", "alice_login", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := policy.Check(tt.password, tt.login)
+			if tt.weak && !errors.Is(err, model.ErrWeakPassword) {
+				t.Fatalf("check = %v, want %v", err, model.ErrWeakPassword)
+			} else if !tt.weak && err != nil {
+				t.Fatalf("check = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestPolicyWithoutCommonCheck(t *testing.T) {
+	policy := Policy{
+		MinLength:  8,
+		MinClasses: 1,
+	}
+
+	err := policy.Check("password", "alice_login")
+	if err != nil {
+		t.Fatalf("check = %v, want nil", err)
+	}
+}
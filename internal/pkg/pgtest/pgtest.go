@@ -0,0 +1,232 @@
+// Package pgtest gives tests a fresh migrated Postgres database each. The
+// databases are made on the server named by CLOTH_TEST_PG, in the
+// "host=... port=... user=... password=..." form, or on a throwaway server
+// started with initdb and pg_ctl from PATH. Without either the tests skip.
+//
+// A package using it calls Main from TestMain, which stops that server.
+package pgtest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ell1jah/bmstu_web/internal/migrations"
+	"github.com/ell1jah/bmstu_web/internal/pkg/migrate"
+	"github.com/pkg/errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const dsnEnv = "CLOTH_TEST_PG"
+
+var (
+	once sync.Once
+	// the server, the migrated template and what went wrong setting them up
+	serverDSN string
+	template  string
+	setupErr  error
+	stop      func()
+
+	databases atomic.Int64
+)
+
+// Main runs the tests and drops what New has set up.
+func Main(m *testing.M) {
+	code := m.Run()
+
+	if stop != nil {
+		stop()
+	}
+
+	os.Exit(code)
+}
+
+// New returns a connection to a new database with all the migrations
+// applied, dropped when the test ends.
+func New(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	once.Do(setup)
+	if setupErr != nil {
+		t.Skipf("no postgres: %v", setupErr)
+	}
+
+	name := fmt.Sprintf("%s_%d", template, databases.Add(1))
+	err := adminExec(serverDSN, `CREATE DATABASE "`+name+`" TEMPLATE "`+template+`"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := open(serverDSN + " dbname=" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		sqlDB, err := db.DB()
+		if err == nil {
+			sqlDB.Close()
+		}
+
+		err = adminExec(serverDSN, `DROP DATABASE IF EXISTS "`+name+`"`)
+		if err != nil {
+			t.Error(err)
+		}
+	})
+
+	return db
+}
+
+func setup() {
+	serverDSN = os.Getenv(dsnEnv)
+	if serverDSN == "" {
+		serverDSN, stop, setupErr = startServer()
+		if setupErr != nil {
+			setupErr = errors.Wrapf(setupErr, "%s isn't set and no server could be started", dsnEnv)
+			return
+		}
+	}
+
+	// per process, test binaries of several packages may share the server
+	template = fmt.Sprintf("cloth_test_%d", os.Getpid())
+	setupErr = migrateTemplate()
+	if setupErr != nil {
+		return
+	}
+
+	dropServer := stop
+	stop = func() {
+		err := adminExec(serverDSN, `DROP DATABASE IF EXISTS "`+template+`"`)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "pgtest:", err)
+		}
+
+		if dropServer != nil {
+			dropServer()
+		}
+	}
+}
+
+// migrateTemplate makes the database the test ones are copied from,
+// copying is much faster than migrating each.
+func migrateTemplate() error {
+	err := adminExec(serverDSN, `CREATE DATABASE "`+template+`"`)
+	if err != nil {
+		return err
+	}
+
+	db, err := open(serverDSN + " dbname=" + template)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	// a template can't be copied while connected to
+	defer sqlDB.Close()
+
+	migrator, err := migrate.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	_, err = migrator.Up()
+	return errors.Wrap(err, "migrate template")
+}
+
+// startServer runs a server with its data and socket in a temporary
+// directory, without fsync and reachable only through the socket.
+func startServer() (string, func(), error) {
+	binDir, err := pgBinDir()
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "pgtest")
+	if err != nil {
+		return "", nil, err
+	}
+	dataDir := filepath.Join(dir, "data")
+	pgCtl := filepath.Join(binDir, "pg_ctl")
+
+	err = run(filepath.Join(binDir, "initdb"), "-D", dataDir, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync")
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	err = run(pgCtl, "-D", dataDir, "-l", filepath.Join(dir, "log"), "-w",
+		"-o", "-F -p 5432 -k "+dir+" -c listen_addresses=''", "start")
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	stop := func() {
+		err := run(pgCtl, "-D", dataDir, "-m", "immediate", "-w", "stop")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "pgtest:", err)
+		}
+		os.RemoveAll(dir)
+	}
+
+	return "host=" + dir + " port=5432 user=postgres sslmode=disable", stop, nil
+}
+
+// pgBinDir finds initdb on PATH or where pg_config says the binaries are,
+// Debian keeps them off PATH.
+func pgBinDir() (string, error) {
+	initdb, err := exec.LookPath("initdb")
+	if err == nil {
+		return filepath.Dir(initdb), nil
+	}
+
+	out, err := exec.Command("pg_config", "--bindir").Output()
+	if err != nil {
+		return "", errors.New("no initdb on PATH and no pg_config")
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "%s: %s", filepath.Base(name), strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+func open(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: dsn}), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	return db, errors.Wrap(err, "postgres connect")
+}
+
+// adminExec runs a statement in the maintenance database, CREATE and DROP
+// DATABASE can't run in the database they are about.
+func adminExec(dsn, query string) error {
+	db, err := open(dsn + " dbname=postgres")
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	return errors.Wrap(db.Exec(query).Error, "postgres")
+}
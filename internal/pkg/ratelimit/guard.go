@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type BackoffConfig struct {
+	// failures tolerated before the first lockout
+	MaxFailures int
+	// lockout after MaxFailures, doubled by every further failure up to MaxLockout
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+	// how long a failure is remembered after the last one
+	FailureTTL time.Duration
+}
+
+// backoffGuard locks a key out for an exponentially growing time after
+// repeated failures, e.g. wrong passwords for one login.
+type backoffGuard struct {
+	store  Store
+	prefix string
+	cfg    BackoffConfig
+}
+
+func NewBackoffGuard(store Store, prefix string, cfg BackoffConfig) *backoffGuard {
+	return &backoffGuard{
+		store:  store,
+		prefix: prefix,
+		cfg:    cfg,
+	}
+}
+
+// Check returns model.ErrTooManyRequests while key is locked out.
+func (bg *backoffGuard) Check(ctx context.Context, key string) error {
+	counter, err := bg.store.Get(ctx, bg.prefix+key)
+	if err != nil {
+		return errors.Wrap(err, "rate limit store error")
+	} else if counter == nil {
+		return nil
+	}
+
+	if time.Now().Before(counter.UpdatedAt.Add(bg.lockout(counter.Count))) {
+		return model.ErrTooManyRequests
+	}
+
+	return nil
+}
+
+func (bg *backoffGuard) Fail(ctx context.Context, key string) error {
+	_, err := bg.store.Incr(ctx, bg.prefix+key, bg.cfg.FailureTTL)
+	if err != nil {
+		return errors.Wrap(err, "rate limit store error")
+	}
+
+	return nil
+}
+
+func (bg *backoffGuard) Reset(ctx context.Context, key string) error {
+	err := bg.store.Delete(ctx, bg.prefix+key)
+	if err != nil {
+		return errors.Wrap(err, "rate limit store error")
+	}
+
+	return nil
+}
+
+func (bg *backoffGuard) lockout(failures int) time.Duration {
+	if failures < bg.cfg.MaxFailures {
+		return 0
+	}
+
+	lockout := bg.cfg.BaseLockout
+	for i := bg.cfg.MaxFailures; i < failures && lockout < bg.cfg.MaxLockout; i++ {
+		lockout *= 2
+	}
+
+	if lockout > bg.cfg.MaxLockout {
+		lockout = bg.cfg.MaxLockout
+	}
+
+	return lockout
+}
@@ -0,0 +1,107 @@
+package ratelimit
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const pgCleanupEvery = 1000
+
+const incrQuery = `INSERT INTO rate_limits (key, count, updated_at, expires_at) VALUES (@key, 1, @now, @expires)
+ON CONFLICT (key) DO UPDATE SET
+	count = CASE WHEN rate_limits.expires_at <= @now THEN 1 ELSE rate_limits.count + 1 END,
+	updated_at = EXCLUDED.updated_at,
+	expires_at = EXCLUDED.expires_at
+RETURNING count, updated_at, expires_at`
+
+type pgCounter struct {
+	Key       string
+	Count     int
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+}
+
+func (c pgCounter) toCounter() *Counter {
+	return &Counter{
+		Count:     c.Count,
+		UpdatedAt: c.UpdatedAt,
+		ExpiresAt: c.ExpiresAt,
+	}
+}
+
+func (pgCounter) TableName() string {
+	return "rate_limits"
+}
+
+// pgStore keeps counters in Postgres, so every server shares the same limits.
+type pgStore struct {
+	db    *gorm.DB
+	incrs atomic.Uint64
+}
+
+func NewPgStore(db *gorm.DB) *pgStore {
+	return &pgStore{
+		db: db,
+	}
+}
+
+func (ps *pgStore) Incr(ctx context.Context, key string, ttl time.Duration) (*Counter, error) {
+	now := time.Now()
+	var counter pgCounter
+
+	tx := ps.db.WithContext(ctx).Raw(incrQuery, map[string]interface{}{
+		"key":     key,
+		"now":     now,
+		"expires": now.Add(ttl),
+	}).Scan(&counter)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table rate_limits)")
+	}
+
+	if ps.incrs.Add(1)%pgCleanupEvery == 0 {
+		err := ps.cleanup(ctx, now)
+		if err != nil {
+			return nil, errors.Wrap(err, "cleanup error")
+		}
+	}
+
+	return counter.toCounter(), nil
+}
+
+// Get returns nil if there is no live counter under key.
+func (ps *pgStore) Get(ctx context.Context, key string) (*Counter, error) {
+	var counter pgCounter
+
+	// a lagging replica would let a locked out client in
+	tx := ps.db.WithContext(ctx).Clauses(dbresolver.Write).Where("key = ? AND expires_at > ?", key, time.Now()).Take(&counter)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table rate_limits)")
+	}
+
+	return counter.toCounter(), nil
+}
+
+func (ps *pgStore) Delete(ctx context.Context, key string) error {
+	tx := ps.db.WithContext(ctx).Where("key = ?", key).Delete(&pgCounter{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table rate_limits)")
+	}
+
+	return nil
+}
+
+func (ps *pgStore) cleanup(ctx context.Context, now time.Time) error {
+	tx := ps.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&pgCounter{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table rate_limits)")
+	}
+
+	return nil
+}
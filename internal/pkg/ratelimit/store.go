@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const memoryCleanupPeriod = time.Minute
+
+type Counter struct {
+	Count     int
+	UpdatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Store keeps expiring counters. Incr starts an expired or missing counter
+// from zero and moves its expiry to ttl after the increment.
+type Store interface {
+	Incr(ctx context.Context, key string, ttl time.Duration) (*Counter, error)
+	Get(ctx context.Context, key string) (*Counter, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// memoryStore keeps counters in the process, so limits are per server.
+type memoryStore struct {
+	mu          sync.Mutex
+	counters    map[string]*Counter
+	lastCleanup time.Time
+}
+
+func NewMemoryStore() *memoryStore {
+	return &memoryStore{
+		counters:    make(map[string]*Counter),
+		lastCleanup: time.Now(),
+	}
+}
+
+func (ms *memoryStore) Incr(_ context.Context, key string, ttl time.Duration) (*Counter, error) {
+	now := time.Now()
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.cleanup(now)
+
+	counter, ok := ms.counters[key]
+	if !ok || !counter.ExpiresAt.After(now) {
+		counter = &Counter{}
+		ms.counters[key] = counter
+	}
+
+	counter.Count++
+	counter.UpdatedAt = now
+	counter.ExpiresAt = now.Add(ttl)
+
+	copied := *counter
+	return &copied, nil
+}
+
+// Get returns nil if there is no live counter under key.
+func (ms *memoryStore) Get(_ context.Context, key string) (*Counter, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	counter, ok := ms.counters[key]
+	if !ok || !counter.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+
+	copied := *counter
+	return &copied, nil
+}
+
+func (ms *memoryStore) Delete(_ context.Context, key string) error {
+	ms.mu.Lock()
+	delete(ms.counters, key)
+	ms.mu.Unlock()
+
+	return nil
+}
+
+func (ms *memoryStore) cleanup(now time.Time) {
+	if now.Sub(ms.lastCleanup) < memoryCleanupPeriod {
+		return
+	}
+
+	for key, counter := range ms.counters {
+		if !counter.ExpiresAt.After(now) {
+			delete(ms.counters, key)
+		}
+	}
+	ms.lastCleanup = now
+}
@@ -0,0 +1,244 @@
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+)
+
+// primaryLSNQuery is how far the primary has written.
+const primaryLSNQuery = `SELECT pg_current_wal_lsn()::text`
+
+// lagQuery tells whether the replica still receives WAL, whether it has
+// replayed the primary's LSN given as $1 and the age of the last
+// transaction it replayed in seconds. A replica caught up with an idle
+// primary replays nothing, the age only counts when it's behind.
+const lagQuery = `SELECT
+	COALESCE((SELECT status = 'streaming' FROM pg_stat_wal_receiver), false),
+	COALESCE(pg_last_wal_replay_lsn() >= $1::pg_lsn, false),
+	COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)`
+
+var errNotStreaming = errors.New("wal receiver is not streaming")
+
+type Config struct {
+	// a replica lagging more gets no reads until it catches up
+	MaxLag      time.Duration
+	CheckPeriod time.Duration
+	// how long a client reads from the primary after writing,
+	// MaxLag or more for the client to always see its writes
+	StickyFor time.Duration
+}
+
+type primaryKey struct{}
+
+// WithPrimary makes the queries run with ctx read from the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func onPrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+type replica struct {
+	name    string
+	db      *sql.DB
+	healthy atomic.Bool
+}
+
+// router sends writes and transactions to the primary, the connection
+// it is used on, and spreads reads over the replicas keeping up with it.
+type router struct {
+	dialectors []gorm.Dialector
+	replicas   []*replica
+	primary    *sql.DB
+	cfg        Config
+}
+
+// NewRouter takes the replicas as name and dialector, names are for logs.
+// They get reads only after RunLagChecks has seen them keep up.
+func NewRouter(dialectors map[string]gorm.Dialector, cfg Config) *router {
+	r := &router{
+		cfg: cfg,
+	}
+
+	for name, dialector := range dialectors {
+		r.dialectors = append(r.dialectors, dialector)
+		r.replicas = append(r.replicas, &replica{name: name})
+	}
+
+	return r
+}
+
+func (r *router) Name() string {
+	return "replica"
+}
+
+func (r *router) Initialize(db *gorm.DB) error {
+	if len(r.replicas) == 0 {
+		return nil
+	}
+
+	var err error
+	r.primary, err = db.DB()
+	if err != nil {
+		return errors.Wrap(err, "primary")
+	}
+
+	pools := make([]gorm.Dialector, len(r.replicas))
+	for i, rep := range r.replicas {
+		// a replica down at start must not keep the server from starting
+		replicaDB, err := gorm.Open(r.dialectors[i], &gorm.Config{Logger: db.Logger, DisableAutomaticPing: true})
+		if err != nil {
+			return errors.Wrapf(err, "replica %s", rep.name)
+		}
+
+		rep.db, err = replicaDB.DB()
+		if err != nil {
+			return errors.Wrapf(err, "replica %s", rep.name)
+		}
+		pools[i] = postgres.New(postgres.Config{Conn: rep.db})
+	}
+
+	err = db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: pools,
+		Policy:   r,
+	}))
+	if err != nil {
+		return err
+	}
+
+	// dbresolver is first too, of the callbacks before "*" the one registered last runs first
+	cb := db.Callback()
+	errs := []error{
+		cb.Query().Before("*").Register("replica:route", r.route),
+		cb.Row().Before("*").Register("replica:route", r.route),
+		cb.Raw().Before("*").Register("replica:route", r.route),
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// route keeps a read on the primary when the client has just written
+// or no replica is fit for it.
+func (r *router) route(db *gorm.DB) {
+	if onPrimary(db.Statement.Context) || len(r.healthy(nil)) == 0 {
+		dbresolver.Write.ModifyStatement(db.Statement)
+	}
+}
+
+// Resolve picks one of the healthy replicas, dbresolver asks only when there are several.
+func (r *router) Resolve(pools []gorm.ConnPool) gorm.ConnPool {
+	healthy := r.healthy(pools)
+	if len(healthy) == 0 {
+		// the check flipped after route, one more stale read is fine
+		return pools[rand.Intn(len(pools))]
+	}
+
+	return healthy[rand.Intn(len(healthy))]
+}
+
+// healthy filters pools down to the healthy replicas, all of them with nil pools.
+func (r *router) healthy(pools []gorm.ConnPool) []gorm.ConnPool {
+	var healthy []gorm.ConnPool
+	for _, rep := range r.replicas {
+		if !rep.healthy.Load() {
+			continue
+		}
+
+		if pools == nil {
+			healthy = append(healthy, rep.db)
+			continue
+		}
+		for _, pool := range pools {
+			if pool == rep.db {
+				healthy = append(healthy, pool)
+			}
+		}
+	}
+
+	return healthy
+}
+
+// RunLagChecks measures the replication lag of every replica until ctx is done.
+func (r *router) RunLagChecks(ctx context.Context) {
+	ticker := time.NewTicker(r.cfg.CheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		for _, rep := range r.replicas {
+			r.check(ctx, rep)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *router) check(ctx context.Context, rep *replica) {
+	ctx, cancel := context.WithTimeout(ctx, r.cfg.CheckPeriod)
+	defer cancel()
+
+	lag, err := r.lag(ctx, rep)
+
+	healthy := err == nil && lag <= r.cfg.MaxLag
+	if rep.healthy.Swap(healthy) == healthy {
+		return
+	}
+
+	switch {
+	case healthy:
+		logger.Ctx(ctx, "replica").Info("replica takes reads", zap.String("replica", rep.name), zap.Duration("lag", lag))
+	case err != nil:
+		logger.Ctx(ctx, "replica").Warn("replica is unavailable, reading from the primary", zap.String("replica", rep.name), zap.Error(err))
+	default:
+		logger.Ctx(ctx, "replica").Warn("replica lags, reading from the primary", zap.String("replica", rep.name), zap.Duration("lag", lag))
+	}
+}
+
+// lag is zero for a replica that has replayed what the primary had written
+// just before, otherwise the age of the last transaction it replayed.
+// A replica cut off from the primary fails, however little it lags yet.
+func (r *router) lag(ctx context.Context, rep *replica) (time.Duration, error) {
+	var primaryLSN string
+	err := r.primary.QueryRowContext(ctx, primaryLSNQuery).Scan(&primaryLSN)
+	if err != nil {
+		return 0, errors.Wrap(err, "primary lsn")
+	}
+
+	var streaming, caughtUp bool
+	var lagSeconds float64
+	err = rep.db.QueryRowContext(ctx, lagQuery, primaryLSN).Scan(&streaming, &caughtUp, &lagSeconds)
+	if err != nil {
+		return 0, errors.Wrap(err, "replica lag")
+	} else if !streaming {
+		return 0, errNotStreaming
+	} else if caughtUp {
+		return 0, nil
+	}
+
+	return time.Duration(lagSeconds * float64(time.Second)), nil
+}
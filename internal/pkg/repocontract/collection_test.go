@@ -0,0 +1,55 @@
+package repocontract
+
+import (
+	"testing"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+func (b *backend) createCollection(t *testing.T, userId uint64, postIds ...uint64) *model.Collection {
+	t.Helper()
+
+	collection := &model.Collection{UserID: userId, Name: "collection"}
+
+	err := b.collections.CreateCollection(ctx, collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, postId := range postIds {
+		assertNoError(t, b.collections.AddPost(ctx, collection.ID, postId))
+	}
+
+	return collection
+}
+
+func TestCollectionSaves(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		first := b.createPost(t, alice.ID, "female", "dress")
+		second := b.createPost(t, alice.ID, "female", "dress")
+		third := b.createPost(t, alice.ID, "female", "dress")
+
+		// bob saves the first post twice, it still counts once
+		b.createCollection(t, bob.ID, first.ID, second.ID)
+		b.createCollection(t, bob.ID, first.ID)
+		b.createCollection(t, alice.ID, first.ID, third.ID)
+
+		saved, err := b.collections.GetSavedPosts(ctx, bob.ID, []uint64{first.ID, third.ID, third.ID + 100})
+		assertNoError(t, err)
+		assertEqual(t, "bob's saves", len(saved), 1)
+		assertEqual(t, "first saved", saved[first.ID], true)
+
+		cnts, err := b.collections.GetSaveCnts(ctx, []uint64{first.ID, second.ID, third.ID + 100})
+		assertNoError(t, err)
+		assertEqual(t, "saved posts", len(cnts), 2)
+		assertEqual(t, "first post", cnts[first.ID], 2)
+		assertEqual(t, "second post", cnts[second.ID], 1)
+
+		cnts, err = b.collections.GetSaveCnts(ctx, nil)
+		assertNoError(t, err)
+		assertEqual(t, "no posts", len(cnts), 0)
+	})
+}
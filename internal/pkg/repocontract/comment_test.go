@@ -0,0 +1,117 @@
+package repocontract
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+func commentID(comment *model.Comment) uint64 {
+	return comment.ID
+}
+
+func TestCommentCreateAndGet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		post := b.createPost(t, alice.ID, "female", "dress")
+		before := time.Now().Add(-time.Second)
+
+		comment := b.createComment(t, alice.ID, post.ID, "nice")
+		if comment.ID == 0 {
+			t.Fatal("no id given")
+		}
+
+		got, err := b.comments.GetComment(ctx, comment.ID)
+		assertNoError(t, err)
+		assertEqual(t, "user", got.UserID, alice.ID)
+		assertEqual(t, "post", got.PostID, post.ID)
+		assertEqual(t, "body", got.Body, "nice")
+		assertEqual(t, "hidden", got.IsHidden, false)
+		if got.Date.Before(before) || got.Date.After(time.Now().Add(time.Second)) {
+			t.Fatalf("date = %v, want about now", got.Date)
+		}
+
+		_, err = b.comments.GetComment(ctx, comment.ID+100)
+		assertNotFound(t, err)
+	})
+}
+
+func TestCommentVisibility(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		post := b.createPost(t, alice.ID, "female", "dress")
+		other := b.createPost(t, alice.ID, "female", "dress")
+
+		first := b.createComment(t, alice.ID, post.ID, "first")
+		hidden := b.createComment(t, alice.ID, post.ID, "hidden")
+		bobs := b.createComment(t, bob.ID, post.ID, "bob's")
+		b.createComment(t, alice.ID, other.ID, "elsewhere")
+
+		assertNoError(t, b.comments.SetCommentHidden(ctx, hidden.ID, true))
+
+		comments, err := b.comments.GetPostComments(ctx, post.ID)
+		assertNoError(t, err)
+		assertIDs(t, "comments", comments, commentID, bobs.ID, first.ID)
+
+		b.ban(t, bob.ID)
+
+		comments, err = b.comments.GetPostComments(ctx, post.ID)
+		assertNoError(t, err)
+		assertIDs(t, "comments after the ban", comments, commentID, first.ID)
+
+		assertNoError(t, b.comments.SetCommentHidden(ctx, hidden.ID, false))
+
+		comments, err = b.comments.GetPostComments(ctx, post.ID)
+		assertNoError(t, err)
+		assertIDs(t, "comments after unhiding", comments, commentID, hidden.ID, first.ID)
+	})
+}
+
+func TestCommentUsersComments(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		post := b.createPost(t, alice.ID, "female", "dress")
+
+		first := b.createComment(t, bob.ID, post.ID, "first")
+		b.createComment(t, alice.ID, post.ID, "alice's")
+		hidden := b.createComment(t, bob.ID, post.ID, "hidden")
+		assertNoError(t, b.comments.SetCommentHidden(ctx, hidden.ID, true))
+
+		// the owner's own data has them all, oldest first
+		comments, err := b.comments.GetAllUsersComments(ctx, bob.ID)
+		assertNoError(t, err)
+		assertIDs(t, "bob's comments", comments, commentID, first.ID, hidden.ID)
+
+		assertNoError(t, b.comments.DeleteUsersComments(ctx, bob.ID))
+
+		comments, err = b.comments.GetAllUsersComments(ctx, bob.ID)
+		assertNoError(t, err)
+		assertIDs(t, "bob's comments left", comments, commentID)
+
+		comments, err = b.comments.GetAllUsersComments(ctx, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "alice's comments left", len(comments), 1)
+	})
+}
+
+func TestCommentDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		post := b.createPost(t, alice.ID, "female", "dress")
+
+		deleted := b.createComment(t, alice.ID, post.ID, "deleted")
+		kept := b.createComment(t, alice.ID, post.ID, "kept")
+
+		assertNoError(t, b.comments.DeleteComment(ctx, deleted.ID))
+
+		_, err := b.comments.GetComment(ctx, deleted.ID)
+		assertNotFound(t, err)
+
+		comments, err := b.comments.GetPostComments(ctx, post.ID)
+		assertNoError(t, err)
+		assertIDs(t, "comments", comments, commentID, kept.ID)
+	})
+}
@@ -0,0 +1,38 @@
+package repocontract
+
+import (
+	"testing"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+func TestFollowCreate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		carol := b.createUser(t, "carol")
+
+		assertNoError(t, b.follows.Create(ctx, alice.ID, bob.ID))
+		assertNoError(t, b.follows.Create(ctx, carol.ID, bob.ID))
+		assertNoError(t, b.follows.Create(ctx, alice.ID, carol.ID))
+
+		// following twice is a conflict, not a database error
+		err := b.follows.Create(ctx, alice.ID, bob.ID)
+		if !errors.Is(err, model.ErrConflictFriend) {
+			t.Fatalf("second follow error = %v, want %v", err, model.ErrConflictFriend)
+		}
+
+		following, err := b.follows.IsFollowing(ctx, alice.ID, bob.ID)
+		assertNoError(t, err)
+		assertEqual(t, "following", following, true)
+
+		followers, err := b.follows.GetFollowers(ctx, bob.ID)
+		assertNoError(t, err)
+		assertEqual(t, "followers", len(followers), 2)
+
+		ids, err := b.follows.GetFollowing(ctx, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "following", len(ids), 2)
+	})
+}
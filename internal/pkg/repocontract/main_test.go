@@ -0,0 +1,286 @@
+package repocontract
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	collectionRepository "github.com/ell1jah/bmstu_web/internal/collection/repository"
+	commentRepository "github.com/ell1jah/bmstu_web/internal/comment/repository"
+	followRepository "github.com/ell1jah/bmstu_web/internal/follow/repository"
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/internal/pkg/pgtest"
+	postRepository "github.com/ell1jah/bmstu_web/internal/post/repository"
+	rateRepository "github.com/ell1jah/bmstu_web/internal/rate/repository"
+	userRepository "github.com/ell1jah/bmstu_web/internal/user/repository"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+	pgtest.Main(m)
+}
+
+type userRepo interface {
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error)
+	GetUserByLogin(ctx context.Context, login string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	UpdatePassword(ctx context.Context, id uint64, password string) error
+	UpdateProfile(ctx context.Context, user *model.User) (*model.User, error)
+	UpdateEmail(ctx context.Context, id uint64, email string, verified bool) error
+	UpdateRole(ctx context.Context, id uint64, role string) error
+	UpdateStatus(ctx context.Context, status *model.UserStatus) error
+	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
+
+	CreateToken(ctx context.Context, token *model.UserToken) error
+	GetToken(ctx context.Context, purpose, hash string) (*model.UserToken, error)
+	UseToken(ctx context.Context, purpose, hash string) (*model.UserToken, error)
+
+	GetTOTP(ctx context.Context, userId uint64) (*model.UserTOTP, error)
+	SaveTOTP(ctx context.Context, userTOTP *model.UserTOTP) error
+	EnableTOTP(ctx context.Context, userId uint64, lastStep int64, codeHashes []string) error
+	DeleteTOTP(ctx context.Context, userId uint64) error
+	UseTOTPStep(ctx context.Context, userId uint64, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userId uint64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId uint64, codeHash string) error
+
+	CreateOIDCLogin(ctx context.Context, login *model.OIDCLogin) error
+	UseOIDCLogin(ctx context.Context, stateHash string) (*model.OIDCLogin, error)
+	GetIdentity(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+	GetUserIdentities(ctx context.Context, userId uint64) ([]*model.UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *model.UserIdentity) error
+	DeleteIdentity(ctx context.Context, userId uint64, provider string) error
+
+	CreateAPIToken(ctx context.Context, token *model.APIToken) error
+	GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error)
+	GetUserAPITokens(ctx context.Context, userId uint64) ([]*model.APIToken, error)
+	TouchAPIToken(ctx context.Context, id uint64) error
+	DeleteAPIToken(ctx context.Context, userId, id uint64) error
+
+	RequestDeletion(ctx context.Context, userId uint64) error
+	ClaimDeletion(ctx context.Context, lease time.Duration) (uint64, error)
+	FinishDeletion(ctx context.Context, userId uint64) error
+	AnonymizeUser(ctx context.Context, userId uint64, login string) error
+	DeleteUser(ctx context.Context, userId uint64) error
+}
+
+type postRepo interface {
+	GetPost(ctx context.Context, postId uint64) (*model.Post, error)
+	GetUsersPosts(ctx context.Context, ownerId uint64) ([]*model.Post, error)
+	GetAllUsersPosts(ctx context.Context, ownerId uint64) ([]*model.Post, error)
+	IsImageUsed(ctx context.Context, imageId string) (bool, error)
+	GetUsersPostsCnt(ctx context.Context, ownerId uint64) (int, error)
+	GetPostsWithParams(ctx context.Context, params model.PostParams) ([]*model.Post, error)
+	GetFollowingPosts(ctx context.Context, followerId uint64, params model.PostParams) ([]*model.Post, error)
+	CreatePost(ctx context.Context, post *model.Post) error
+	SetPostHidden(ctx context.Context, postId uint64, hidden bool) error
+	DeletePost(ctx context.Context, postId uint64) error
+	GetPostStats(ctx context.Context, since time.Time) ([]*model.PostStats, error)
+	SaveScores(ctx context.Context, scores []*model.PostScore) error
+	ClaimScoring(ctx context.Context, lease time.Duration) error
+}
+
+type rateRepo interface {
+	GetRate(ctx context.Context, userId, postId uint64) (model.Rate, error)
+	GetRatesCnts(ctx context.Context, postId uint64) (model.RatesCnts, error)
+	GetUsersRatesCnts(ctx context.Context, ownerId uint64) (model.RatesCnts, error)
+	GetUsersRates(ctx context.Context, userId uint64) ([]*model.PostRate, error)
+	GetPostsRates(ctx context.Context, userId uint64, postIds []uint64) (map[uint64]model.Rate, error)
+	GetPostsRatesCnts(ctx context.Context, postIds []uint64) (map[uint64]model.RatesCnts, error)
+	Create(ctx context.Context, userId, postId uint64, rate model.Rate) error
+	Update(ctx context.Context, userId, postId uint64, rate model.Rate) error
+	Delete(ctx context.Context, userId, postId uint64) error
+	DeleteUsersRates(ctx context.Context, userId uint64) error
+}
+
+type commentRepo interface {
+	GetComment(ctx context.Context, commentId uint64) (*model.Comment, error)
+	GetPostComments(ctx context.Context, postId uint64) ([]*model.Comment, error)
+	GetAllUsersComments(ctx context.Context, userId uint64) ([]*model.Comment, error)
+	CreateComment(ctx context.Context, comment *model.Comment) error
+	SetCommentHidden(ctx context.Context, commentId uint64, hidden bool) error
+	DeleteComment(ctx context.Context, commentId uint64) error
+	DeleteUsersComments(ctx context.Context, userId uint64) error
+}
+
+type collectionRepo interface {
+	CreateCollection(ctx context.Context, collection *model.Collection) error
+	AddPost(ctx context.Context, collectionId, postId uint64) error
+	GetSavedPosts(ctx context.Context, userId uint64, postIds []uint64) (map[uint64]bool, error)
+	GetSaveCnts(ctx context.Context, postIds []uint64) (map[uint64]int, error)
+}
+
+type followRepo interface {
+	IsFollowing(ctx context.Context, followerId, followeeId uint64) (bool, error)
+	GetFollowers(ctx context.Context, followeeId uint64) ([]uint64, error)
+	GetFollowing(ctx context.Context, followerId uint64) ([]uint64, error)
+	Create(ctx context.Context, followerId, followeeId uint64) error
+}
+
+// backend is one storage with all the repositories on it, the contract
+// holds for every backend alike.
+type backend struct {
+	users       userRepo
+	posts       postRepo
+	rates       rateRepo
+	comments    commentRepo
+	collections collectionRepo
+	follows     followRepo
+}
+
+func newMemoryBackend(t *testing.T) *backend {
+	db := memdb.New()
+
+	return &backend{
+		users:       userRepository.NewMemoryRepo(db),
+		posts:       postRepository.NewMemoryRepo(db),
+		rates:       rateRepository.NewMemoryRepo(db),
+		comments:    commentRepository.NewMemoryRepo(db),
+		collections: collectionRepository.NewMemoryRepo(db),
+		follows:     followRepository.NewMemoryRepo(db),
+	}
+}
+
+func newPgBackend(t *testing.T) *backend {
+	db := pgtest.New(t)
+
+	return &backend{
+		users:       userRepository.NewPgRepo(db),
+		posts:       postRepository.NewPgRepo(db),
+		rates:       rateRepository.NewPgRepo(db),
+		comments:    commentRepository.NewPgRepo(db),
+		collections: collectionRepository.NewPgRepo(db),
+		follows:     followRepository.NewPgRepo(db),
+	}
+}
+
+// forEachBackend runs test on an empty backend of every kind.
+func forEachBackend(t *testing.T, test func(t *testing.T, b *backend)) {
+	backends := []struct {
+		name string
+		new  func(t *testing.T) *backend
+	}{
+		{"memory", newMemoryBackend},
+		{"postgres", newPgBackend},
+	}
+
+	for _, bk := range backends {
+		bk := bk
+		t.Run(bk.name, func(t *testing.T) {
+			test(t, bk.new(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+func (b *backend) createUser(t *testing.T, login string) *model.User {
+	t.Helper()
+
+	user, err := b.users.CreateUser(ctx, &model.User{
+		Login:       login,
+		Password:    "hash of " + login,
+		HasPassword: true,
+		Role:        model.RoleUser,
+		Status:      model.UserActive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+func (b *backend) createPost(t *testing.T, userId uint64, sex, category string) *model.Post {
+	t.Helper()
+
+	post := &model.Post{
+		UserID:      userId,
+		ImageID:     "img",
+		Category:    category,
+		Sex:         sex,
+		Brand:       "brand",
+		Description: "description",
+		Link:        "https://example.com",
+	}
+
+	err := b.posts.CreatePost(ctx, post)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return post
+}
+
+func (b *backend) createComment(t *testing.T, userId, postId uint64, body string) *model.Comment {
+	t.Helper()
+
+	comment := &model.Comment{UserID: userId, PostID: postId, Body: body}
+
+	err := b.comments.CreateComment(ctx, comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return comment
+}
+
+func (b *backend) ban(t *testing.T, userId uint64) {
+	t.Helper()
+
+	err := b.users.UpdateStatus(ctx, &model.UserStatus{ID: userId, Status: model.UserBanned, Reason: "spam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hash makes a value fitting the CHAR(64) hash columns.
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func assertNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+
+	if !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("err = %v, want %v", err, model.ErrNotFound)
+	}
+}
+
+func assertEqual[T comparable](t *testing.T, what string, got, want T) {
+	t.Helper()
+
+	if got != want {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+}
+
+func assertIDs[T any](t *testing.T, what string, rows []T, id func(row T) uint64, want ...uint64) {
+	t.Helper()
+
+	got := make([]uint64, len(rows))
+	for i, row := range rows {
+		got[i] = id(row)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("%s = %v, want %v", what, got, want)
+		}
+	}
+}
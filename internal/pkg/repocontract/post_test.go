@@ -0,0 +1,285 @@
+package repocontract
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+func postID(post *model.Post) uint64 {
+	return post.ID
+}
+
+func TestPostCreateAndGet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		before := time.Now().Add(-time.Second)
+
+		post := b.createPost(t, alice.ID, "female", "dress")
+		if post.ID == 0 {
+			t.Fatal("no id given")
+		}
+
+		got, err := b.posts.GetPost(ctx, post.ID)
+		assertNoError(t, err)
+		assertEqual(t, "user", got.UserID, alice.ID)
+		assertEqual(t, "image", got.ImageID, "img")
+		assertEqual(t, "sex", got.Sex, "female")
+		assertEqual(t, "category", got.Category, "dress")
+		assertEqual(t, "brand", got.Brand, "brand")
+		assertEqual(t, "description", got.Description, "description")
+		assertEqual(t, "link", got.Link, "https://example.com")
+		assertEqual(t, "hidden", got.IsHidden, false)
+		if got.Date.Before(before) || got.Date.After(time.Now().Add(time.Second)) {
+			t.Fatalf("date = %v, want about now", got.Date)
+		}
+
+		used, err := b.posts.IsImageUsed(ctx, "img")
+		assertNoError(t, err)
+		assertEqual(t, "image used", used, true)
+
+		_, err = b.posts.GetPost(ctx, post.ID+100)
+		assertNotFound(t, err)
+	})
+}
+
+func TestPostVisibility(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		first := b.createPost(t, alice.ID, "female", "dress")
+		hidden := b.createPost(t, alice.ID, "female", "dress")
+		last := b.createPost(t, alice.ID, "female", "dress")
+		banned := b.createPost(t, bob.ID, "female", "dress")
+
+		assertNoError(t, b.posts.SetPostHidden(ctx, hidden.ID, true))
+
+		posts, err := b.posts.GetUsersPosts(ctx, alice.ID)
+		assertNoError(t, err)
+		assertIDs(t, "user's posts", posts, postID, last.ID, first.ID)
+
+		cnt, err := b.posts.GetUsersPostsCnt(ctx, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "user's post count", cnt, 2)
+
+		// the owner's own data has them all, oldest first
+		posts, err = b.posts.GetAllUsersPosts(ctx, alice.ID)
+		assertNoError(t, err)
+		assertIDs(t, "all user's posts", posts, postID, first.ID, hidden.ID, last.ID)
+
+		// hidden posts are still there for moderation
+		got, err := b.posts.GetPost(ctx, hidden.ID)
+		assertNoError(t, err)
+		assertEqual(t, "hidden", got.IsHidden, true)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{})
+		assertNoError(t, err)
+		assertIDs(t, "posts", posts, postID, banned.ID, last.ID, first.ID)
+
+		b.ban(t, bob.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{})
+		assertNoError(t, err)
+		assertIDs(t, "posts after the ban", posts, postID, last.ID, first.ID)
+
+		posts, err = b.posts.GetUsersPosts(ctx, bob.ID)
+		assertNoError(t, err)
+		assertIDs(t, "banned user's posts", posts, postID)
+
+		assertNoError(t, b.posts.SetPostHidden(ctx, hidden.ID, false))
+
+		cnt, err = b.posts.GetUsersPostsCnt(ctx, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "user's post count after unhiding", cnt, 3)
+	})
+}
+
+func TestPostParams(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+
+		dress := b.createPost(t, alice.ID, "female", "dress")
+		shirt := b.createPost(t, alice.ID, "male", "shirt")
+		skirt := b.createPost(t, alice.ID, "female", "skirt")
+		otherDress := b.createPost(t, alice.ID, "female", "dress")
+
+		posts, err := b.posts.GetPostsWithParams(ctx, model.PostParams{Sex: "female"})
+		assertNoError(t, err)
+		assertIDs(t, "female", posts, postID, otherDress.ID, skirt.ID, dress.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Sex: "female", Category: "dress"})
+		assertNoError(t, err)
+		assertIDs(t, "female dresses", posts, postID, otherDress.ID, dress.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Category: "shirt"})
+		assertNoError(t, err)
+		assertIDs(t, "shirts", posts, postID, shirt.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Limit: 2, Offset: 1})
+		assertNoError(t, err)
+		assertIDs(t, "second page", posts, postID, skirt.ID, shirt.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Limit: 2, Offset: 4})
+		assertNoError(t, err)
+		assertIDs(t, "page past the end", posts, postID)
+	})
+}
+
+func TestPostFeed(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		carol := b.createUser(t, "carol")
+
+		bobs := b.createPost(t, bob.ID, "male", "shirt")
+		b.createPost(t, carol.ID, "female", "dress")
+		bobsDress := b.createPost(t, bob.ID, "female", "dress")
+		b.createPost(t, alice.ID, "female", "dress")
+
+		posts, err := b.posts.GetFollowingPosts(ctx, alice.ID, model.PostParams{})
+		assertNoError(t, err)
+		assertIDs(t, "feed without follows", posts, postID)
+
+		assertNoError(t, b.follows.Create(ctx, alice.ID, bob.ID))
+
+		posts, err = b.posts.GetFollowingPosts(ctx, alice.ID, model.PostParams{})
+		assertNoError(t, err)
+		assertIDs(t, "feed", posts, postID, bobsDress.ID, bobs.ID)
+
+		posts, err = b.posts.GetFollowingPosts(ctx, alice.ID, model.PostParams{Category: "shirt"})
+		assertNoError(t, err)
+		assertIDs(t, "feed of shirts", posts, postID, bobs.ID)
+
+		posts, err = b.posts.GetFollowingPosts(ctx, alice.ID, model.PostParams{Limit: 1})
+		assertNoError(t, err)
+		assertIDs(t, "feed page", posts, postID, bobsDress.ID)
+
+		b.ban(t, bob.ID)
+
+		posts, err = b.posts.GetFollowingPosts(ctx, alice.ID, model.PostParams{})
+		assertNoError(t, err)
+		assertIDs(t, "feed after the ban", posts, postID)
+	})
+}
+
+func TestPostRanking(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		carol := b.createUser(t, "carol")
+		before := time.Now().Add(-time.Second)
+
+		liked := b.createPost(t, alice.ID, "female", "dress")
+		commented := b.createPost(t, alice.ID, "female", "dress")
+		disliked := b.createPost(t, alice.ID, "female", "dress")
+		shirt := b.createPost(t, alice.ID, "male", "shirt")
+
+		assertNoError(t, b.rates.Create(ctx, bob.ID, liked.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, carol.ID, liked.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, bob.ID, disliked.ID, model.Dislike))
+		b.createComment(t, bob.ID, commented.ID, "nice")
+		hidden := b.createComment(t, carol.ID, commented.ID, "spam")
+		assertNoError(t, b.comments.SetCommentHidden(ctx, hidden.ID, true))
+
+		stats, err := b.posts.GetPostStats(ctx, before)
+		assertNoError(t, err)
+		assertIDs(t, "stats", stats, func(st *model.PostStats) uint64 { return st.PostID },
+			liked.ID, commented.ID, disliked.ID, shirt.ID)
+		assertEqual(t, "likes", *stats[0], model.PostStats{PostID: liked.ID, Date: stats[0].Date, LikeCnt: 2})
+		assertEqual(t, "comments", *stats[1], model.PostStats{PostID: commented.ID, Date: stats[1].Date, CommentCnt: 1})
+		assertEqual(t, "dislikes", *stats[2], model.PostStats{PostID: disliked.ID, Date: stats[2].Date, DislikeCnt: 1})
+
+		stats, err = b.posts.GetPostStats(ctx, time.Now().Add(time.Second))
+		assertNoError(t, err)
+		assertEqual(t, "stats of the future", len(stats), 0)
+
+		// the shirt isn't scored yet
+		assertNoError(t, b.posts.SaveScores(ctx, []*model.PostScore{
+			{PostID: liked.ID, Score: 2, Hot: 3},
+			{PostID: commented.ID, Score: 1, Hot: 5},
+			{PostID: disliked.ID, Score: -1, Hot: 1},
+		}))
+
+		posts, err := b.posts.GetPostsWithParams(ctx, model.PostParams{Sort: model.SortHot})
+		assertNoError(t, err)
+		assertIDs(t, "hot", posts, postID, commented.ID, liked.ID, disliked.ID, shirt.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Sort: model.SortTop, Since: before})
+		assertNoError(t, err)
+		assertIDs(t, "top", posts, postID, liked.ID, commented.ID, shirt.ID, disliked.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Sort: model.SortTop, Sex: "female", Limit: 2})
+		assertNoError(t, err)
+		assertIDs(t, "top female page", posts, postID, liked.ID, commented.ID)
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Sort: model.SortTop, Since: time.Now().Add(time.Second)})
+		assertNoError(t, err)
+		assertIDs(t, "top of the future", posts, postID)
+
+		// scoring again replaces the scores
+		assertNoError(t, b.posts.SaveScores(ctx, []*model.PostScore{{PostID: commented.ID, Score: 1, Hot: 2}}))
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Sort: model.SortHot, Category: "dress"})
+		assertNoError(t, err)
+		assertIDs(t, "hot dresses", posts, postID, liked.ID, commented.ID, disliked.ID)
+
+		assertNoError(t, b.follows.Create(ctx, bob.ID, alice.ID))
+
+		posts, err = b.posts.GetFollowingPosts(ctx, bob.ID, model.PostParams{Sort: model.SortHot, Limit: 1})
+		assertNoError(t, err)
+		assertIDs(t, "hot feed", posts, postID, liked.ID)
+
+		// the score goes with the post
+		assertNoError(t, b.posts.DeletePost(ctx, liked.ID))
+
+		posts, err = b.posts.GetPostsWithParams(ctx, model.PostParams{Sort: model.SortHot})
+		assertNoError(t, err)
+		assertIDs(t, "hot after the delete", posts, postID, commented.ID, disliked.ID, shirt.ID)
+	})
+}
+
+func TestPostClaimScoring(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		// a claimed scoring is skipped for the lease
+		assertNoError(t, b.posts.ClaimScoring(ctx, time.Hour))
+		assertNotFound(t, b.posts.ClaimScoring(ctx, time.Hour))
+	})
+
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		// an expired lease is claimed again
+		assertNoError(t, b.posts.ClaimScoring(ctx, -time.Minute))
+		assertNoError(t, b.posts.ClaimScoring(ctx, time.Hour))
+		assertNotFound(t, b.posts.ClaimScoring(ctx, time.Hour))
+	})
+}
+
+func TestPostDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		post := b.createPost(t, alice.ID, "female", "dress")
+		kept := b.createPost(t, alice.ID, "female", "dress")
+		comment := b.createComment(t, bob.ID, post.ID, "nice")
+		assertNoError(t, b.rates.Create(ctx, bob.ID, post.ID, model.Like))
+
+		assertNoError(t, b.posts.DeletePost(ctx, post.ID))
+
+		_, err := b.posts.GetPost(ctx, post.ID)
+		assertNotFound(t, err)
+		_, err = b.posts.GetPost(ctx, kept.ID)
+		assertNoError(t, err)
+
+		// the comments and rates go with the post
+		_, err = b.comments.GetComment(ctx, comment.ID)
+		assertNotFound(t, err)
+		_, err = b.rates.GetRate(ctx, bob.ID, post.ID)
+		assertNotFound(t, err)
+
+		rates, err := b.rates.GetUsersRates(ctx, bob.ID)
+		assertNoError(t, err)
+		assertEqual(t, "rates", len(rates), 0)
+	})
+}
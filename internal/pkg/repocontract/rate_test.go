@@ -0,0 +1,150 @@
+package repocontract
+
+import (
+	"testing"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+func TestRateLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		post := b.createPost(t, alice.ID, "female", "dress")
+
+		_, err := b.rates.GetRate(ctx, bob.ID, post.ID)
+		assertNotFound(t, err)
+
+		assertNoError(t, b.rates.Create(ctx, bob.ID, post.ID, model.Like))
+		if b.rates.Create(ctx, bob.ID, post.ID, model.Dislike) == nil {
+			t.Fatal("rated the same post twice")
+		}
+
+		rate, err := b.rates.GetRate(ctx, bob.ID, post.ID)
+		assertNoError(t, err)
+		assertEqual(t, "rate", rate, model.Like)
+
+		// a dislike is the zero value and still has to be written
+		assertNoError(t, b.rates.Update(ctx, bob.ID, post.ID, model.Dislike))
+		rate, err = b.rates.GetRate(ctx, bob.ID, post.ID)
+		assertNoError(t, err)
+		assertEqual(t, "updated rate", rate, model.Dislike)
+
+		assertNoError(t, b.rates.Update(ctx, bob.ID, post.ID, model.Like))
+		rate, err = b.rates.GetRate(ctx, bob.ID, post.ID)
+		assertNoError(t, err)
+		assertEqual(t, "rate updated back", rate, model.Like)
+
+		assertNotFound(t, b.rates.Update(ctx, alice.ID, post.ID, model.Like))
+
+		assertNoError(t, b.rates.Delete(ctx, bob.ID, post.ID))
+		_, err = b.rates.GetRate(ctx, bob.ID, post.ID)
+		assertNotFound(t, err)
+	})
+}
+
+func TestRateCounts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		carol := b.createUser(t, "carol")
+
+		first := b.createPost(t, alice.ID, "female", "dress")
+		second := b.createPost(t, alice.ID, "female", "dress")
+		bobs := b.createPost(t, bob.ID, "male", "shirt")
+
+		assertNoError(t, b.rates.Create(ctx, bob.ID, first.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, carol.ID, first.ID, model.Dislike))
+		assertNoError(t, b.rates.Create(ctx, bob.ID, second.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, carol.ID, second.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, alice.ID, bobs.ID, model.Dislike))
+
+		// the counts of one post don't take in the posts next to it
+		cnts, err := b.rates.GetRatesCnts(ctx, first.ID)
+		assertNoError(t, err)
+		assertEqual(t, "first post", cnts, model.RatesCnts{LikeCnt: 1, DislikeCnt: 1})
+
+		cnts, err = b.rates.GetRatesCnts(ctx, second.ID)
+		assertNoError(t, err)
+		assertEqual(t, "second post", cnts, model.RatesCnts{LikeCnt: 2})
+
+		cnts, err = b.rates.GetRatesCnts(ctx, bobs.ID+100)
+		assertNoError(t, err)
+		assertEqual(t, "missing post", cnts, model.RatesCnts{})
+
+		cnts, err = b.rates.GetUsersRatesCnts(ctx, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "alice's posts", cnts, model.RatesCnts{LikeCnt: 3, DislikeCnt: 1})
+
+		cnts, err = b.rates.GetUsersRatesCnts(ctx, bob.ID)
+		assertNoError(t, err)
+		assertEqual(t, "bob's posts", cnts, model.RatesCnts{DislikeCnt: 1})
+
+		cnts, err = b.rates.GetUsersRatesCnts(ctx, carol.ID)
+		assertNoError(t, err)
+		assertEqual(t, "carol's posts", cnts, model.RatesCnts{})
+	})
+}
+
+func TestRateUsersRates(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		first := b.createPost(t, alice.ID, "female", "dress")
+		second := b.createPost(t, alice.ID, "female", "dress")
+
+		assertNoError(t, b.rates.Create(ctx, bob.ID, second.ID, model.Dislike))
+		assertNoError(t, b.rates.Create(ctx, bob.ID, first.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, alice.ID, first.ID, model.Like))
+
+		rates, err := b.rates.GetUsersRates(ctx, bob.ID)
+		assertNoError(t, err)
+		assertIDs(t, "bob's rates", rates, func(r *model.PostRate) uint64 { return r.PostID }, first.ID, second.ID)
+		assertEqual(t, "first rate", rates[0].Rate, model.Like)
+		assertEqual(t, "second rate", rates[1].Rate, model.Dislike)
+
+		assertNoError(t, b.rates.DeleteUsersRates(ctx, bob.ID))
+
+		rates, err = b.rates.GetUsersRates(ctx, bob.ID)
+		assertNoError(t, err)
+		assertEqual(t, "bob's rates left", len(rates), 0)
+
+		cnts, err := b.rates.GetRatesCnts(ctx, first.ID)
+		assertNoError(t, err)
+		assertEqual(t, "first post", cnts, model.RatesCnts{LikeCnt: 1})
+	})
+}
+
+func TestRatePostsRates(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		first := b.createPost(t, alice.ID, "female", "dress")
+		second := b.createPost(t, alice.ID, "female", "dress")
+		third := b.createPost(t, alice.ID, "female", "dress")
+
+		assertNoError(t, b.rates.Create(ctx, bob.ID, first.ID, model.Like))
+		assertNoError(t, b.rates.Create(ctx, bob.ID, second.ID, model.Dislike))
+		assertNoError(t, b.rates.Create(ctx, alice.ID, second.ID, model.Dislike))
+		assertNoError(t, b.rates.Create(ctx, alice.ID, third.ID, model.Like))
+
+		// the posts outside the page and the unrated ones are left out
+		rates, err := b.rates.GetPostsRates(ctx, bob.ID, []uint64{first.ID, second.ID, third.ID + 100})
+		assertNoError(t, err)
+		assertEqual(t, "bob's rates", len(rates), 2)
+		assertEqual(t, "first rate", rates[first.ID], model.Like)
+		assertEqual(t, "second rate", rates[second.ID], model.Dislike)
+
+		cnts, err := b.rates.GetPostsRatesCnts(ctx, []uint64{second.ID, third.ID, third.ID + 100})
+		assertNoError(t, err)
+		assertEqual(t, "rated posts", len(cnts), 2)
+		assertEqual(t, "second post", cnts[second.ID], model.RatesCnts{DislikeCnt: 2})
+		assertEqual(t, "third post", cnts[third.ID], model.RatesCnts{LikeCnt: 1})
+
+		cnts, err = b.rates.GetPostsRatesCnts(ctx, nil)
+		assertNoError(t, err)
+		assertEqual(t, "no posts", len(cnts), 0)
+	})
+}
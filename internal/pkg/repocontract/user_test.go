@@ -0,0 +1,473 @@
+package repocontract
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+func TestUserCreateAndGet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		created, err := b.users.CreateUser(ctx, &model.User{
+			Login:       "alice",
+			Password:    "hash",
+			HasPassword: true,
+			Email:       "alice@example.com",
+			Role:        model.RoleUser,
+			Status:      model.UserActive,
+		})
+		assertNoError(t, err)
+		if created.ID == 0 {
+			t.Fatal("no id given")
+		}
+
+		byID, err := b.users.GetUserByID(ctx, created.ID)
+		assertNoError(t, err)
+		assertEqual(t, "login", byID.Login, "alice")
+		assertEqual(t, "password", byID.Password, "hash")
+		assertEqual(t, "has password", byID.HasPassword, true)
+		assertEqual(t, "email", byID.Email, "alice@example.com")
+		assertEqual(t, "role", byID.Role, model.RoleUser)
+		assertEqual(t, "status", byID.Status, model.UserActive)
+		if byID.CreatedAt.IsZero() {
+			t.Fatal("no creation time")
+		}
+
+		byLogin, err := b.users.GetUserByLogin(ctx, "alice")
+		assertNoError(t, err)
+		assertEqual(t, "id by login", byLogin.ID, created.ID)
+
+		byEmail, err := b.users.GetUserByEmail(ctx, "alice@example.com")
+		assertNoError(t, err)
+		assertEqual(t, "id by email", byEmail.ID, created.ID)
+
+		_, err = b.users.GetUserByID(ctx, created.ID+100)
+		assertNotFound(t, err)
+		_, err = b.users.GetUserByLogin(ctx, "bob")
+		assertNotFound(t, err)
+		_, err = b.users.GetUserByEmail(ctx, "bob@example.com")
+		assertNotFound(t, err)
+	})
+}
+
+func TestUserGetUsersByIDs(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+		carol := b.createUser(t, "carol")
+
+		// in the order asked for, the missing ones left out
+		users, err := b.users.GetUsersByIDs(ctx, []uint64{carol.ID, alice.ID + 100, alice.ID, bob.ID})
+		assertNoError(t, err)
+		assertIDs(t, "users", users, func(u *model.User) uint64 { return u.ID }, carol.ID, alice.ID, bob.ID)
+		assertEqual(t, "login", users[0].Login, "carol")
+
+		users, err = b.users.GetUsersByIDs(ctx, nil)
+		assertNoError(t, err)
+		assertIDs(t, "no users", users, func(u *model.User) uint64 { return u.ID })
+	})
+}
+
+func TestUserLoginIsUnique(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		b.createUser(t, "alice")
+
+		_, err := b.users.CreateUser(ctx, &model.User{
+			Login:  "alice",
+			Role:   model.RoleUser,
+			Status: model.UserActive,
+		})
+		if err == nil {
+			t.Fatal("second user with the same login created")
+		}
+	})
+}
+
+func TestUserUpdates(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+
+		assertNoError(t, b.users.UpdatePassword(ctx, user.ID, "new hash"))
+
+		_, err := b.users.UpdateProfile(ctx, &model.User{ID: user.ID, DisplayName: "Alice", Website: "https://alice.example.com"})
+		assertNoError(t, err)
+		_, err = b.users.UpdateProfile(ctx, &model.User{ID: user.ID + 100, DisplayName: "Nobody"})
+		assertNotFound(t, err)
+
+		assertNoError(t, b.users.UpdateRole(ctx, user.ID, model.RoleModerator))
+		assertNotFound(t, b.users.UpdateRole(ctx, user.ID+100, model.RoleModerator))
+
+		got, err := b.users.GetUserByID(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "password", got.Password, "new hash")
+		assertEqual(t, "display name", got.DisplayName, "Alice")
+		assertEqual(t, "website", got.Website, "https://alice.example.com")
+		assertEqual(t, "role", got.Role, model.RoleModerator)
+
+		// the whole profile is written, empty fields clear it
+		_, err = b.users.UpdateProfile(ctx, &model.User{ID: user.ID, DisplayName: "Alice"})
+		assertNoError(t, err)
+
+		got, err = b.users.GetUserByID(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "website", got.Website, "")
+	})
+}
+
+func TestUserUpdatePassword(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+		assertNoError(t, b.users.UpdateRole(ctx, user.ID, model.RoleModerator))
+		assertNoError(t, b.users.UpdateStatus(ctx, &model.UserStatus{ID: user.ID, Status: model.UserBanned}))
+
+		assertNoError(t, b.users.UpdatePassword(ctx, user.ID, "new hash"))
+
+		// the rest of the user is left as it is in the store
+		got, err := b.users.GetUserByID(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "password", got.Password, "new hash")
+		assertEqual(t, "has password", got.HasPassword, true)
+		assertEqual(t, "login", got.Login, "alice")
+		assertEqual(t, "role", got.Role, model.RoleModerator)
+		assertEqual(t, "status", got.Status, model.UserBanned)
+
+		assertNotFound(t, b.users.UpdatePassword(ctx, user.ID+100, "new hash"))
+	})
+}
+
+func TestUserUpdateEmail(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+
+		assertNoError(t, b.users.UpdateEmail(ctx, user.ID, "alice@example.com", true))
+
+		got, err := b.users.GetUserByEmail(ctx, "alice@example.com")
+		assertNoError(t, err)
+		assertEqual(t, "id", got.ID, user.ID)
+		assertEqual(t, "email verified", got.EmailVerified, true)
+
+		assertNoError(t, b.users.UpdateEmail(ctx, user.ID, "", false))
+
+		got, err = b.users.GetUserByID(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "email", got.Email, "")
+		assertEqual(t, "email verified", got.EmailVerified, false)
+		_, err = b.users.GetUserByEmail(ctx, "alice@example.com")
+		assertNotFound(t, err)
+
+		assertNotFound(t, b.users.UpdateEmail(ctx, user.ID+100, "nobody@example.com", false))
+	})
+}
+
+func TestUserUpdateStatus(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+		until := time.Now().Add(time.Hour).Truncate(time.Second)
+
+		err := b.users.UpdateStatus(ctx, &model.UserStatus{
+			ID:             user.ID,
+			Status:         model.UserSuspended,
+			SuspendedUntil: until,
+			Reason:         "spam",
+		})
+		assertNoError(t, err)
+
+		got, err := b.users.GetUserByID(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "status", got.Status, model.UserSuspended)
+		assertEqual(t, "reason", got.StatusReason, "spam")
+		if !got.SuspendedUntil.Equal(until) {
+			t.Fatalf("suspended until = %v, want %v", got.SuspendedUntil, until)
+		}
+
+		assertNoError(t, b.users.UpdateStatus(ctx, &model.UserStatus{ID: user.ID, Status: model.UserDeleted}))
+
+		// a deleted account can't be brought back
+		err = b.users.UpdateStatus(ctx, &model.UserStatus{ID: user.ID, Status: model.UserActive})
+		assertNotFound(t, err)
+		assertNotFound(t, b.users.UpdateStatus(ctx, &model.UserStatus{ID: user.ID + 100, Status: model.UserBanned}))
+	})
+}
+
+func TestUserTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+		newToken := func(secret string, expiresIn time.Duration) *model.UserToken {
+			token := &model.UserToken{
+				UserID:    user.ID,
+				Purpose:   model.TokenVerifyEmail,
+				Hash:      hash(secret),
+				Email:     "alice@example.com",
+				ExpiresAt: time.Now().Add(expiresIn),
+			}
+			assertNoError(t, b.users.CreateToken(ctx, token))
+			return token
+		}
+
+		newToken("first", time.Hour)
+		newToken("second", time.Hour)
+
+		// only the latest token of a purpose works
+		_, err := b.users.UseToken(ctx, model.TokenVerifyEmail, hash("first"))
+		assertNotFound(t, err)
+
+		// a token got is still there to use
+		got, err := b.users.GetToken(ctx, model.TokenVerifyEmail, hash("second"))
+		assertNoError(t, err)
+		assertEqual(t, "got user", got.UserID, user.ID)
+
+		got, err = b.users.UseToken(ctx, model.TokenVerifyEmail, hash("second"))
+		assertNoError(t, err)
+		assertEqual(t, "user", got.UserID, user.ID)
+		assertEqual(t, "email", got.Email, "alice@example.com")
+
+		_, err = b.users.UseToken(ctx, model.TokenVerifyEmail, hash("second"))
+		assertNotFound(t, err)
+		_, err = b.users.GetToken(ctx, model.TokenVerifyEmail, hash("second"))
+		assertNotFound(t, err)
+
+		newToken("expired", -time.Minute)
+		_, err = b.users.GetToken(ctx, model.TokenVerifyEmail, hash("expired"))
+		assertNotFound(t, err)
+		_, err = b.users.UseToken(ctx, model.TokenVerifyEmail, hash("expired"))
+		assertNotFound(t, err)
+
+		_, err = b.users.UseToken(ctx, model.TokenResetPassword, hash("expired"))
+		assertNotFound(t, err)
+	})
+}
+
+func TestUserTOTP(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+
+		_, err := b.users.GetTOTP(ctx, user.ID)
+		assertNotFound(t, err)
+
+		assertNoError(t, b.users.SaveTOTP(ctx, &model.UserTOTP{UserID: user.ID, Secret: "FIRST"}))
+		// a pending enrollment is replaced
+		assertNoError(t, b.users.SaveTOTP(ctx, &model.UserTOTP{UserID: user.ID, Secret: "SECOND"}))
+
+		got, err := b.users.GetTOTP(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "secret", got.Secret, "SECOND")
+		assertEqual(t, "enabled", got.Enabled, false)
+
+		assertNoError(t, b.users.EnableTOTP(ctx, user.ID, 5, []string{hash("code 1"), hash("code 2")}))
+		assertNotFound(t, b.users.EnableTOTP(ctx, user.ID, 6, nil))
+
+		err = b.users.SaveTOTP(ctx, &model.UserTOTP{UserID: user.ID, Secret: "THIRD"})
+		if !errors.Is(err, model.ErrConflictTwoFactor) {
+			t.Fatalf("err = %v, want %v", err, model.ErrConflictTwoFactor)
+		}
+
+		got, err = b.users.GetTOTP(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "secret", got.Secret, "SECOND")
+		assertEqual(t, "enabled", got.Enabled, true)
+		assertEqual(t, "last step", got.LastStep, int64(5))
+
+		// a step works once and never after a later one
+		assertNotFound(t, b.users.UseTOTPStep(ctx, user.ID, 5))
+		assertNoError(t, b.users.UseTOTPStep(ctx, user.ID, 7))
+		assertNotFound(t, b.users.UseTOTPStep(ctx, user.ID, 6))
+
+		assertNoError(t, b.users.UseRecoveryCode(ctx, user.ID, hash("code 1")))
+		assertNotFound(t, b.users.UseRecoveryCode(ctx, user.ID, hash("code 1")))
+
+		assertNoError(t, b.users.ReplaceRecoveryCodes(ctx, user.ID, []string{hash("code 3")}))
+		assertNotFound(t, b.users.UseRecoveryCode(ctx, user.ID, hash("code 2")))
+		assertNoError(t, b.users.UseRecoveryCode(ctx, user.ID, hash("code 3")))
+
+		assertNoError(t, b.users.DeleteTOTP(ctx, user.ID))
+		_, err = b.users.GetTOTP(ctx, user.ID)
+		assertNotFound(t, err)
+	})
+}
+
+func TestUserIdentities(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+
+		err := b.users.CreateIdentity(ctx, &model.UserIdentity{
+			UserID:   user.ID,
+			Provider: "mock",
+			Subject:  "sub-1",
+			Email:    "alice@example.com",
+		})
+		assertNoError(t, err)
+
+		// one identity per provider and user
+		err = b.users.CreateIdentity(ctx, &model.UserIdentity{UserID: user.ID, Provider: "mock", Subject: "sub-2"})
+		if err == nil {
+			t.Fatal("second identity of the same provider created")
+		}
+
+		got, err := b.users.GetIdentity(ctx, "mock", "sub-1")
+		assertNoError(t, err)
+		assertEqual(t, "user", got.UserID, user.ID)
+		assertEqual(t, "email", got.Email, "alice@example.com")
+
+		_, err = b.users.GetIdentity(ctx, "mock", "sub-2")
+		assertNotFound(t, err)
+
+		identities, err := b.users.GetUserIdentities(ctx, user.ID)
+		assertNoError(t, err)
+		assertEqual(t, "identities", len(identities), 1)
+
+		assertNoError(t, b.users.DeleteIdentity(ctx, user.ID, "mock"))
+		assertNotFound(t, b.users.DeleteIdentity(ctx, user.ID, "mock"))
+	})
+}
+
+func TestUserOIDCLogins(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		user := b.createUser(t, "alice")
+
+		err := b.users.CreateOIDCLogin(ctx, &model.OIDCLogin{
+			StateHash:    hash("state"),
+			Provider:     "mock",
+			CodeVerifier: "verifier",
+			Nonce:        "nonce",
+			UserID:       user.ID,
+			ExpiresAt:    time.Now().Add(time.Minute),
+		})
+		assertNoError(t, err)
+
+		err = b.users.CreateOIDCLogin(ctx, &model.OIDCLogin{
+			StateHash: hash("expired"),
+			Provider:  "mock",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		assertNoError(t, err)
+
+		got, err := b.users.UseOIDCLogin(ctx, hash("state"))
+		assertNoError(t, err)
+		assertEqual(t, "provider", got.Provider, "mock")
+		assertEqual(t, "code verifier", got.CodeVerifier, "verifier")
+		assertEqual(t, "nonce", got.Nonce, "nonce")
+		assertEqual(t, "user", got.UserID, user.ID)
+
+		// a callback can't be replayed
+		_, err = b.users.UseOIDCLogin(ctx, hash("state"))
+		assertNotFound(t, err)
+
+		_, err = b.users.UseOIDCLogin(ctx, hash("expired"))
+		assertNotFound(t, err)
+	})
+}
+
+func TestUserAPITokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		err := b.users.CreateAPIToken(ctx, &model.APIToken{
+			UserID: alice.ID,
+			Name:   "ci",
+			Hash:   hash("token"),
+			Prefix: "clt_abcd",
+			Scopes: []string{model.ScopeRead, model.ScopePostsWrite},
+		})
+		assertNoError(t, err)
+
+		got, err := b.users.GetAPITokenByHash(ctx, hash("token"))
+		assertNoError(t, err)
+		assertEqual(t, "user", got.UserID, alice.ID)
+		assertEqual(t, "name", got.Name, "ci")
+		assertEqual(t, "prefix", got.Prefix, "clt_abcd")
+		if !got.Allows(model.ScopePostsWrite) || got.Allows(model.ScopeImagesWrite) {
+			t.Fatalf("scopes = %v", got.Scopes)
+		}
+		if !got.ExpiresAt.IsZero() {
+			t.Fatalf("expires at = %v, want never", got.ExpiresAt)
+		}
+
+		assertNoError(t, b.users.TouchAPIToken(ctx, got.ID))
+		got, err = b.users.GetAPITokenByHash(ctx, hash("token"))
+		assertNoError(t, err)
+		if got.LastUsedAt.IsZero() {
+			t.Fatal("last use isn't recorded")
+		}
+
+		tokens, err := b.users.GetUserAPITokens(ctx, alice.ID)
+		assertNoError(t, err)
+		assertIDs(t, "tokens", tokens, func(tok *model.APIToken) uint64 { return tok.ID }, got.ID)
+
+		// only the owner deletes a token
+		assertNotFound(t, b.users.DeleteAPIToken(ctx, bob.ID, got.ID))
+		assertNoError(t, b.users.DeleteAPIToken(ctx, alice.ID, got.ID))
+
+		_, err = b.users.GetAPITokenByHash(ctx, hash("token"))
+		assertNotFound(t, err)
+	})
+}
+
+func TestUserDeletionQueue(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		assertNoError(t, b.users.RequestDeletion(ctx, alice.ID))
+		assertNoError(t, b.users.RequestDeletion(ctx, bob.ID))
+
+		// oldest first, a claimed deletion is skipped for the lease
+		claimed, err := b.users.ClaimDeletion(ctx, time.Hour)
+		assertNoError(t, err)
+		assertEqual(t, "first claimed", claimed, alice.ID)
+
+		claimed, err = b.users.ClaimDeletion(ctx, time.Hour)
+		assertNoError(t, err)
+		assertEqual(t, "second claimed", claimed, bob.ID)
+
+		_, err = b.users.ClaimDeletion(ctx, time.Hour)
+		assertNotFound(t, err)
+
+		assertNoError(t, b.users.FinishDeletion(ctx, alice.ID))
+		assertNoError(t, b.users.FinishDeletion(ctx, bob.ID))
+
+		// an expired lease is claimed again
+		assertNoError(t, b.users.RequestDeletion(ctx, alice.ID))
+		_, err = b.users.ClaimDeletion(ctx, -time.Minute)
+		assertNoError(t, err)
+
+		claimed, err = b.users.ClaimDeletion(ctx, time.Hour)
+		assertNoError(t, err)
+		assertEqual(t, "reclaimed", claimed, alice.ID)
+	})
+}
+
+func TestUserAnonymizeAndDelete(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b *backend) {
+		alice := b.createUser(t, "alice")
+		bob := b.createUser(t, "bob")
+
+		assertNoError(t, b.users.UpdateEmail(ctx, alice.ID, "alice@example.com", true))
+		assertNoError(t, b.users.CreateIdentity(ctx, &model.UserIdentity{UserID: alice.ID, Provider: "mock", Subject: "sub-1"}))
+		assertNoError(t, b.follows.Create(ctx, bob.ID, alice.ID))
+
+		assertNoError(t, b.users.AnonymizeUser(ctx, alice.ID, "deleted-1"))
+
+		got, err := b.users.GetUserByID(ctx, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "login", got.Login, "deleted-1")
+		assertEqual(t, "password", got.Password, "")
+		assertEqual(t, "has password", got.HasPassword, false)
+		assertEqual(t, "email", got.Email, "")
+
+		_, err = b.users.GetUserByEmail(ctx, "alice@example.com")
+		assertNotFound(t, err)
+		_, err = b.users.GetIdentity(ctx, "mock", "sub-1")
+		assertNotFound(t, err)
+
+		following, err := b.follows.IsFollowing(ctx, bob.ID, alice.ID)
+		assertNoError(t, err)
+		assertEqual(t, "following", following, false)
+
+		assertNoError(t, b.users.DeleteUser(ctx, alice.ID))
+		_, err = b.users.GetUserByID(ctx, alice.ID)
+		assertNotFound(t, err)
+	})
+}
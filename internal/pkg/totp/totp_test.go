@@ -0,0 +1,119 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// the SHA-1 secret of the RFC 6238 test vectors, "12345678901234567890"
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeRFC6238(t *testing.T) {
+	// the RFC lists 8 digits, the codes are their last 6
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		got, err := Code(rfcSecret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v.code {
+			t.Fatalf("code at %d = %s, want %s", v.unix, got, v.code)
+		}
+
+		step, ok := Validate(rfcSecret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok || step != v.unix/period {
+			t.Fatalf("validate at %d = %d %v, want %d true", v.unix, step, ok, v.unix/period)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / period
+
+	code := func(t *testing.T, at time.Time) string {
+		t.Helper()
+
+		c, err := Code(rfcSecret, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		offset time.Duration
+		skew   int
+		ok     bool
+	}{
+		{"current step", 0, 0, true},
+		{"previous step without skew", -period * time.Second, 0, false},
+		{"previous step", -period * time.Second, 1, true},
+		{"next step", period * time.Second, 1, true},
+		{"two steps back", -2 * period * time.Second, 1, false},
+		{"two steps ahead", 2 * period * time.Second, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, code(t, now.Add(tt.offset)), now, tt.skew)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+
+			// the step of the code, not the current one, is what a replay check needs
+			want := current + int64(tt.offset/(period*time.Second))
+			if ok && step != want {
+				t.Fatalf("step = %d, want %d", step, want)
+			}
+		})
+	}
+}
+
+func TestValidateRejectsMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now, 1); ok {
+			t.Fatalf("code %q accepted", code)
+		}
+	}
+
+	if _, ok := Validate("not base32!", "287082", now, 1); ok {
+		t.Fatal("code of a malformed secret accepted")
+	}
+
+	// secrets are typed in lowercase too
+	if _, ok := Validate(strings.ToLower(rfcSecret), "287082", now, 0); !ok {
+		t.Fatal("lowercase secret rejected")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := encoding.DecodeString(secret)
+	if err != nil || len(key) != secretBytes {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	if !strings.Contains(ProvisioningURI("Cloth", "alice", secret), "secret="+secret) {
+		t.Fatal("provisioning uri lacks the secret")
+	}
+}
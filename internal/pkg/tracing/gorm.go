@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// gormPlugin makes a span of every query, a child of the span in the
+// context the query is run with.
+type gormPlugin struct {
+}
+
+func NewGormPlugin() *gormPlugin {
+	return &gormPlugin{}
+}
+
+func (p *gormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p *gormPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	errs := []error{
+		// the implicit transactions of create, update and delete are in the span
+		cb.Create().Before("gorm:begin_transaction").Register("tracing:before", p.before("create")),
+		cb.Create().After("gorm:commit_or_rollback_transaction").Register("tracing:after", p.after),
+		cb.Update().Before("gorm:begin_transaction").Register("tracing:before", p.before("update")),
+		cb.Update().After("gorm:commit_or_rollback_transaction").Register("tracing:after", p.after),
+		cb.Delete().Before("gorm:begin_transaction").Register("tracing:before", p.before("delete")),
+		cb.Delete().After("gorm:commit_or_rollback_transaction").Register("tracing:after", p.after),
+		cb.Query().Before("gorm:query").Register("tracing:before", p.before("select")),
+		cb.Query().After("gorm:after_query").Register("tracing:after", p.after),
+		cb.Raw().Before("gorm:raw").Register("tracing:before", p.before("raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after", p.after),
+		// the span of Row and Rows ends once the query is sent, reading is the caller's
+		cb.Row().Before("gorm:row").Register("tracing:before", p.before("row")),
+		cb.Row().After("gorm:row").Register("tracing:after", p.after),
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *gormPlugin) before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		// the statement keeps its context: chained queries are siblings, not children
+		_, span := Start(ctx, "db."+operation,
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+		)
+		db.Statement.Settings.Store(spanKey, span)
+	}
+}
+
+func (p *gormPlugin) after(db *gorm.DB) {
+	value, ok := db.Statement.Settings.LoadAndDelete(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+
+	span.SetAttributes(
+		attribute.String("db.sql.table", db.Statement.Table),
+		// with placeholders, the values aren't recorded
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	)
+
+	err := db.Error
+	// not found is an answer, not a failure
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
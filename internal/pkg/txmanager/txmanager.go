@@ -0,0 +1,84 @@
+package txmanager
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	serializationFailure = "40001"
+	deadlockDetected     = "40P01"
+)
+
+type Config struct {
+	Isolation sql.IsolationLevel
+	// attempts after the first one when the transaction loses to a concurrent one
+	MaxRetries int
+	// doubled after every retry
+	RetryDelay time.Duration
+}
+
+type txKey struct{}
+
+type manager struct {
+	db  *gorm.DB
+	cfg Config
+}
+
+func NewManager(db *gorm.DB, cfg Config) *manager {
+	return &manager{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+// Do runs fn in a transaction carried by the ctx fn gets, the repositories
+// take it from there with DB. The whole fn is run again after a
+// serialization failure or a deadlock, so it must not have effects outside
+// the database. Inside another Do, fn just joins the outer transaction.
+func (m *manager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return fn(ctx)
+	}
+
+	delay := m.cfg.RetryDelay
+	for attempt := 0; ; attempt++ {
+		err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return fn(context.WithValue(ctx, txKey{}, tx))
+		}, &sql.TxOptions{Isolation: m.cfg.Isolation})
+		if err == nil || !retryable(err) || attempt >= m.cfg.MaxRetries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "transaction retry error")
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// DB returns the transaction of ctx, or db if there is none, bound to ctx.
+// db may be a transaction itself: a repository made with one keeps to it.
+func DB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(txKey{}).(*gorm.DB); ok {
+		return tx.WithContext(ctx)
+	}
+
+	return db.WithContext(ctx)
+}
+
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == serializationFailure || pgErr.Code == deadlockDetected
+}
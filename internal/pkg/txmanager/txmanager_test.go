@@ -0,0 +1,305 @@
+package txmanager
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pkg/errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recorder is a database/sql driver that only writes down what it is asked
+// to do: "begin", "commit", "rollback" and the statements, those run inside
+// a transaction prefixed with "tx ".
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) Events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+func (r *recorder) Connect(context.Context) (driver.Conn, error) {
+	return &recConn{rec: r}, nil
+}
+
+func (r *recorder) Driver() driver.Driver {
+	return nil
+}
+
+type recConn struct {
+	rec  *recorder
+	inTx bool
+}
+
+func (c *recConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+
+func (c *recConn) Close() error {
+	return nil
+}
+
+func (c *recConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *recConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.rec.add("begin")
+	c.inTx = true
+	return &recTx{conn: c}, nil
+}
+
+func (c *recConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.record(query)
+	return driver.RowsAffected(1), nil
+}
+
+func (c *recConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.record(query)
+	return &idRows{}, nil
+}
+
+func (c *recConn) record(query string) {
+	statement := strings.Fields(query)[0]
+	if c.inTx {
+		statement = "tx " + statement
+	}
+	c.rec.add(statement)
+}
+
+type recTx struct {
+	conn *recConn
+}
+
+func (t *recTx) Commit() error {
+	t.conn.rec.add("commit")
+	t.conn.inTx = false
+	return nil
+}
+
+func (t *recTx) Rollback() error {
+	t.conn.rec.add("rollback")
+	t.conn.inTx = false
+	return nil
+}
+
+// idRows answers INSERT ... RETURNING "id" with a single id.
+type idRows struct {
+	done bool
+}
+
+func (r *idRows) Columns() []string {
+	return []string{"id"}
+}
+
+func (r *idRows) Close() error {
+	return nil
+}
+
+func (r *idRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+type item struct {
+	ID   uint64
+	Name string
+}
+
+func newTestManager(t *testing.T, maxRetries int) (*manager, *gorm.DB, *recorder) {
+	t.Helper()
+
+	rec := &recorder{}
+	sqlDB := sql.OpenDB(rec)
+	// a single connection keeps the events of one test in order
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewManager(db, Config{MaxRetries: maxRetries}), db, rec
+}
+
+func create(ctx context.Context, db *gorm.DB, name string) error {
+	return DB(ctx, db).Create(&item{Name: name}).Error
+}
+
+func assertEvents(t *testing.T, rec *recorder, want ...string) {
+	t.Helper()
+
+	if got := rec.Events(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+}
+
+func TestDoCommits(t *testing.T) {
+	m, db, rec := newTestManager(t, 0)
+
+	err := m.Do(context.Background(), func(ctx context.Context) error {
+		err := create(ctx, db, "first")
+		if err != nil {
+			return err
+		}
+		return create(ctx, db, "second")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEvents(t, rec, "begin", "tx INSERT", "tx INSERT", "commit")
+}
+
+func TestDoRollsBackOnError(t *testing.T) {
+	m, db, rec := newTestManager(t, 3)
+	errFail := errors.New("enrich failed")
+
+	err := m.Do(context.Background(), func(ctx context.Context) error {
+		err := create(ctx, db, "first")
+		if err != nil {
+			return err
+		}
+		return errors.Wrap(errFail, "logic error")
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("err = %v, want %v", err, errFail)
+	}
+
+	// an ordinary error is not retried
+	assertEvents(t, rec, "begin", "tx INSERT", "rollback")
+}
+
+func TestDoRollsBackOnPanic(t *testing.T) {
+	m, db, rec := newTestManager(t, 0)
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic was swallowed")
+			}
+		}()
+
+		_ = m.Do(context.Background(), func(ctx context.Context) error {
+			err := create(ctx, db, "first")
+			if err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+
+	assertEvents(t, rec, "begin", "tx INSERT", "rollback")
+}
+
+func TestDoRetriesSerializationFailure(t *testing.T) {
+	m, db, rec := newTestManager(t, 3)
+	attempts := 0
+
+	err := m.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		err := create(ctx, db, "first")
+		if err != nil {
+			return err
+		}
+		if attempts < 3 {
+			return errors.Wrap(&pgconn.PgError{Code: serializationFailure}, "database error (table items)")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEvents(t, rec,
+		"begin", "tx INSERT", "rollback",
+		"begin", "tx INSERT", "rollback",
+		"begin", "tx INSERT", "commit")
+}
+
+func TestDoGivesUpAfterMaxRetries(t *testing.T) {
+	m, _, rec := newTestManager(t, 1)
+	deadlock := &pgconn.PgError{Code: deadlockDetected}
+
+	err := m.Do(context.Background(), func(ctx context.Context) error {
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) {
+		t.Fatalf("err = %v, want %v", err, deadlock)
+	}
+
+	assertEvents(t, rec, "begin", "rollback", "begin", "rollback")
+}
+
+func TestDoJoinsOuterTransaction(t *testing.T) {
+	m, db, rec := newTestManager(t, 0)
+	errFail := errors.New("outer failed")
+
+	err := m.Do(context.Background(), func(ctx context.Context) error {
+		err := m.Do(ctx, func(ctx context.Context) error {
+			return create(ctx, db, "inner")
+		})
+		if err != nil {
+			return err
+		}
+		return errFail
+	})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("err = %v, want %v", err, errFail)
+	}
+
+	// the inner work is rolled back with the outer transaction
+	assertEvents(t, rec, "begin", "tx INSERT", "rollback")
+}
+
+func TestDBOutsideTransaction(t *testing.T) {
+	_, db, rec := newTestManager(t, 0)
+
+	err := create(context.Background(), db, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEvents(t, rec, "INSERT")
+}
+
+func TestDBKeepsBoundTransaction(t *testing.T) {
+	_, db, rec := newTestManager(t, 0)
+
+	// a repository made with a transaction keeps to it without Do
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return create(context.Background(), tx, "first")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEvents(t, rec, "begin", "tx INSERT", "commit")
+}
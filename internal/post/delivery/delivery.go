@@ -1,13 +1,14 @@
 package delivery
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
-	"github.com/pkg/errors"
 
 	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
 	"github.com/ell1jah/bmstu_web/model"
@@ -15,14 +16,20 @@ import (
 )
 
 type PostLogic interface {
-	GetPost(userId, postId uint64) (*model.Post, error)
-	GetUsersPosts(askerId, ownerId uint64) ([]*model.Post, error)
-	GetPostsWithParams(userId uint64, params model.PostParams) ([]*model.Post, error)
-	CreatePost(post *model.Post) error
-	DeletePost(userId, postId uint64) error
-	LikePost(userId, postId uint64) error
-	DislikePost(userId, postId uint64) error
-	UnratePost(userId, postId uint64) error
+	GetPost(ctx context.Context, userId, postId uint64) (*model.Post, error)
+	GetUsersPosts(ctx context.Context, askerId, ownerId uint64) ([]*model.Post, error)
+	GetPostsWithParams(ctx context.Context, userId uint64, params model.PostParams) ([]*model.Post, error)
+	GetFeed(ctx context.Context, userId uint64, params model.PostParams) ([]*model.Post, error)
+	GetTrending(ctx context.Context, userId uint64, window time.Duration, params model.PostParams) ([]*model.Post, error)
+	CreatePost(ctx context.Context, post *model.Post) error
+	DeletePost(ctx context.Context, userId uint64, userRole string, postId uint64) error
+	LikePost(ctx context.Context, userId, postId uint64) error
+	DislikePost(ctx context.Context, userId, postId uint64) error
+	UnratePost(ctx context.Context, userId, postId uint64) error
+}
+
+type ScopeMiddleware interface {
+	Scope(scope string) echo.MiddlewareFunc
 }
 
 type handler struct {
@@ -35,35 +42,36 @@ func NewHandler(postService PostLogic) *handler {
 	}
 }
 
-func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
-	e.POST("/posts", h.CreatePost, auth)
-	e.DELETE("/posts/:postID", h.DeletePost, auth)
-	e.PUT("/posts/:postID/like", h.LikePost, auth)
-	e.PUT("/posts/:postID/dislike", h.DislikePost, auth)
-	e.DELETE("/posts/:postID/unrate", h.UnratePost, auth)
-
-	e.GET("/posts/:postID", h.GetPost, auth)
-	e.GET("/posts", h.GetPostsWithParams, auth)
-	e.GET("/users/:userID/posts", h.GetUsersPosts, auth)
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, scopes ScopeMiddleware) {
+	write := scopes.Scope(model.ScopePostsWrite)
+	e.POST("/posts", h.CreatePost, write, auth)
+	e.DELETE("/posts/:postID", h.DeletePost, write, auth)
+	e.PUT("/posts/:postID/like", h.LikePost, write, auth)
+	e.PUT("/posts/:postID/dislike", h.DislikePost, write, auth)
+	e.DELETE("/posts/:postID/unrate", h.UnratePost, write, auth)
+
+	read := scopes.Scope(model.ScopeRead)
+	e.GET("/posts/:postID", h.GetPost, read, auth)
+	e.GET("/posts", h.GetPostsWithParams, read, auth)
+	e.GET("/posts/trending", h.GetTrending, read, auth)
+	e.GET("/feed", h.GetFeed, read, auth)
+	e.GET("/users/:userID/posts", h.GetUsersPosts, read, auth)
 }
 
 func (h *handler) GetPost(c echo.Context) error {
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	post, err := h.postService.GetPost(userClaims.User.ID, postId)
+	post, err := h.postService.GetPost(c.Request().Context(), userClaims.User.ID, postId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusOK, dto.RespPostFromPost(post))
@@ -72,20 +80,17 @@ func (h *handler) GetPost(c echo.Context) error {
 func (h *handler) GetUsersPosts(c echo.Context) error {
 	ownerId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	posts, err := h.postService.GetUsersPosts(userClaims.User.ID, ownerId)
+	posts, err := h.postService.GetUsersPosts(c.Request().Context(), userClaims.User.ID, ownerId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusOK, dto.RespPostsFromPosts(posts))
@@ -95,28 +100,78 @@ func (h *handler) GetPostsWithParams(c echo.Context) error {
 	var reqParams dto.ReqPostParams
 	err := c.Bind(&reqParams)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqParams)
+	if err != nil {
+		return err
+	}
+
+	params := reqParams.ToPostParams()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	posts, err := h.postService.GetPostsWithParams(c.Request().Context(), userClaims.User.ID, *params)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespPostsFromPosts(posts))
+}
+
+func (h *handler) GetFeed(c echo.Context) error {
+	var reqParams dto.ReqPostParams
+	err := c.Bind(&reqParams)
+	if err != nil {
+		return err
 	}
 
 	_, err = govalidator.ValidateStruct(reqParams)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	params := reqParams.ToPostParams()
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	posts, err := h.postService.GetPostsWithParams(userClaims.User.ID, *params)
+	posts, err := h.postService.GetFeed(c.Request().Context(), userClaims.User.ID, *params)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespPostsFromPosts(posts))
+}
+
+func (h *handler) GetTrending(c echo.Context) error {
+	var reqParams dto.ReqTrendingParams
+	err := c.Bind(&reqParams)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqParams)
+	if err != nil {
+		return err
+	}
+
+	params := reqParams.ToPostParams()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	posts, err := h.postService.GetTrending(c.Request().Context(), userClaims.User.ID, reqParams.ToWindow(), *params)
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(http.StatusOK, dto.RespPostsFromPosts(posts))
@@ -126,30 +181,26 @@ func (h *handler) CreatePost(c echo.Context) error {
 	var reqPost dto.ReqPost
 	err := c.Bind(&reqPost)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	_, err = govalidator.ValidateStruct(reqPost)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	post := reqPost.ToPost()
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
 	post.UserID = userClaims.User.ID
 
-	err = h.postService.CreatePost(post)
+	err = h.postService.CreatePost(c.Request().Context(), post)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusCreated, dto.RespPostFromPost(post))
@@ -158,21 +209,17 @@ func (h *handler) CreatePost(c echo.Context) error {
 func (h *handler) DeletePost(c echo.Context) error {
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
-	userId := userClaims.User.ID
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	err = h.postService.DeletePost(userId, postId)
+	err = h.postService.DeletePost(c.Request().Context(), userClaims.User.ID, userClaims.User.Role, postId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -181,21 +228,18 @@ func (h *handler) DeletePost(c echo.Context) error {
 func (h *handler) LikePost(c echo.Context) error {
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	userId := userClaims.User.ID
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	err = h.postService.LikePost(userId, postId)
+	err = h.postService.LikePost(c.Request().Context(), userId, postId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -204,21 +248,18 @@ func (h *handler) LikePost(c echo.Context) error {
 func (h *handler) DislikePost(c echo.Context) error {
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	userId := userClaims.User.ID
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	err = h.postService.DislikePost(userId, postId)
+	err = h.postService.DislikePost(c.Request().Context(), userId, postId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -227,40 +268,19 @@ func (h *handler) DislikePost(c echo.Context) error {
 func (h *handler) UnratePost(c echo.Context) error {
 	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return model.ErrBadRequest
 	}
 
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	userId := userClaims.User.ID
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
-	err = h.postService.UnratePost(userId, postId)
+	err = h.postService.UnratePost(c.Request().Context(), userId, postId)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.NoContent(http.StatusOK)
 }
-
-func handleError(err error) *echo.HTTPError {
-	causeErr := errors.Cause(err)
-	switch {
-	case errors.Is(causeErr, model.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, model.ErrNotFound.Error())
-	case errors.Is(causeErr, model.ErrBadRequest):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
-	case errors.Is(causeErr, model.ErrPermissionDenied):
-		return echo.NewHTTPError(http.StatusForbidden, model.ErrPermissionDenied.Error())
-	case errors.Is(causeErr, model.ErrInvalidPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrInvalidPassword.Error())
-	case errors.Is(causeErr, model.ErrConflictPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrConflictPassword.Error())
-	default:
-		return echo.NewHTTPError(http.StatusInternalServerError, causeErr.Error())
-	}
-}
@@ -1,10 +1,17 @@
 package logic
 
 import (
+	"context"
+	"math"
 	"os"
+	"time"
 
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/metrics"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
+	"go.uber.org/zap"
 )
 
 const (
@@ -12,132 +19,199 @@ const (
 	pngExt   = ".png"
 )
 
+const (
+	// a post gets as hot as one hotDecay seconds older with ten times its
+	// score, hotEpoch is any instant the ages are counted from
+	hotDecay = 45000
+	// older posts keep their last score: they can't get hot anymore and
+	// are past the trending windows
+	scoreHorizon = 30 * 24 * time.Hour
+)
+
+var hotEpoch = time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+
 type PostRepository interface {
-	GetPost(postId uint64) (*model.Post, error)
-	GetUsersPosts(ownerId uint64) ([]*model.Post, error)
-	GetPostsWithParams(params model.PostParams) ([]*model.Post, error)
-	CreatePost(post *model.Post) error
-	DeletePost(postId uint64) error
+	GetPost(ctx context.Context, postId uint64) (*model.Post, error)
+	GetUsersPosts(ctx context.Context, ownerId uint64) ([]*model.Post, error)
+	GetPostsWithParams(ctx context.Context, params model.PostParams) ([]*model.Post, error)
+	GetFollowingPosts(ctx context.Context, followerId uint64, params model.PostParams) ([]*model.Post, error)
+	CreatePost(ctx context.Context, post *model.Post) error
+	DeletePost(ctx context.Context, postId uint64) error
+	GetPostStats(ctx context.Context, since time.Time) ([]*model.PostStats, error)
+	SaveScores(ctx context.Context, scores []*model.PostScore) error
+	ClaimScoring(ctx context.Context, lease time.Duration) error
 }
 
 type UserRepository interface {
-	GetUserByID(id uint64) (*model.User, error)
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error)
 }
 
 type RateRepository interface {
-	GetRate(userId, postId uint64) (model.Rate, error)
-	GetRatesCnts(postId uint64) (model.RatesCnts, error)
-	Create(userId, postId uint64, rate model.Rate) error
-	Update(userId, postId uint64, rate model.Rate) error
-	Delete(userId, postId uint64) error
+	GetRate(ctx context.Context, userId, postId uint64) (model.Rate, error)
+	GetRatesCnts(ctx context.Context, postId uint64) (model.RatesCnts, error)
+	GetPostsRates(ctx context.Context, userId uint64, postIds []uint64) (map[uint64]model.Rate, error)
+	GetPostsRatesCnts(ctx context.Context, postIds []uint64) (map[uint64]model.RatesCnts, error)
+	Create(ctx context.Context, userId, postId uint64, rate model.Rate) error
+	Update(ctx context.Context, userId, postId uint64, rate model.Rate) error
+	Delete(ctx context.Context, userId, postId uint64) error
+}
+
+type CollectionRepository interface {
+	GetSavedPosts(ctx context.Context, userId uint64, postIds []uint64) (map[uint64]bool, error)
+	GetSaveCnts(ctx context.Context, postIds []uint64) (map[uint64]int, error)
+	RemovePostFromAll(ctx context.Context, postId uint64) error
+}
+
+type TxManager interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type EventPublisher interface {
+	Publish(ctx context.Context, event *model.Event)
 }
 
 type logic struct {
-	postRepository PostRepository
-	userRepository UserRepository
-	rateRepository RateRepository
+	postRepository       PostRepository
+	userRepository       UserRepository
+	rateRepository       RateRepository
+	collectionRepository CollectionRepository
+	txManager            TxManager
+	eventPublisher       EventPublisher
 }
 
-func NewLogic(postRepository PostRepository, userRepository UserRepository, rateRepository RateRepository) *logic {
+func NewLogic(postRepository PostRepository, userRepository UserRepository, rateRepository RateRepository,
+	collectionRepository CollectionRepository, txManager TxManager, eventPublisher EventPublisher) *logic {
 	return &logic{
-		postRepository: postRepository,
-		userRepository: userRepository,
-		rateRepository: rateRepository,
+		postRepository:       postRepository,
+		userRepository:       userRepository,
+		rateRepository:       rateRepository,
+		collectionRepository: collectionRepository,
+		txManager:            txManager,
+		eventPublisher:       eventPublisher,
 	}
 }
 
-func (l *logic) GetPost(userId, postId uint64) (*model.Post, error) {
-	post, err := l.postRepository.GetPost(postId)
-	if err != nil {
-		return nil, errors.Wrap(err, "post repository error")
-	}
+func (l *logic) GetPost(ctx context.Context, userId, postId uint64) (*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "post.GetPost")
+	defer span.End()
 
-	err = l.addUserInfo(post)
+	post, err := l.postRepository.GetPost(ctx, postId)
 	if err != nil {
-		return nil, errors.Wrap(err, "addUserInfo error")
+		return nil, errors.Wrap(err, "post repository error")
 	}
 
-	err = l.addRateInfo(userId, post)
+	err = l.addPostsInfo(ctx, userId, []*model.Post{post})
 	if err != nil {
-		return nil, errors.Wrap(err, "addRateInfo error")
+		return nil, errors.Wrap(err, "addPostsInfo error")
 	}
 
 	return post, nil
 }
 
-func (l *logic) GetUsersPosts(askerId, ownerId uint64) ([]*model.Post, error) {
-	posts, err := l.postRepository.GetUsersPosts(ownerId)
+func (l *logic) GetUsersPosts(ctx context.Context, askerId, ownerId uint64) ([]*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "post.GetUsersPosts")
+	defer span.End()
+
+	posts, err := l.postRepository.GetUsersPosts(ctx, ownerId)
 	if err != nil {
 		return nil, errors.Wrap(err, "post repository error")
 	}
 
-	for _, post := range posts {
-		err = l.addUserInfo(post)
-		if err != nil {
-			return nil, errors.Wrap(err, "addUserInfo error")
-		}
-
-		err = l.addRateInfo(askerId, post)
-		if err != nil {
-			return nil, errors.Wrap(err, "addRateInfo error")
-		}
+	err = l.addPostsInfo(ctx, askerId, posts)
+	if err != nil {
+		return nil, errors.Wrap(err, "addPostsInfo error")
 	}
 
 	return posts, nil
 }
 
-func (l *logic) GetPostsWithParams(userId uint64, params model.PostParams) ([]*model.Post, error) {
-	posts, err := l.postRepository.GetPostsWithParams(params)
+func (l *logic) GetPostsWithParams(ctx context.Context, userId uint64, params model.PostParams) ([]*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "post.GetPostsWithParams")
+	defer span.End()
+
+	posts, err := l.postRepository.GetPostsWithParams(ctx, params)
 	if err != nil {
 		return nil, errors.Wrap(err, "post repository error")
 	}
 
-	for _, post := range posts {
-		err = l.addUserInfo(post)
-		if err != nil {
-			return nil, errors.Wrap(err, "addUserInfo error")
-		}
-
-		err = l.addRateInfo(userId, post)
-		if err != nil {
-			return nil, errors.Wrap(err, "addRateInfo error")
-		}
+	err = l.addPostsInfo(ctx, userId, posts)
+	if err != nil {
+		return nil, errors.Wrap(err, "addPostsInfo error")
 	}
 
 	return posts, nil
 }
 
-func (l *logic) CreatePost(post *model.Post) error {
-	if _, err := os.Stat(imageDir + post.ImageID + pngExt); errors.Is(err, os.ErrNotExist) {
-		return errors.Wrap(model.ErrBadRequest, "no image")
-	} else if err != nil {
-		return errors.Wrap(err, "can't find image")
-	}
+func (l *logic) GetFeed(ctx context.Context, userId uint64, params model.PostParams) ([]*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "post.GetFeed")
+	defer span.End()
 
-	err := l.postRepository.CreatePost(post)
+	posts, err := l.postRepository.GetFollowingPosts(ctx, userId, params)
 	if err != nil {
-		return errors.Wrap(err, "post repository error")
+		return nil, errors.Wrap(err, "post repository error")
 	}
 
-	err = l.addUserInfo(post)
+	err = l.addPostsInfo(ctx, userId, posts)
 	if err != nil {
-		return errors.Wrap(err, "addUserInfo error")
+		return nil, errors.Wrap(err, "addPostsInfo error")
 	}
 
-	return nil
+	return posts, nil
+}
+
+// GetTrending returns the posts of the last window, the most voted first.
+func (l *logic) GetTrending(ctx context.Context, userId uint64, window time.Duration, params model.PostParams) ([]*model.Post, error) {
+	ctx, span := tracing.Start(ctx, "post.GetTrending")
+	defer span.End()
+
+	params.Sort = model.SortTop
+	params.Since = time.Now().Add(-window)
+
+	return l.GetPostsWithParams(ctx, userId, params)
 }
 
-func (l *logic) DeletePost(userId, postId uint64) error {
-	post, err := l.postRepository.GetPost(postId)
+// RunScoring scores the posts of the last scoreHorizon every period until
+// ctx is done. Every server runs it, the repository hands each period to
+// one of them.
+func (l *logic) RunScoring(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		// the lease is the period: the holder takes the next one too, another
+		// server takes over a period after the holder is gone
+		err := l.postRepository.ClaimScoring(ctx, period)
+		if err == nil {
+			err = l.score(ctx)
+		}
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			logger.Ctx(ctx, "post").Error("post scoring", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *logic) score(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "post.score")
+	defer func() { tracing.End(span, err) }()
+
+	stats, err := l.postRepository.GetPostStats(ctx, time.Now().Add(-scoreHorizon))
 	if err != nil {
 		return errors.Wrap(err, "post repository error")
 	}
 
-	if post.UserID != userId {
-		return model.ErrPermissionDenied
+	scores := make([]*model.PostScore, len(stats))
+	for i, st := range stats {
+		scores[i] = scorePost(st)
 	}
 
-	err = l.postRepository.DeletePost(postId)
+	err = l.postRepository.SaveScores(ctx, scores)
 	if err != nil {
 		return errors.Wrap(err, "post repository error")
 	}
@@ -145,59 +219,174 @@ func (l *logic) DeletePost(userId, postId uint64) error {
 	return nil
 }
 
-func (l *logic) LikePost(userId, postId uint64) error {
-	rate, err := l.rateRepository.GetRate(userId, postId)
-	if err != nil && !errors.Is(err, model.ErrNotFound) {
-		return errors.Wrap(err, "rate repository error")
+// scorePost counts a comment as a like. Hot is Reddit's: the order of
+// magnitude of the score plus the age of the post, so a post is pushed
+// down by newer ones rather than by its own age.
+func scorePost(stats *model.PostStats) *model.PostScore {
+	score := stats.LikeCnt - stats.DislikeCnt + stats.CommentCnt
+
+	order := math.Log10(math.Max(math.Abs(float64(score)), 1))
+	if score < 0 {
+		order = -order
+	}
+
+	return &model.PostScore{
+		PostID: stats.PostID,
+		Score:  score,
+		Hot:    order + stats.Date.Sub(hotEpoch).Seconds()/hotDecay,
+	}
+}
+
+func (l *logic) CreatePost(ctx context.Context, post *model.Post) error {
+	ctx, span := tracing.Start(ctx, "post.CreatePost")
+	defer span.End()
+
+	if _, err := os.Stat(imageDir + post.ImageID + pngExt); errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(model.ErrBadRequest, "no image")
 	} else if err != nil {
-		err = l.rateRepository.Create(userId, postId, model.Like)
+		return errors.Wrap(err, "can't find image")
+	}
+
+	// the post is created only if it can be returned complete
+	err := l.txManager.Do(ctx, func(ctx context.Context) error {
+		// a retry must not reuse the id of the rolled back row
+		post.ID = 0
+
+		err := l.postRepository.CreatePost(ctx, post)
 		if err != nil {
-			return errors.Wrap(err, "rate repository error")
+			return errors.Wrap(err, "post repository error")
 		}
-	} else {
-		if rate != model.Like {
-			err = l.rateRepository.Update(userId, postId, model.Like)
-			if err != nil {
-				return errors.Wrap(err, "rate repository error")
-			}
+
+		// a new post is ranked before the next scoring
+		err = l.postRepository.SaveScores(ctx, []*model.PostScore{
+			scorePost(&model.PostStats{PostID: post.ID, Date: post.Date}),
+		})
+		if err != nil {
+			return errors.Wrap(err, "post repository error")
 		}
+
+		err = l.addUserInfo(ctx, post)
+		if err != nil {
+			return errors.Wrap(err, "addUserInfo error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	metrics.PostsCreated.WithLabelValues(post.Category, post.Sex).Inc()
 
 	return nil
 }
 
-func (l *logic) DislikePost(userId, postId uint64) error {
-	rate, err := l.rateRepository.GetRate(userId, postId)
-	if err != nil && !errors.Is(err, model.ErrNotFound) {
-		return errors.Wrap(err, "rate repository error")
-	} else if err != nil {
-		err = l.rateRepository.Create(userId, postId, model.Dislike)
+func (l *logic) DeletePost(ctx context.Context, userId uint64, userRole string, postId uint64) error {
+	ctx, span := tracing.Start(ctx, "post.DeletePost")
+	defer span.End()
+
+	return l.txManager.Do(ctx, func(ctx context.Context) error {
+		post, err := l.postRepository.GetPost(ctx, postId)
 		if err != nil {
-			return errors.Wrap(err, "rate repository error")
+			return errors.Wrap(err, "post repository error")
+		}
+
+		if post.UserID != userId && !model.HasRole(userRole, model.RoleModerator) {
+			return model.ErrPermissionDenied
+		}
+
+		err = l.collectionRepository.RemovePostFromAll(ctx, postId)
+		if err != nil {
+			return errors.Wrap(err, "collection repository error")
 		}
-	} else {
-		if rate != model.Dislike {
-			err = l.rateRepository.Update(userId, postId, model.Dislike)
+
+		err = l.postRepository.DeletePost(ctx, postId)
+		if err != nil {
+			return errors.Wrap(err, "post repository error")
+		}
+
+		return nil
+	})
+}
+
+func (l *logic) LikePost(ctx context.Context, userId, postId uint64) error {
+	ctx, span := tracing.Start(ctx, "post.LikePost")
+	defer span.End()
+
+	return l.ratePost(ctx, userId, postId, model.Like)
+}
+
+func (l *logic) DislikePost(ctx context.Context, userId, postId uint64) error {
+	ctx, span := tracing.Start(ctx, "post.DislikePost")
+	defer span.End()
+
+	return l.ratePost(ctx, userId, postId, model.Dislike)
+}
+
+func (l *logic) UnratePost(ctx context.Context, userId, postId uint64) error {
+	ctx, span := tracing.Start(ctx, "post.UnratePost")
+	defer span.End()
+
+	err := l.rateRepository.Delete(ctx, userId, postId)
+	if err != nil {
+		return errors.Wrap(err, "rate repository error")
+	}
+
+	err = l.publishRates(ctx, postId)
+	if err != nil {
+		return errors.Wrap(err, "publishRates error")
+	}
+
+	return nil
+}
+
+// ratePost reads and changes the rate in one transaction: two concurrent
+// rates of the same user would otherwise both try to create it.
+func (l *logic) ratePost(ctx context.Context, userId, postId uint64, newRate model.Rate) error {
+	var changed bool
+	err := l.txManager.Do(ctx, func(ctx context.Context) error {
+		changed = false
+
+		rate, err := l.rateRepository.GetRate(ctx, userId, postId)
+		if err != nil && !errors.Is(err, model.ErrNotFound) {
+			return errors.Wrap(err, "rate repository error")
+		} else if err != nil {
+			err = l.rateRepository.Create(ctx, userId, postId, newRate)
+			if err != nil {
+				return errors.Wrap(err, "rate repository error")
+			}
+			changed = true
+		} else if rate != newRate {
+			err = l.rateRepository.Update(ctx, userId, postId, newRate)
 			if err != nil {
 				return errors.Wrap(err, "rate repository error")
 			}
+			changed = true
 		}
+
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	// rating the same way again isn't counted
+	if changed && newRate == model.Like {
+		metrics.Rates.WithLabelValues("like").Inc()
+	} else if changed {
+		metrics.Rates.WithLabelValues("dislike").Inc()
+	}
 
-func (l *logic) UnratePost(userId, postId uint64) error {
-	err := l.rateRepository.Delete(userId, postId)
+	// published after the commit, a retried transaction mustn't publish twice
+	err = l.publishRates(ctx, postId)
 	if err != nil {
-		return errors.Wrap(err, "rate repository error")
+		return errors.Wrap(err, "publishRates error")
 	}
 
 	return nil
 }
 
-func (l *logic) addUserInfo(post *model.Post) error {
-	user, err := l.userRepository.GetUserByID(post.UserID)
+func (l *logic) addUserInfo(ctx context.Context, post *model.Post) error {
+	user, err := l.userRepository.GetUserByID(ctx, post.UserID)
 	if err != nil {
 		return errors.Wrap(err, "user repository error")
 	}
@@ -206,29 +395,81 @@ func (l *logic) addUserInfo(post *model.Post) error {
 	return nil
 }
 
-func (l *logic) addRateInfo(userId uint64, post *model.Post) error {
-	rate, err := l.rateRepository.GetRate(userId, post.ID)
-	if err != nil && !errors.Is(err, model.ErrNotFound) {
+// addPostsInfo fills in the authors, the rates and the saves of a page of
+// posts, with one query for each whatever the page size.
+func (l *logic) addPostsInfo(ctx context.Context, userId uint64, posts []*model.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIds := make([]uint64, len(posts))
+	userIds := make([]uint64, len(posts))
+	for i, post := range posts {
+		postIds[i] = post.ID
+		userIds[i] = post.UserID
+	}
+
+	users, err := l.userRepository.GetUsersByIDs(ctx, userIds)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	logins := make(map[uint64]string, len(users))
+	for _, user := range users {
+		logins[user.ID] = user.Login
+	}
+
+	rates, err := l.rateRepository.GetPostsRates(ctx, userId, postIds)
+	if err != nil {
 		return errors.Wrap(err, "rate repository error")
-	} else if err != nil {
-		post.IsLiked = false
-		post.IsDisliked = false
-	} else {
-		if rate == model.Like {
-			post.IsLiked = true
-			post.IsDisliked = false
-		} else {
-			post.IsLiked = false
-			post.IsDisliked = true
+	}
+
+	rateCnts, err := l.rateRepository.GetPostsRatesCnts(ctx, postIds)
+	if err != nil {
+		return errors.Wrap(err, "rate repository error")
+	}
+
+	saved, err := l.collectionRepository.GetSavedPosts(ctx, userId, postIds)
+	if err != nil {
+		return errors.Wrap(err, "collection repository error")
+	}
+
+	saveCnts, err := l.collectionRepository.GetSaveCnts(ctx, postIds)
+	if err != nil {
+		return errors.Wrap(err, "collection repository error")
+	}
+
+	for _, post := range posts {
+		login, ok := logins[post.UserID]
+		if !ok {
+			return errors.Wrapf(model.ErrNotFound, "user repository error: no user %d", post.UserID)
 		}
+		post.UserName = login
+
+		rate, rated := rates[post.ID]
+		post.IsLiked = rated && rate == model.Like
+		post.IsDisliked = rated && rate == model.Dislike
+
+		post.LikeCnt = rateCnts[post.ID].LikeCnt
+		post.DislikeCnt = rateCnts[post.ID].DislikeCnt
+		post.IsSaved = saved[post.ID]
+		post.SaveCnt = saveCnts[post.ID]
 	}
 
-	rateCnt, err := l.rateRepository.GetRatesCnts(post.ID)
+	return nil
+}
+
+func (l *logic) publishRates(ctx context.Context, postId uint64) error {
+	rateCnt, err := l.rateRepository.GetRatesCnts(ctx, postId)
 	if err != nil {
 		return errors.Wrap(err, "rate repository error")
 	}
 
-	post.LikeCnt = rateCnt.LikeCnt
-	post.DislikeCnt = rateCnt.DislikeCnt
+	l.eventPublisher.Publish(ctx, &model.Event{
+		Type:      model.EventRate,
+		PostID:    postId,
+		RatesCnts: &rateCnt,
+	})
+
 	return nil
 }
@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) GetPost(_ context.Context, postId uint64) (*model.Post, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	post := memdb.Find(mr.db.Posts, func(p *model.Post) bool { return p.ID == postId })
+	if post == nil {
+		return nil, model.ErrNotFound
+	}
+
+	return copyPost(post), nil
+}
+
+func (mr *memoryRepo) GetUsersPosts(_ context.Context, ownerId uint64) ([]*model.Post, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	posts := memdb.Filter(mr.db.Posts, func(p *model.Post) bool {
+		return p.UserID == ownerId && mr.visible(p)
+	})
+
+	return copyPostsDesc(posts), nil
+}
+
+// GetAllUsersPosts returns hidden posts too, it's for the owner's own data only.
+func (mr *memoryRepo) GetAllUsersPosts(_ context.Context, ownerId uint64) ([]*model.Post, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	posts := memdb.Filter(mr.db.Posts, func(p *model.Post) bool { return p.UserID == ownerId })
+
+	copied := make([]*model.Post, len(posts))
+	for i, post := range posts {
+		copied[i] = copyPost(post)
+	}
+
+	return copied, nil
+}
+
+func (mr *memoryRepo) IsImageUsed(_ context.Context, imageId string) (bool, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return memdb.Find(mr.db.Posts, func(p *model.Post) bool { return p.ImageID == imageId }) != nil, nil
+}
+
+func (mr *memoryRepo) GetUsersPostsCnt(_ context.Context, ownerId uint64) (int, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return memdb.Count(mr.db.Posts, func(p *model.Post) bool {
+		return p.UserID == ownerId && mr.visible(p)
+	}), nil
+}
+
+func (mr *memoryRepo) GetPostsWithParams(_ context.Context, params model.PostParams) ([]*model.Post, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	posts := memdb.Filter(mr.db.Posts, func(p *model.Post) bool {
+		return matchParams(p, params) && mr.visible(p)
+	})
+
+	return paginatePosts(mr.rank(posts, params), params), nil
+}
+
+func (mr *memoryRepo) GetFollowingPosts(_ context.Context, followerId uint64, params model.PostParams) ([]*model.Post, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	posts := memdb.Filter(mr.db.Posts, func(p *model.Post) bool {
+		followed := memdb.Find(mr.db.Follows, func(f *memdb.Follow) bool {
+			return f.FollowerID == followerId && f.FolloweeID == p.UserID
+		}) != nil
+
+		return followed && matchParams(p, params) && mr.visible(p)
+	})
+
+	return paginatePosts(mr.rank(posts, params), params), nil
+}
+
+func (mr *memoryRepo) CreatePost(_ context.Context, post *model.Post) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	post.Date = time.Now()
+	post.ID = mr.db.NextID("posts")
+	mr.db.Posts = append(mr.db.Posts, &model.Post{
+		ID:          post.ID,
+		UserID:      post.UserID,
+		Date:        post.Date,
+		ImageID:     post.ImageID,
+		Category:    post.Category,
+		Sex:         post.Sex,
+		Brand:       post.Brand,
+		Description: post.Description,
+		Link:        post.Link,
+		IsHidden:    post.IsHidden,
+	})
+
+	return nil
+}
+
+func (mr *memoryRepo) SetPostHidden(_ context.Context, postId uint64, hidden bool) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	post := memdb.Find(mr.db.Posts, func(p *model.Post) bool { return p.ID == postId })
+	if post != nil {
+		post.IsHidden = hidden
+	}
+
+	return nil
+}
+
+// DeletePost takes the comments, rates and collection entries of the post
+// along, like the foreign keys do in Postgres.
+func (mr *memoryRepo) DeletePost(_ context.Context, postId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Posts, func(p *model.Post) bool { return p.ID == postId })
+	memdb.Delete(&mr.db.PostScores, func(ps *model.PostScore) bool { return ps.PostID == postId })
+	memdb.Delete(&mr.db.Comments, func(c *model.Comment) bool { return c.PostID == postId })
+	memdb.Delete(&mr.db.Rates, func(r *memdb.Rate) bool { return r.PostID == postId })
+	memdb.Delete(&mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool { return cp.PostID == postId })
+
+	return nil
+}
+
+// GetPostStats counts the votes of the posts made since then, hidden
+// comments aren't counted.
+func (mr *memoryRepo) GetPostStats(_ context.Context, since time.Time) ([]*model.PostStats, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	var stats []*model.PostStats
+	for _, post := range mr.db.Posts {
+		if post.Date.Before(since) {
+			continue
+		}
+
+		stats = append(stats, &model.PostStats{
+			PostID: post.ID,
+			Date:   post.Date,
+			LikeCnt: memdb.Count(mr.db.Rates, func(r *memdb.Rate) bool {
+				return r.PostID == post.ID && r.Rate == model.Like
+			}),
+			DislikeCnt: memdb.Count(mr.db.Rates, func(r *memdb.Rate) bool {
+				return r.PostID == post.ID && r.Rate == model.Dislike
+			}),
+			CommentCnt: memdb.Count(mr.db.Comments, func(c *model.Comment) bool {
+				return c.PostID == post.ID && !c.IsHidden
+			}),
+		})
+	}
+
+	return stats, nil
+}
+
+func (mr *memoryRepo) SaveScores(_ context.Context, scores []*model.PostScore) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	for _, score := range scores {
+		saved := memdb.Find(mr.db.PostScores, func(ps *model.PostScore) bool { return ps.PostID == score.PostID })
+		if saved == nil {
+			saved = &model.PostScore{PostID: score.PostID}
+			mr.db.PostScores = append(mr.db.PostScores, saved)
+		}
+		saved.Score = score.Score
+		saved.Hot = score.Hot
+	}
+
+	return nil
+}
+
+func (mr *memoryRepo) ClaimScoring(_ context.Context, lease time.Duration) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	now := time.Now()
+	if mr.db.ScoringLease.After(now) {
+		return model.ErrNotFound
+	}
+	mr.db.ScoringLease = now.Add(lease)
+
+	return nil
+}
+
+// rank copies posts in the order params ask, like rank of the Postgres
+// repository: unscored posts are the last in hot order and have no votes in top.
+func (mr *memoryRepo) rank(posts []*model.Post, params model.PostParams) []*model.Post {
+	ranked := copyPostsDesc(posts)
+
+	scores := make(map[uint64]*model.PostScore, len(mr.db.PostScores))
+	for _, score := range mr.db.PostScores {
+		scores[score.PostID] = score
+	}
+
+	switch params.Sort {
+	case model.SortHot:
+		sort.SliceStable(ranked, func(i, j int) bool {
+			a, b := scores[ranked[i].ID], scores[ranked[j].ID]
+			return a != nil && (b == nil || a.Hot > b.Hot)
+		})
+	case model.SortTop:
+		score := func(post *model.Post) int {
+			if scores[post.ID] == nil {
+				return 0
+			}
+			return scores[post.ID].Score
+		}
+		sort.SliceStable(ranked, func(i, j int) bool {
+			return score(ranked[i]) > score(ranked[j])
+		})
+	}
+
+	return ranked
+}
+
+// visible tells whether the post is shown to others: not hidden
+// and not by a banned author.
+func (mr *memoryRepo) visible(post *model.Post) bool {
+	if post.IsHidden {
+		return false
+	}
+
+	author := memdb.Find(mr.db.Users, func(u *model.User) bool { return u.ID == post.UserID })
+	return author == nil || author.Status != model.UserBanned
+}
+
+func matchParams(post *model.Post, params model.PostParams) bool {
+	return (params.Sex == "" || post.Sex == params.Sex) &&
+		(params.Category == "" || post.Category == params.Category) &&
+		!post.Date.Before(params.Since)
+}
+
+func copyPost(post *model.Post) *model.Post {
+	copied := *post
+	return &copied
+}
+
+// copyPostsDesc copies posts newest first.
+func copyPostsDesc(posts []*model.Post) []*model.Post {
+	copied := make([]*model.Post, len(posts))
+	for i, post := range posts {
+		copied[len(posts)-1-i] = copyPost(post)
+	}
+
+	return copied
+}
+
+func paginatePosts(posts []*model.Post, params model.PostParams) []*model.Post {
+	if params.Offset > 0 {
+		if params.Offset >= len(posts) {
+			return posts[:0]
+		}
+		posts = posts[params.Offset:]
+	}
+	if params.Limit > 0 && params.Limit < len(posts) {
+		posts = posts[:params.Limit]
+	}
+
+	return posts
+}
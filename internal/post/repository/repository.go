@@ -1,13 +1,18 @@
 package repository
 
 import (
+	"context"
 	"time"
 
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+const notBannedAuthor = "user_id NOT IN (SELECT id FROM users WHERE status = 'banned')"
+
 type pgPost struct {
 	ID          uint64
 	UserID      uint64
@@ -18,6 +23,7 @@ type pgPost struct {
 	Brand       string
 	Description string
 	Link        string
+	IsHidden    bool
 }
 
 func (p pgPost) toModelPost() *model.Post {
@@ -31,6 +37,7 @@ func (p pgPost) toModelPost() *model.Post {
 		Brand:       p.Brand,
 		Description: p.Description,
 		Link:        p.Link,
+		IsHidden:    p.IsHidden,
 	}
 }
 
@@ -55,6 +62,7 @@ func fromModelPost(p *model.Post) *pgPost {
 		Brand:       p.Brand,
 		Description: p.Description,
 		Link:        p.Link,
+		IsHidden:    p.IsHidden,
 	}
 }
 
@@ -62,6 +70,28 @@ func (pgPost) TableName() string {
 	return "posts"
 }
 
+type pgPostScore struct {
+	PostID     uint64 `gorm:"primaryKey"`
+	Score      int
+	Hot        float64
+	ComputedAt time.Time
+}
+
+func (pgPostScore) TableName() string {
+	return "post_scores"
+}
+
+type pgPostStats struct {
+	PostID     uint64
+	CreatedAt  time.Time
+	LikeCnt    int
+	DislikeCnt int
+	CommentCnt int
+}
+
+// scores are upserted this many at a time
+const scoreBatch = 500
+
 type pgRepo struct {
 	db *gorm.DB
 }
@@ -72,10 +102,10 @@ func NewPgRepo(db *gorm.DB) *pgRepo {
 	}
 }
 
-func (pr *pgRepo) GetPost(postId uint64) (*model.Post, error) {
+func (pr *pgRepo) GetPost(ctx context.Context, postId uint64) (*model.Post, error) {
 	var pst pgPost
 
-	tx := pr.db.Where("id = ?", postId).Take(&pst)
+	tx := txmanager.DB(ctx, pr.db).Where("id = ?", postId).Take(&pst)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -85,10 +115,58 @@ func (pr *pgRepo) GetPost(postId uint64) (*model.Post, error) {
 	return pst.toModelPost(), nil
 }
 
-func (pr *pgRepo) GetUsersPosts(ownerId uint64) ([]*model.Post, error) {
+func (pr *pgRepo) GetUsersPosts(ctx context.Context, ownerId uint64) ([]*model.Post, error) {
+	posts := make([]*pgPost, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Where(&pgPost{UserID: ownerId}).Where("NOT is_hidden").Where(notBannedAuthor).Order("id desc").Find(&posts)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table posts)")
+	}
+
+	return toModelPosts(posts), nil
+}
+
+// GetAllUsersPosts returns hidden posts too, it's for the owner's own data only.
+func (pr *pgRepo) GetAllUsersPosts(ctx context.Context, ownerId uint64) ([]*model.Post, error) {
+	posts := make([]*pgPost, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Where(&pgPost{UserID: ownerId}).Order("id").Find(&posts)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table posts)")
+	}
+
+	return toModelPosts(posts), nil
+}
+
+func (pr *pgRepo) IsImageUsed(ctx context.Context, imageId string) (bool, error) {
+	var cnt int64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgPost{}).Where("image_id = ?", imageId).Count(&cnt)
+	if tx.Error != nil {
+		return false, errors.Wrap(tx.Error, "database error (table posts)")
+	}
+
+	return cnt > 0, nil
+}
+
+func (pr *pgRepo) GetUsersPostsCnt(ctx context.Context, ownerId uint64) (int, error) {
+	var cnt int64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgPost{}).Where(&pgPost{UserID: ownerId}).Where("NOT is_hidden").Where(notBannedAuthor).Count(&cnt)
+	if tx.Error != nil {
+		return 0, errors.Wrap(tx.Error, "database error (table posts)")
+	}
+
+	return int(cnt), nil
+}
+
+func (pr *pgRepo) GetPostsWithParams(ctx context.Context, params model.PostParams) ([]*model.Post, error) {
 	posts := make([]*pgPost, 0, 10)
 
-	tx := pr.db.Where(&pgPost{UserID: ownerId}).Order("id desc").Find(&posts)
+	tx := rank(paginate(txmanager.DB(ctx, pr.db), params), params).Where(fromModelPost(params.ToPost())).Where("NOT is_hidden").
+		Where(notBannedAuthor).Find(&posts)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -98,10 +176,12 @@ func (pr *pgRepo) GetUsersPosts(ownerId uint64) ([]*model.Post, error) {
 	return toModelPosts(posts), nil
 }
 
-func (pr *pgRepo) GetPostsWithParams(params model.PostParams) ([]*model.Post, error) {
+func (pr *pgRepo) GetFollowingPosts(ctx context.Context, followerId uint64, params model.PostParams) ([]*model.Post, error) {
 	posts := make([]*pgPost, 0, 10)
 
-	tx := pr.db.Where(fromModelPost(params.ToPost())).Order("id desc").Find(&posts)
+	tx := rank(paginate(txmanager.DB(ctx, pr.db), params), params).Where(fromModelPost(params.ToPost())).Where("NOT is_hidden").
+		Where(notBannedAuthor).Where("user_id IN (SELECT followee_id FROM follows WHERE follower_id = ?)", followerId).
+		Find(&posts)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -111,11 +191,11 @@ func (pr *pgRepo) GetPostsWithParams(params model.PostParams) ([]*model.Post, er
 	return toModelPosts(posts), nil
 }
 
-func (pr *pgRepo) CreatePost(post *model.Post) error {
+func (pr *pgRepo) CreatePost(ctx context.Context, post *model.Post) error {
 	post.Date = time.Now()
 	pgPost := fromModelPost(post)
 
-	tx := pr.db.Create(pgPost)
+	tx := txmanager.DB(ctx, pr.db).Create(pgPost)
 	if tx.Error != nil {
 		return errors.Wrap(tx.Error, "database error (table posts)")
 	}
@@ -124,11 +204,130 @@ func (pr *pgRepo) CreatePost(post *model.Post) error {
 	return nil
 }
 
-func (pr *pgRepo) DeletePost(postId uint64) error {
-	tx := pr.db.Delete(&pgPost{}, postId)
+func (pr *pgRepo) SetPostHidden(ctx context.Context, postId uint64, hidden bool) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgPost{ID: postId}).Update("is_hidden", hidden)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table posts)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) DeletePost(ctx context.Context, postId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Delete(&pgPost{}, postId)
 	if tx.Error != nil {
 		return errors.Wrap(tx.Error, "database error (table posts)")
 	}
 
 	return nil
 }
+
+const postStatsQuery = `
+SELECT id AS post_id, created_at,
+	(SELECT count(*) FROM post_rates WHERE post_id = posts.id AND rate) AS like_cnt,
+	(SELECT count(*) FROM post_rates WHERE post_id = posts.id AND NOT rate) AS dislike_cnt,
+	(SELECT count(*) FROM comments WHERE post_id = posts.id AND NOT is_hidden) AS comment_cnt
+FROM posts
+WHERE created_at >= ?
+ORDER BY id`
+
+// GetPostStats counts the votes of the posts made since then, hidden
+// comments aren't counted.
+func (pr *pgRepo) GetPostStats(ctx context.Context, since time.Time) ([]*model.PostStats, error) {
+	stats := make([]*pgPostStats, 0, 100)
+
+	tx := txmanager.DB(ctx, pr.db).Raw(postStatsQuery, since).Scan(&stats)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table posts)")
+	}
+
+	modelStats := make([]*model.PostStats, len(stats))
+	for i, st := range stats {
+		modelStats[i] = &model.PostStats{
+			PostID:     st.PostID,
+			Date:       st.CreatedAt,
+			LikeCnt:    st.LikeCnt,
+			DislikeCnt: st.DislikeCnt,
+			CommentCnt: st.CommentCnt,
+		}
+	}
+
+	return modelStats, nil
+}
+
+// SaveScores fails if one of the posts is gone, the next scoring
+// doesn't see it anymore.
+func (pr *pgRepo) SaveScores(ctx context.Context, scores []*model.PostScore) error {
+	if len(scores) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	pgScores := make([]*pgPostScore, len(scores))
+	for i, score := range scores {
+		pgScores[i] = &pgPostScore{
+			PostID:     score.PostID,
+			Score:      score.Score,
+			Hot:        score.Hot,
+			ComputedAt: now,
+		}
+	}
+
+	tx := txmanager.DB(ctx, pr.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "post_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"score", "hot", "computed_at"}),
+	}).CreateInBatches(pgScores, scoreBatch)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table post_scores)")
+	}
+
+	return nil
+}
+
+// ClaimScoring takes the scoring for the lease time if no other server
+// holds it, so a scoring dropped by a crashed server is picked up again.
+func (pr *pgRepo) ClaimScoring(ctx context.Context, lease time.Duration) error {
+	now := time.Now()
+
+	tx := txmanager.DB(ctx, pr.db).Exec(
+		"UPDATE scoring_lease SET locked_until = ? WHERE locked_until IS NULL OR locked_until < ?",
+		now.Add(lease), now,
+	)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table scoring_lease)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// rank orders the posts as params ask, the ranked orders join the scores:
+// a post not scored yet is the last in hot order and has no votes in top.
+func rank(db *gorm.DB, params model.PostParams) *gorm.DB {
+	if !params.Since.IsZero() {
+		db = db.Where("posts.created_at >= ?", params.Since)
+	}
+
+	switch params.Sort {
+	case model.SortHot:
+		return db.Joins("LEFT JOIN post_scores ON post_scores.post_id = posts.id").
+			Order("post_scores.hot DESC NULLS LAST").Order("posts.id desc")
+	case model.SortTop:
+		return db.Joins("LEFT JOIN post_scores ON post_scores.post_id = posts.id").
+			Order("COALESCE(post_scores.score, 0) DESC").Order("posts.id desc")
+	default:
+		return db.Order("id desc")
+	}
+}
+
+func paginate(db *gorm.DB, params model.PostParams) *gorm.DB {
+	if params.Limit > 0 {
+		db = db.Limit(params.Limit)
+	}
+	if params.Offset > 0 {
+		db = db.Offset(params.Offset)
+	}
+
+	return db
+}
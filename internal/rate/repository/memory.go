@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) GetRate(_ context.Context, userId, postId uint64) (model.Rate, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	rt := mr.find(userId, postId)
+	if rt == nil {
+		return model.Dislike, model.ErrNotFound
+	}
+
+	return rt.Rate, nil
+}
+
+func (mr *memoryRepo) GetRatesCnts(_ context.Context, postId uint64) (model.RatesCnts, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return countRates(memdb.Filter(mr.db.Rates, func(r *memdb.Rate) bool { return r.PostID == postId })), nil
+}
+
+func (mr *memoryRepo) GetPostsRates(_ context.Context, userId uint64, postIds []uint64) (map[uint64]model.Rate, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	byPost := make(map[uint64]model.Rate)
+	for _, postId := range postIds {
+		if rt := mr.find(userId, postId); rt != nil {
+			byPost[postId] = rt.Rate
+		}
+	}
+
+	return byPost, nil
+}
+
+func (mr *memoryRepo) GetPostsRatesCnts(_ context.Context, postIds []uint64) (map[uint64]model.RatesCnts, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	byPost := make(map[uint64]model.RatesCnts)
+	for _, postId := range postIds {
+		rates := memdb.Filter(mr.db.Rates, func(r *memdb.Rate) bool { return r.PostID == postId })
+		if len(rates) > 0 {
+			byPost[postId] = countRates(rates)
+		}
+	}
+
+	return byPost, nil
+}
+
+func (mr *memoryRepo) GetUsersRatesCnts(_ context.Context, ownerId uint64) (model.RatesCnts, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return countRates(memdb.Filter(mr.db.Rates, func(r *memdb.Rate) bool {
+		return memdb.Find(mr.db.Posts, func(p *model.Post) bool {
+			return p.ID == r.PostID && p.UserID == ownerId
+		}) != nil
+	})), nil
+}
+
+func (mr *memoryRepo) GetUsersRates(_ context.Context, userId uint64) ([]*model.PostRate, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	rates := memdb.Filter(mr.db.Rates, func(r *memdb.Rate) bool { return r.UserID == userId })
+
+	modelRates := make([]*model.PostRate, len(rates))
+	for i, rt := range rates {
+		modelRates[i] = &model.PostRate{PostID: rt.PostID, Rate: rt.Rate}
+	}
+	sort.Slice(modelRates, func(i, j int) bool { return modelRates[i].PostID < modelRates[j].PostID })
+
+	return modelRates, nil
+}
+
+func (mr *memoryRepo) Create(_ context.Context, userId, postId uint64, rate model.Rate) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	if mr.find(userId, postId) != nil {
+		return errors.New("database error (table rates): duplicate rate")
+	}
+
+	mr.db.Rates = append(mr.db.Rates, &memdb.Rate{UserID: userId, PostID: postId, Rate: rate})
+
+	return nil
+}
+
+func (mr *memoryRepo) Update(_ context.Context, userId, postId uint64, rate model.Rate) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	rt := mr.find(userId, postId)
+	if rt == nil {
+		return model.ErrNotFound
+	}
+	rt.Rate = rate
+
+	return nil
+}
+
+func (mr *memoryRepo) Delete(_ context.Context, userId, postId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Rates, func(r *memdb.Rate) bool { return r.UserID == userId && r.PostID == postId })
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteUsersRates(_ context.Context, userId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.Rates, func(r *memdb.Rate) bool { return r.UserID == userId })
+
+	return nil
+}
+
+func (mr *memoryRepo) find(userId, postId uint64) *memdb.Rate {
+	return memdb.Find(mr.db.Rates, func(r *memdb.Rate) bool { return r.UserID == userId && r.PostID == postId })
+}
+
+func countRates(rates []*memdb.Rate) model.RatesCnts {
+	var cnts model.RatesCnts
+	for _, rt := range rates {
+		if rt.Rate == model.Like {
+			cnts.LikeCnt++
+		} else {
+			cnts.DislikeCnt++
+		}
+	}
+
+	return cnts
+}
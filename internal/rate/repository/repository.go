@@ -1,6 +1,9 @@
 package repository
 
 import (
+	"context"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
@@ -34,10 +37,10 @@ func NewPgRepo(db *gorm.DB) *pgRepo {
 	}
 }
 
-func (pr *pgRepo) GetRate(userId, postId uint64) (model.Rate, error) {
+func (pr *pgRepo) GetRate(ctx context.Context, userId, postId uint64) (model.Rate, error) {
 	var rt pgRate
 
-	tx := pr.db.Where("user_id = ? AND post_id >= ?", userId, postId).Take(&rt)
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ? AND post_id = ?", userId, postId).Take(&rt)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return model.Dislike, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -47,15 +50,75 @@ func (pr *pgRepo) GetRate(userId, postId uint64) (model.Rate, error) {
 	return model.Rate(rt.Rate), nil
 }
 
-func (pr *pgRepo) GetRatesCnts(postId uint64) (model.RatesCnts, error) {
+func (pr *pgRepo) GetRatesCnts(ctx context.Context, postId uint64) (model.RatesCnts, error) {
+	var likes, dislikes int64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgRate{}).Where("post_id = ? AND rate = ?", postId, model.Like).Count(&likes)
+	if tx.Error != nil {
+		return model.RatesCnts{}, errors.Wrap(tx.Error, "database error (table rates)")
+	}
+
+	tx = txmanager.DB(ctx, pr.db).Model(&pgRate{}).Where("post_id = ? AND rate = ?", postId, model.Dislike).Count(&dislikes)
+	if tx.Error != nil {
+		return model.RatesCnts{}, errors.Wrap(tx.Error, "database error (table rates)")
+	}
+
+	return model.RatesCnts{LikeCnt: int(likes), DislikeCnt: int(dislikes)}, nil
+}
+
+// GetPostsRates returns the rates userId gave the posts by post id,
+// leaving out the posts the user didn't rate.
+func (pr *pgRepo) GetPostsRates(ctx context.Context, userId uint64, postIds []uint64) (map[uint64]model.Rate, error) {
+	rates := make([]*pgRate, 0, len(postIds))
+
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ? AND post_id IN ?", userId, postIds).Find(&rates)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table rates)")
+	}
+
+	byPost := make(map[uint64]model.Rate, len(rates))
+	for _, rt := range rates {
+		byPost[rt.PostId] = model.Rate(rt.Rate)
+	}
+
+	return byPost, nil
+}
+
+// GetPostsRatesCnts returns the rate counts of the posts by post id,
+// leaving out the posts nobody rated.
+func (pr *pgRepo) GetPostsRatesCnts(ctx context.Context, postIds []uint64) (map[uint64]model.RatesCnts, error) {
+	var rows []struct {
+		PostId     uint64
+		LikeCnt    int
+		DislikeCnt int
+	}
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgRate{}).
+		Select("post_id, COUNT(*) FILTER (WHERE rate) AS like_cnt, COUNT(*) FILTER (WHERE NOT rate) AS dislike_cnt").
+		Where("post_id IN ?", postIds).Group("post_id").Scan(&rows)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table rates)")
+	}
+
+	byPost := make(map[uint64]model.RatesCnts, len(rows))
+	for _, row := range rows {
+		byPost[row.PostId] = model.RatesCnts{LikeCnt: row.LikeCnt, DislikeCnt: row.DislikeCnt}
+	}
+
+	return byPost, nil
+}
+
+func (pr *pgRepo) GetUsersRatesCnts(ctx context.Context, ownerId uint64) (model.RatesCnts, error) {
 	var likes, dislikes int64
 
-	tx := pr.db.Model(&pgRate{}).Where("post_id >= ? AND rate = ?", postId, model.Like).Count(&likes)
+	tx := txmanager.DB(ctx, pr.db).Model(&pgRate{}).Joins("JOIN posts ON posts.id = post_rates.post_id").
+		Where("posts.user_id = ? AND post_rates.rate = ?", ownerId, model.Like).Count(&likes)
 	if tx.Error != nil {
 		return model.RatesCnts{}, errors.Wrap(tx.Error, "database error (table rates)")
 	}
 
-	tx = pr.db.Model(&pgRate{}).Where("post_id >= ? AND rate = ?", postId, model.Dislike).Count(&dislikes)
+	tx = txmanager.DB(ctx, pr.db).Model(&pgRate{}).Joins("JOIN posts ON posts.id = post_rates.post_id").
+		Where("posts.user_id = ? AND post_rates.rate = ?", ownerId, model.Dislike).Count(&dislikes)
 	if tx.Error != nil {
 		return model.RatesCnts{}, errors.Wrap(tx.Error, "database error (table rates)")
 	}
@@ -63,8 +126,24 @@ func (pr *pgRepo) GetRatesCnts(postId uint64) (model.RatesCnts, error) {
 	return model.RatesCnts{LikeCnt: int(likes), DislikeCnt: int(dislikes)}, nil
 }
 
-func (pr *pgRepo) Create(userId, postId uint64, rate model.Rate) error {
-	tx := pr.db.Create(&pgRate{UserId: userId, PostId: postId, Rate: bool(rate)})
+func (pr *pgRepo) GetUsersRates(ctx context.Context, userId uint64) ([]*model.PostRate, error) {
+	rates := make([]*pgRate, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Order("post_id").Find(&rates)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table rates)")
+	}
+
+	modelRates := make([]*model.PostRate, len(rates))
+	for i, rt := range rates {
+		modelRates[i] = &model.PostRate{PostID: rt.PostId, Rate: model.Rate(rt.Rate)}
+	}
+
+	return modelRates, nil
+}
+
+func (pr *pgRepo) Create(ctx context.Context, userId, postId uint64, rate model.Rate) error {
+	tx := txmanager.DB(ctx, pr.db).Create(&pgRate{UserId: userId, PostId: postId, Rate: bool(rate)})
 	if tx.Error != nil {
 		return errors.Wrap(tx.Error, "database error (table rates)")
 	}
@@ -72,21 +151,30 @@ func (pr *pgRepo) Create(userId, postId uint64, rate model.Rate) error {
 	return nil
 }
 
-func (pr *pgRepo) Update(userId, postId uint64, rate model.Rate) error {
-	rt := &pgRate{UserId: userId, PostId: postId, Rate: bool(rate)}
-
-	tx := pr.db.Omit("user_id", "post_id").Updates(rt)
-	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+func (pr *pgRepo) Update(ctx context.Context, userId, postId uint64, rate model.Rate) error {
+	// pgRate has no primary key to update by, and Updates would skip a false rate
+	tx := txmanager.DB(ctx, pr.db).Model(&pgRate{}).Where("user_id = ? AND post_id = ?", userId, postId).
+		Update("rate", bool(rate))
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table rates)")
+	} else if tx.RowsAffected == 0 {
 		return model.ErrNotFound
-	} else if tx.Error != nil {
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) Delete(ctx context.Context, userId, postId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where(&pgRate{UserId: userId, PostId: postId}).Delete(&pgRate{})
+	if tx.Error != nil {
 		return errors.Wrap(tx.Error, "database error (table rates)")
 	}
 
 	return nil
 }
 
-func (pr *pgRepo) Delete(userId, postId uint64) error {
-	tx := pr.db.Where(&pgRate{UserId: userId, PostId: postId}).Delete(&pgRate{})
+func (pr *pgRepo) DeleteUsersRates(ctx context.Context, userId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Delete(&pgRate{})
 	if tx.Error != nil {
 		return errors.Wrap(tx.Error, "database error (table rates)")
 	}
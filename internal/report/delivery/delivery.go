@@ -0,0 +1,171 @@
+package delivery
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+type ReportLogic interface {
+	ReportPost(ctx context.Context, report *model.Report) error
+	ReportComment(ctx context.Context, report *model.Report) error
+	GetReports(ctx context.Context, status string) ([]*model.Report, error)
+	ResolveReport(ctx context.Context, resolution *model.ReportResolution) (*model.Report, error)
+}
+
+type RoleMiddleware interface {
+	RequireRole(role string) echo.MiddlewareFunc
+}
+
+type handler struct {
+	reportService ReportLogic
+}
+
+func NewHandler(reportService ReportLogic) *handler {
+	return &handler{
+		reportService: reportService,
+	}
+}
+
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, roles RoleMiddleware) {
+	e.POST("/posts/:postID/report", h.ReportPost, auth)
+	e.POST("/comments/:commentID/report", h.ReportComment, auth)
+
+	moderator := roles.RequireRole(model.RoleModerator)
+	e.GET("/reports", h.GetReports, auth, moderator)
+	e.PUT("/reports/:reportID", h.ResolveReport, auth, moderator)
+}
+
+func (h *handler) ReportPost(c echo.Context) error {
+	postId, err := strconv.ParseUint(c.Param("postID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	report, err := bindReport(c)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	report.ReporterID = userClaims.User.ID
+	report.TargetID = postId
+
+	err = h.reportService.ReportPost(c.Request().Context(), report)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, dto.RespReportFromReport(report))
+}
+
+func (h *handler) ReportComment(c echo.Context) error {
+	commentId, err := strconv.ParseUint(c.Param("commentID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	report, err := bindReport(c)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	report.ReporterID = userClaims.User.ID
+	report.TargetID = commentId
+
+	err = h.reportService.ReportComment(c.Request().Context(), report)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, dto.RespReportFromReport(report))
+}
+
+func (h *handler) GetReports(c echo.Context) error {
+	var reqParams dto.ReqReportParams
+	err := c.Bind(&reqParams)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqParams)
+	if err != nil {
+		return err
+	}
+
+	reports, err := h.reportService.GetReports(c.Request().Context(), reqParams.Status)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespReportsFromReports(reports))
+}
+
+func (h *handler) ResolveReport(c echo.Context) error {
+	reportId, err := strconv.ParseUint(c.Param("reportID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	var reqResolution dto.ReqResolution
+	err = c.Bind(&reqResolution)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqResolution)
+	if err != nil {
+		return err
+	}
+
+	resolution := reqResolution.ToResolution()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	resolution.ReportID = reportId
+	resolution.ModeratorID = userClaims.User.ID
+	resolution.ModeratorRole = userClaims.User.Role
+
+	report, err := h.reportService.ResolveReport(c.Request().Context(), resolution)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespReportFromReport(report))
+}
+
+func bindReport(c echo.Context) (*model.Report, error) {
+	var reqReport dto.ReqReport
+	err := c.Bind(&reqReport)
+	if err != nil {
+		return nil, errors.Wrap(err, "bind error")
+	}
+
+	_, err = govalidator.ValidateStruct(reqReport)
+	if err != nil {
+		return nil, errors.Wrap(err, "validation error")
+	}
+
+	return reqReport.ToReport(), nil
+}
@@ -0,0 +1,289 @@
+package logic
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type ReportRepository interface {
+	GetReport(ctx context.Context, reportId uint64) (*model.Report, error)
+	GetReports(ctx context.Context, status string) ([]*model.Report, error)
+	CreateReport(ctx context.Context, report *model.Report) error
+	GetOpenReportsCnt(ctx context.Context, targetType string, targetId uint64) (int, error)
+	CloseTargetReports(ctx context.Context, targetType string, targetId uint64, status string, moderatorId uint64) error
+}
+
+type PostRepository interface {
+	GetPost(ctx context.Context, postId uint64) (*model.Post, error)
+	SetPostHidden(ctx context.Context, postId uint64, hidden bool) error
+}
+
+type CommentRepository interface {
+	GetComment(ctx context.Context, commentId uint64) (*model.Comment, error)
+	SetCommentHidden(ctx context.Context, commentId uint64, hidden bool) error
+}
+
+type UserRepository interface {
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	UpdateStatus(ctx context.Context, status *model.UserStatus) error
+}
+
+type PostLogic interface {
+	DeletePost(ctx context.Context, userId uint64, userRole string, postId uint64) error
+}
+
+type CommentLogic interface {
+	DeleteComment(ctx context.Context, userId uint64, userRole string, commentId uint64) error
+}
+
+type TxManager interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type logic struct {
+	reportRepository  ReportRepository
+	postRepository    PostRepository
+	commentRepository CommentRepository
+	userRepository    UserRepository
+	postService       PostLogic
+	commentService    CommentLogic
+	txManager         TxManager
+	hideThreshold     int
+}
+
+// NewLogic creates a moderation logic that hides reported content once
+// hideThreshold distinct users have open reports about it.
+func NewLogic(reportRepository ReportRepository, postRepository PostRepository, commentRepository CommentRepository,
+	userRepository UserRepository, postService PostLogic, commentService CommentLogic, txManager TxManager, hideThreshold int) *logic {
+	return &logic{
+		reportRepository:  reportRepository,
+		postRepository:    postRepository,
+		commentRepository: commentRepository,
+		userRepository:    userRepository,
+		postService:       postService,
+		commentService:    commentService,
+		txManager:         txManager,
+		hideThreshold:     hideThreshold,
+	}
+}
+
+func (l *logic) ReportPost(ctx context.Context, report *model.Report) error {
+	ctx, span := tracing.Start(ctx, "report.ReportPost")
+	defer span.End()
+
+	post, err := l.postRepository.GetPost(ctx, report.TargetID)
+	if err != nil {
+		return errors.Wrap(err, "post repository error")
+	}
+
+	report.TargetType = model.ReportTargetPost
+	report.AuthorID = post.UserID
+
+	return l.txManager.Do(ctx, func(ctx context.Context) error {
+		hide, err := l.createReport(ctx, report)
+		if err != nil {
+			return errors.Wrap(err, "createReport error")
+		}
+
+		if hide && !post.IsHidden {
+			err = l.postRepository.SetPostHidden(ctx, post.ID, true)
+			if err != nil {
+				return errors.Wrap(err, "post repository error")
+			}
+		}
+
+		return nil
+	})
+}
+
+func (l *logic) ReportComment(ctx context.Context, report *model.Report) error {
+	ctx, span := tracing.Start(ctx, "report.ReportComment")
+	defer span.End()
+
+	comment, err := l.commentRepository.GetComment(ctx, report.TargetID)
+	if err != nil {
+		return errors.Wrap(err, "comment repository error")
+	}
+
+	report.TargetType = model.ReportTargetComment
+	report.AuthorID = comment.UserID
+
+	return l.txManager.Do(ctx, func(ctx context.Context) error {
+		hide, err := l.createReport(ctx, report)
+		if err != nil {
+			return errors.Wrap(err, "createReport error")
+		}
+
+		if hide && !comment.IsHidden {
+			err = l.commentRepository.SetCommentHidden(ctx, comment.ID, true)
+			if err != nil {
+				return errors.Wrap(err, "comment repository error")
+			}
+		}
+
+		return nil
+	})
+}
+
+func (l *logic) GetReports(ctx context.Context, status string) ([]*model.Report, error) {
+	ctx, span := tracing.Start(ctx, "report.GetReports")
+	defer span.End()
+
+	reports, err := l.reportRepository.GetReports(ctx, status)
+	if err != nil {
+		return nil, errors.Wrap(err, "report repository error")
+	}
+
+	return reports, nil
+}
+
+func (l *logic) ResolveReport(ctx context.Context, resolution *model.ReportResolution) (*model.Report, error) {
+	ctx, span := tracing.Start(ctx, "report.ResolveReport")
+	defer span.End()
+
+	report, err := l.reportRepository.GetReport(ctx, resolution.ReportID)
+	if err != nil {
+		return nil, errors.Wrap(err, "report repository error")
+	}
+
+	if report.Status != model.ReportOpen {
+		return nil, errors.Wrap(model.ErrBadRequest, "report is already closed")
+	}
+
+	// the services delete in their own transactions and publish events,
+	// so it is done first: if closing fails the report stays open to retry
+	if resolution.Status == model.ReportContentDeleted {
+		err = l.deleteContent(ctx, resolution, report)
+		if err != nil {
+			return nil, errors.Wrap(err, "report action error")
+		}
+	}
+
+	err = l.txManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+
+		switch resolution.Status {
+		case model.ReportResolved:
+			err = l.setHidden(ctx, report, true)
+		case model.ReportDismissed:
+			err = l.setHidden(ctx, report, false)
+		case model.ReportContentDeleted:
+		case model.ReportAuthorSuspended:
+			err = l.suspendAuthor(ctx, resolution, report)
+			if err == nil {
+				err = l.setHidden(ctx, report, true)
+			}
+		default:
+			return errors.Wrap(model.ErrBadRequest, "unknown report status")
+		}
+		if err != nil {
+			return errors.Wrap(err, "report action error")
+		}
+
+		err = l.reportRepository.CloseTargetReports(ctx, report.TargetType, report.TargetID,
+			resolution.Status, resolution.ModeratorID)
+		if err != nil {
+			return errors.Wrap(err, "report repository error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report, err = l.reportRepository.GetReport(ctx, resolution.ReportID)
+	if err != nil {
+		return nil, errors.Wrap(err, "report repository error")
+	}
+
+	return report, nil
+}
+
+// suspendAuthor suspends the author of the reported content until
+// resolution.SuspendUntil. Only the users below the moderator's role can be
+// suspended, and a ban or a longer suspension is left as it is.
+func (l *logic) suspendAuthor(ctx context.Context, resolution *model.ReportResolution, report *model.Report) error {
+	author, err := l.userRepository.GetUserByID(ctx, report.AuthorID)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if model.HasRole(author.Role, resolution.ModeratorRole) {
+		return errors.Wrap(model.ErrPermissionDenied, "author's role is not below the moderator's")
+	}
+
+	if author.Status == model.UserBanned ||
+		(author.Status == model.UserSuspended && !author.SuspendedUntil.Before(resolution.SuspendUntil)) {
+		return nil
+	}
+
+	err = l.userRepository.UpdateStatus(ctx, &model.UserStatus{
+		ID:             report.AuthorID,
+		Status:         model.UserSuspended,
+		SuspendedUntil: resolution.SuspendUntil,
+		Reason:         "report " + strconv.FormatUint(report.ID, 10) + ": " + report.Reason,
+		ChangedBy:      resolution.ModeratorID,
+	})
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+// createReport stores the report and tells whether the target has collected
+// enough reports to be hidden.
+func (l *logic) createReport(ctx context.Context, report *model.Report) (bool, error) {
+	report.Status = model.ReportOpen
+	// set by a rolled back attempt
+	report.ID = 0
+
+	err := l.reportRepository.CreateReport(ctx, report)
+	if err != nil {
+		return false, errors.Wrap(err, "report repository error")
+	}
+
+	cnt, err := l.reportRepository.GetOpenReportsCnt(ctx, report.TargetType, report.TargetID)
+	if err != nil {
+		return false, errors.Wrap(err, "report repository error")
+	}
+
+	return cnt >= l.hideThreshold, nil
+}
+
+func (l *logic) setHidden(ctx context.Context, report *model.Report, hidden bool) error {
+	var err error
+
+	switch report.TargetType {
+	case model.ReportTargetPost:
+		err = l.postRepository.SetPostHidden(ctx, report.TargetID, hidden)
+	case model.ReportTargetComment:
+		err = l.commentRepository.SetCommentHidden(ctx, report.TargetID, hidden)
+	}
+	if err != nil {
+		return errors.Wrap(err, "repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) deleteContent(ctx context.Context, resolution *model.ReportResolution, report *model.Report) error {
+	var err error
+
+	switch report.TargetType {
+	case model.ReportTargetPost:
+		err = l.postService.DeletePost(ctx, resolution.ModeratorID, resolution.ModeratorRole, report.TargetID)
+	case model.ReportTargetComment:
+		err = l.commentService.DeleteComment(ctx, resolution.ModeratorID, resolution.ModeratorRole, report.TargetID)
+	}
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return errors.Wrap(err, "service error")
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) GetReport(_ context.Context, reportId uint64) (*model.Report, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	rep := memdb.Find(mr.db.Reports, func(r *model.Report) bool { return r.ID == reportId })
+	if rep == nil {
+		return nil, model.ErrNotFound
+	}
+
+	copied := *rep
+	return &copied, nil
+}
+
+func (mr *memoryRepo) GetReports(_ context.Context, status string) ([]*model.Report, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	reports := memdb.Filter(mr.db.Reports, func(r *model.Report) bool { return status == "" || r.Status == status })
+
+	// newest first
+	copied := make([]*model.Report, len(reports))
+	for i, rep := range reports {
+		repCopy := *rep
+		copied[len(reports)-1-i] = &repCopy
+	}
+
+	return copied, nil
+}
+
+// CreateReport returns model.ErrConflictReport if the reporter has already
+// reported the same target.
+func (mr *memoryRepo) CreateReport(_ context.Context, report *model.Report) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	reported := memdb.Find(mr.db.Reports, func(r *model.Report) bool {
+		return r.ReporterID == report.ReporterID && r.TargetType == report.TargetType && r.TargetID == report.TargetID
+	})
+	if reported != nil {
+		return model.ErrConflictReport
+	}
+
+	report.Date = time.Now()
+	report.ID = mr.db.NextID("reports")
+
+	copied := *report
+	copied.ModeratorID = 0
+	copied.ResolvedAt = time.Time{}
+	mr.db.Reports = append(mr.db.Reports, &copied)
+
+	return nil
+}
+
+func (mr *memoryRepo) GetOpenReportsCnt(_ context.Context, targetType string, targetId uint64) (int, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	return memdb.Count(mr.db.Reports, func(r *model.Report) bool {
+		return r.TargetType == targetType && r.TargetID == targetId && r.Status == model.ReportOpen
+	}), nil
+}
+
+// CloseTargetReports closes every open report about the target with the
+// same status, so one moderator decision settles the whole target.
+func (mr *memoryRepo) CloseTargetReports(_ context.Context, targetType string, targetId uint64, status string, moderatorId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	now := time.Now()
+	for _, rep := range mr.db.Reports {
+		if rep.TargetType == targetType && rep.TargetID == targetId && rep.Status == model.ReportOpen {
+			rep.Status = status
+			rep.ModeratorID = moderatorId
+			rep.ResolvedAt = now
+		}
+	}
+
+	return nil
+}
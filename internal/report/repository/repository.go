@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgReport struct {
+	ID          uint64
+	ReporterID  uint64
+	TargetType  string
+	TargetID    uint64
+	AuthorID    uint64
+	Reason      string
+	Details     string
+	Status      string
+	CreatedAt   time.Time
+	ModeratorID sql.NullInt64
+	ResolvedAt  sql.NullTime
+}
+
+func (r pgReport) toModelReport() *model.Report {
+	return &model.Report{
+		ID:          r.ID,
+		ReporterID:  r.ReporterID,
+		TargetType:  r.TargetType,
+		TargetID:    r.TargetID,
+		AuthorID:    r.AuthorID,
+		Reason:      r.Reason,
+		Details:     r.Details,
+		Status:      r.Status,
+		Date:        r.CreatedAt,
+		ModeratorID: uint64(r.ModeratorID.Int64),
+		ResolvedAt:  r.ResolvedAt.Time,
+	}
+}
+
+func toModelReports(pg []*pgReport) []*model.Report {
+	reports := make([]*model.Report, len(pg))
+
+	for i := range reports {
+		reports[i] = pg[i].toModelReport()
+	}
+
+	return reports
+}
+
+func fromModelReport(r *model.Report) *pgReport {
+	return &pgReport{
+		ID:         r.ID,
+		ReporterID: r.ReporterID,
+		TargetType: r.TargetType,
+		TargetID:   r.TargetID,
+		AuthorID:   r.AuthorID,
+		Reason:     r.Reason,
+		Details:    r.Details,
+		Status:     r.Status,
+		CreatedAt:  r.Date,
+	}
+}
+
+func (pgReport) TableName() string {
+	return "reports"
+}
+
+type pgRepo struct {
+	db *gorm.DB
+}
+
+func NewPgRepo(db *gorm.DB) *pgRepo {
+	return &pgRepo{
+		db: db,
+	}
+}
+
+func (pr *pgRepo) GetReport(ctx context.Context, reportId uint64) (*model.Report, error) {
+	var rep pgReport
+
+	tx := txmanager.DB(ctx, pr.db).Where("id = ?", reportId).Take(&rep)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table reports)")
+	}
+
+	return rep.toModelReport(), nil
+}
+
+func (pr *pgRepo) GetReports(ctx context.Context, status string) ([]*model.Report, error) {
+	reports := make([]*pgReport, 0, 10)
+
+	tx := txmanager.DB(ctx, pr.db)
+	if status != "" {
+		tx = tx.Where(&pgReport{Status: status})
+	}
+
+	tx = tx.Order("id desc").Find(&reports)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table reports)")
+	}
+
+	return toModelReports(reports), nil
+}
+
+// CreateReport returns model.ErrConflictReport if the reporter has already
+// reported the same target.
+func (pr *pgRepo) CreateReport(ctx context.Context, report *model.Report) error {
+	report.Date = time.Now()
+	pgRep := fromModelReport(report)
+
+	tx := txmanager.DB(ctx, pr.db).Clauses(clause.OnConflict{DoNothing: true}).Create(pgRep)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table reports)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrConflictReport
+	}
+
+	report.ID = pgRep.ID
+	return nil
+}
+
+func (pr *pgRepo) GetOpenReportsCnt(ctx context.Context, targetType string, targetId uint64) (int, error) {
+	var cnt int64
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgReport{}).
+		Where(&pgReport{TargetType: targetType, TargetID: targetId, Status: model.ReportOpen}).Count(&cnt)
+	if tx.Error != nil {
+		return 0, errors.Wrap(tx.Error, "database error (table reports)")
+	}
+
+	return int(cnt), nil
+}
+
+// CloseTargetReports closes every open report about the target with the
+// same status, so one moderator decision settles the whole target.
+func (pr *pgRepo) CloseTargetReports(ctx context.Context, targetType string, targetId uint64, status string, moderatorId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgReport{}).
+		Where(&pgReport{TargetType: targetType, TargetID: targetId, Status: model.ReportOpen}).
+		Updates(map[string]interface{}{
+			"status":       status,
+			"moderator_id": moderatorId,
+			"resolved_at":  time.Now(),
+		})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table reports)")
+	}
+
+	return nil
+}
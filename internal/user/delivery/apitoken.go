@@ -0,0 +1,79 @@
+package delivery
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+func (h *handler) setAPITokenRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
+	e.POST("/users/me/tokens", h.CreateAPIToken, auth)
+	e.GET("/users/me/tokens", h.GetAPITokens, auth)
+	e.DELETE("/users/me/tokens/:tokenID", h.RevokeAPIToken, auth)
+}
+
+func (h *handler) CreateAPIToken(c echo.Context) error {
+	var reqToken dto.ReqAPIToken
+	err := c.Bind(&reqToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqToken)
+	if err != nil {
+		return err
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	token := reqToken.ToAPIToken(userClaims.User.ID)
+	raw, err := h.userService.CreateAPIToken(c.Request().Context(), token)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusCreated, dto.RespCreatedAPITokenFromAPIToken(token, raw))
+}
+
+func (h *handler) GetAPITokens(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	tokens, err := h.userService.GetAPITokens(c.Request().Context(), userClaims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespAPITokensFromAPITokens(tokens))
+}
+
+func (h *handler) RevokeAPIToken(c echo.Context) error {
+	tokenId, err := strconv.ParseUint(c.Param("tokenID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.userService.RevokeAPIToken(c.Request().Context(), userClaims.User.ID, tokenId)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -1,7 +1,10 @@
 package delivery
 
 import (
+	"context"
+	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/golang-jwt/jwt/v5"
@@ -14,65 +17,256 @@ import (
 )
 
 type UserLogic interface {
-	GetUserByID(id uint64) (*model.User, error)
-	ChangePass(chpass *model.UserChangePass) error
-	SignIn(user *model.User) (*model.User, error)
-	SignUp(user *model.User) (*model.User, error)
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	GetProfile(ctx context.Context, askerId, id uint64) (*model.UserProfile, error)
+	UpdateProfile(ctx context.Context, update *model.UserProfileUpdate) (*model.User, error)
+	UpdateAvatar(ctx context.Context, id uint64, avatar io.Reader) (*model.User, error)
+	SetRole(ctx context.Context, userRole *model.UserRole) error
+	SetStatus(ctx context.Context, status *model.UserStatus) error
+	ChangePass(ctx context.Context, chpass *model.UserChangePass) error
+	SignIn(ctx context.Context, user *model.User, clientIP string) (*model.SignInResult, error)
+	SignInTOTP(ctx context.Context, challenge, code, clientIP string) (*model.User, error)
+	EnrollTOTP(ctx context.Context, userId uint64) (*model.TOTPEnrollment, error)
+	EnableTOTP(ctx context.Context, userId uint64, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, userId uint64, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userId uint64, code string) ([]string, error)
+	StartOIDC(ctx context.Context, providerName string, userId uint64) (string, error)
+	SignInOIDC(ctx context.Context, providerName, state, code string) (*model.SignInResult, error)
+	GetIdentities(ctx context.Context, userId uint64) ([]*model.UserIdentity, error)
+	UnlinkIdentity(ctx context.Context, userId uint64, providerName string) error
+	SignUp(ctx context.Context, user *model.User) (*model.User, error)
+	SetEmail(ctx context.Context, id uint64, email string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	CreateAPIToken(ctx context.Context, token *model.APIToken) (string, error)
+	GetAPITokens(ctx context.Context, userId uint64) ([]*model.APIToken, error)
+	RevokeAPIToken(ctx context.Context, userId, tokenId uint64) error
 }
 
 type SessionManager interface {
 	CreateSession(user *jwtManager.UserClaims) (string, error)
 }
 
+type AccessMiddleware interface {
+	RequireRole(role string) echo.MiddlewareFunc
+	Scope(scope string) echo.MiddlewareFunc
+}
+
+// StatusCache holds the statuses and roles the auth middleware checks requests with.
+type StatusCache interface {
+	Forget(id uint64)
+}
+
+type RateLimiter interface {
+	Limit(name string) echo.MiddlewareFunc
+}
+
 type handler struct {
 	userService    UserLogic
 	sessionManager SessionManager
+	statuses       StatusCache
 }
 
-func NewHandler(userService UserLogic, sessionManager SessionManager) *handler {
+func NewHandler(userService UserLogic, sessionManager SessionManager, statuses StatusCache) *handler {
 	return &handler{
 		userService:    userService,
 		sessionManager: sessionManager,
+		statuses:       statuses,
 	}
 }
 
-func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc) {
-	e.GET("/users/me", h.GetMe, auth)
+func (h *handler) SetRoutes(e *echo.Echo, auth echo.MiddlewareFunc, access AccessMiddleware, limits RateLimiter) {
+	admin := access.RequireRole(model.RoleAdmin)
+	e.PUT("/users/:userID/role", h.SetRole, auth, admin)
+	e.PUT("/users/:userID/status", h.SetStatus, auth, admin)
+
+	// API tokens read the profiles, the account itself is left to sessions
+	read := access.Scope(model.ScopeRead)
+	e.GET("/users/me", h.GetMe, read, auth)
+	e.PATCH("/users/me", h.UpdateProfile, auth)
+	e.PUT("/users/me/avatar", h.UpdateAvatar, auth)
+	e.PUT("/users/me/email", h.SetEmail, auth, limits.Limit("mail"))
+	e.POST("/users/me/2fa", h.EnrollTOTP, auth)
+	e.POST("/users/me/2fa/enable", h.EnableTOTP, auth, limits.Limit("signin"))
+	e.POST("/users/me/2fa/disable", h.DisableTOTP, auth, limits.Limit("signin"))
+	e.POST("/users/me/2fa/recovery", h.RegenerateRecoveryCodes, auth, limits.Limit("signin"))
+	e.GET("/users/:userID", h.GetProfile, read, auth)
 	e.POST("/users/changepass", h.ChangePass, auth)
 
-	e.POST("/users/signin", h.SignIn)
-	e.POST("/users/signup", h.SignUp)
+	e.POST("/users/signin", h.SignIn, limits.Limit("signin"))
+	e.POST("/users/signin/2fa", h.SignInTOTP, limits.Limit("signin"))
+	e.POST("/users/signup", h.SignUp, limits.Limit("signup"))
+	e.POST("/users/email/verify", h.VerifyEmail)
+	e.POST("/users/password/forgot", h.ForgotPassword, limits.Limit("mail"))
+	e.POST("/users/password/reset", h.ResetPassword, limits.Limit("signin"))
+
+	h.setOIDCRoutes(e, auth, limits)
+	h.setAPITokenRoutes(e, auth)
 }
 
 func (h *handler) GetMe(c echo.Context) error {
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	userId := userClaims.User.ID
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
+	}
+
+	user, err := h.userService.GetUserByID(c.Request().Context(), userId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespGetMeFromUser(user))
+}
+
+func (h *handler) GetProfile(c echo.Context) error {
+	userId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	profile, err := h.userService.GetProfile(c.Request().Context(), userClaims.User.ID, userId)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespProfileFromProfile(profile))
+}
+
+func (h *handler) UpdateProfile(c echo.Context) error {
+	var reqProfile dto.ReqProfile
+	err := c.Bind(&reqProfile)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqProfile)
+	if err != nil {
+		return err
+	}
+
+	update := reqProfile.ToProfileUpdate()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	update.ID = userClaims.User.ID
+
+	user, err := h.userService.UpdateProfile(c.Request().Context(), update)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespGetMeFromUser(user))
+}
+
+func (h *handler) UpdateAvatar(c echo.Context) error {
+	file, err := c.FormFile("Image")
+	if err != nil {
+		return model.ErrBadRequest
+	}
+	src, err := file.Open()
+	if err != nil {
+		return errors.Wrap(err, "form file open error")
+	}
+	defer src.Close()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
 	}
 
-	user, err := h.userService.GetUserByID(userId)
+	user, err := h.userService.UpdateAvatar(c.Request().Context(), userClaims.User.ID, src)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	return c.JSON(http.StatusOK, dto.RespGetMeFromUser(user))
 }
 
+func (h *handler) SetRole(c echo.Context) error {
+	userId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	var reqRole dto.ReqRole
+	err = c.Bind(&reqRole)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqRole)
+	if err != nil {
+		return err
+	}
+
+	userRole := reqRole.ToUserRole()
+	userRole.ID = userId
+
+	err = h.userService.SetRole(c.Request().Context(), userRole)
+	if err != nil {
+		return err
+	}
+	h.statuses.Forget(userId)
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) SetStatus(c echo.Context) error {
+	userId, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil {
+		return model.ErrBadRequest
+	}
+
+	var reqStatus dto.ReqStatus
+	err = c.Bind(&reqStatus)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqStatus)
+	if err != nil {
+		return err
+	}
+
+	status := reqStatus.ToUserStatus()
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	status.ID = userId
+	status.ChangedBy = userClaims.User.ID
+
+	err = h.userService.SetStatus(c.Request().Context(), status)
+	if err != nil {
+		return err
+	}
+	h.statuses.Forget(userId)
+
+	return c.NoContent(http.StatusOK)
+}
+
 func (h *handler) ChangePass(c echo.Context) error {
 	var reqPass dto.ReqСhangePass
 	err := c.Bind(&reqPass)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	_, err = govalidator.ValidateStruct(reqPass)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	chpass := reqPass.ToChangePass()
@@ -80,15 +274,13 @@ func (h *handler) ChangePass(c echo.Context) error {
 	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
 	userId := userClaims.User.ID
 	if !ok {
-		c.Logger().Error(model.ErrInternalServerError)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return model.ErrInternalServerError
 	}
 
 	chpass.ID = userId
-	err = h.userService.ChangePass(chpass)
+	err = h.userService.ChangePass(c.Request().Context(), chpass)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrConflictPassword.Error())
+		return err
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -98,78 +290,255 @@ func (h *handler) SignIn(c echo.Context) error {
 	var reqSign dto.ReqSign
 	err := c.Bind(&reqSign)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	_, err = govalidator.ValidateStruct(reqSign)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	sign := reqSign.ToUser()
 
-	user, err := h.userService.SignIn(sign)
+	result, err := h.userService.SignIn(c.Request().Context(), sign, c.RealIP())
+	if err != nil {
+		return err
+	}
+
+	if result.Challenge != "" {
+		return c.JSON(http.StatusOK, dto.RespChallengeFromString(result.Challenge))
+	}
+
+	token, err := h.sessionManager.CreateSession(jwtManager.FromModelUsertoUserClaims(result.User))
+	if err != nil {
+		return errors.Wrap(err, "session manager error")
+	}
+
+	return c.JSON(http.StatusOK, dto.RespTokenFromString(token))
+}
+
+func (h *handler) SignInTOTP(c echo.Context) error {
+	var reqFactor dto.ReqSecondFactor
+	err := c.Bind(&reqFactor)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqFactor)
+	if err != nil {
+		return err
+	}
+
+	user, err := h.userService.SignInTOTP(c.Request().Context(), reqFactor.Challenge, reqFactor.Code, c.RealIP())
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	token, err := h.sessionManager.CreateSession(jwtManager.FromModelUsertoUserClaims(user))
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return errors.Wrap(err, "session manager error")
 	}
 
 	return c.JSON(http.StatusOK, dto.RespTokenFromString(token))
 }
 
+func (h *handler) EnrollTOTP(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	enrollment, err := h.userService.EnrollTOTP(c.Request().Context(), userClaims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespTOTPEnrollmentFromEnrollment(enrollment))
+}
+
+func (h *handler) EnableTOTP(c echo.Context) error {
+	var reqCode dto.ReqCode
+	err := c.Bind(&reqCode)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqCode)
+	if err != nil {
+		return err
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	codes, err := h.userService.EnableTOTP(c.Request().Context(), userClaims.User.ID, reqCode.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespRecoveryCodesFromCodes(codes))
+}
+
+func (h *handler) DisableTOTP(c echo.Context) error {
+	var reqCode dto.ReqCode
+	err := c.Bind(&reqCode)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqCode)
+	if err != nil {
+		return err
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.userService.DisableTOTP(c.Request().Context(), userClaims.User.ID, reqCode.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) RegenerateRecoveryCodes(c echo.Context) error {
+	var reqCode dto.ReqCode
+	err := c.Bind(&reqCode)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqCode)
+	if err != nil {
+		return err
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	codes, err := h.userService.RegenerateRecoveryCodes(c.Request().Context(), userClaims.User.ID, reqCode.Code)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespRecoveryCodesFromCodes(codes))
+}
+
 func (h *handler) SignUp(c echo.Context) error {
 	var reqSign dto.ReqSign
 	err := c.Bind(&reqSign)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	_, err = govalidator.ValidateStruct(reqSign)
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
+		return err
 	}
 
 	sign := reqSign.ToUser()
 
-	user, err := h.userService.SignUp(sign)
+	user, err := h.userService.SignUp(c.Request().Context(), sign)
 	if err != nil {
-		c.Logger().Error(err)
-		return handleError(err)
+		return err
 	}
 
 	token, err := h.sessionManager.CreateSession(jwtManager.FromModelUsertoUserClaims(user))
 	if err != nil {
-		c.Logger().Error(err)
-		return echo.NewHTTPError(http.StatusInternalServerError, model.ErrInternalServerError.Error())
+		return errors.Wrap(err, "session manager error")
 	}
 
 	return c.JSON(http.StatusCreated, dto.RespTokenFromString(token))
 }
 
-func handleError(err error) *echo.HTTPError {
-	causeErr := errors.Cause(err)
-	switch {
-	case errors.Is(causeErr, model.ErrNotFound):
-		return echo.NewHTTPError(http.StatusNotFound, model.ErrNotFound.Error())
-	case errors.Is(causeErr, model.ErrBadRequest):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrBadRequest.Error())
-	case errors.Is(causeErr, model.ErrPermissionDenied):
-		return echo.NewHTTPError(http.StatusForbidden, model.ErrPermissionDenied.Error())
-	case errors.Is(causeErr, model.ErrInvalidPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrInvalidPassword.Error())
-	case errors.Is(causeErr, model.ErrConflictPassword):
-		return echo.NewHTTPError(http.StatusBadRequest, model.ErrConflictPassword.Error())
-	default:
-		return echo.NewHTTPError(http.StatusInternalServerError, causeErr.Error())
+func (h *handler) SetEmail(c echo.Context) error {
+	var reqEmail dto.ReqEmail
+	err := c.Bind(&reqEmail)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqEmail)
+	if err != nil {
+		return err
+	}
+
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err = h.userService.SetEmail(c.Request().Context(), userClaims.User.ID, reqEmail.Email)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) VerifyEmail(c echo.Context) error {
+	var reqToken dto.ReqToken
+	err := c.Bind(&reqToken)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqToken)
+	if err != nil {
+		return err
+	}
+
+	err = h.userService.VerifyEmail(c.Request().Context(), reqToken.Token)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *handler) ForgotPassword(c echo.Context) error {
+	var reqEmail dto.ReqEmail
+	err := c.Bind(&reqEmail)
+	if err != nil {
+		return err
+	}
+
+	_, err = govalidator.ValidateStruct(reqEmail)
+	if err != nil {
+		return err
+	}
+
+	err = h.userService.ForgotPassword(c.Request().Context(), reqEmail.Email)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *handler) ResetPassword(c echo.Context) error {
+	var reqReset dto.ReqResetPass
+	err := c.Bind(&reqReset)
+	if err != nil {
+		return err
 	}
+
+	_, err = govalidator.ValidateStruct(reqReset)
+	if err != nil {
+		return err
+	}
+
+	err = h.userService.ResetPassword(c.Request().Context(), reqReset.Token, reqReset.Password)
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
 }
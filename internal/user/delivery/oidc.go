@@ -0,0 +1,105 @@
+package delivery
+
+import (
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+
+	jwtManager "github.com/ell1jah/bmstu_web/internal/pkg/jwt"
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/ell1jah/bmstu_web/model/dto"
+)
+
+func (h *handler) setOIDCRoutes(e *echo.Echo, auth echo.MiddlewareFunc, limits RateLimiter) {
+	e.GET("/users/oidc/:provider/login", h.StartOIDC, limits.Limit("signin"))
+	e.GET("/users/oidc/:provider/callback", h.OIDCCallback, limits.Limit("signin"))
+
+	e.GET("/users/me/identities", h.GetIdentities, auth)
+	e.POST("/users/me/identities/:provider", h.LinkIdentity, auth)
+	e.DELETE("/users/me/identities/:provider", h.UnlinkIdentity, auth)
+}
+
+func (h *handler) StartOIDC(c echo.Context) error {
+	authURL, err := h.userService.StartOIDC(c.Request().Context(), c.Param("provider"), 0)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+func (h *handler) OIDCCallback(c echo.Context) error {
+	if c.QueryParam("error") != "" {
+		logger.Ctx(c.Request().Context(), "user").Error("identity provider error", zap.String("error", c.QueryParam("error")))
+		return model.ErrUnauthorized
+	}
+
+	state, code := c.QueryParam("state"), c.QueryParam("code")
+	if state == "" || code == "" {
+		return model.ErrBadRequest
+	}
+
+	result, err := h.userService.SignInOIDC(c.Request().Context(), c.Param("provider"), state, code)
+	if err != nil {
+		return err
+	}
+
+	if result.Challenge != "" {
+		return c.JSON(http.StatusOK, dto.RespChallengeFromString(result.Challenge))
+	}
+
+	token, err := h.sessionManager.CreateSession(jwtManager.FromModelUsertoUserClaims(result.User))
+	if err != nil {
+		return errors.Wrap(err, "session manager error")
+	}
+
+	return c.JSON(http.StatusOK, dto.RespTokenFromString(token))
+}
+
+func (h *handler) GetIdentities(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	identities, err := h.userService.GetIdentities(c.Request().Context(), userClaims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespIdentitiesFromIdentities(identities))
+}
+
+// LinkIdentity returns the provider URL instead of redirecting: the browser
+// can't carry the bearer token through the redirect.
+func (h *handler) LinkIdentity(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	authURL, err := h.userService.StartOIDC(c.Request().Context(), c.Param("provider"), userClaims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, dto.RespURLFromString(authURL))
+}
+
+func (h *handler) UnlinkIdentity(c echo.Context) error {
+	userClaims, ok := c.Get("user").(*jwt.Token).Claims.(*jwtManager.Claims)
+	if !ok {
+		return model.ErrInternalServerError
+	}
+
+	err := h.userService.UnlinkIdentity(c.Request().Context(), userClaims.User.ID, c.Param("provider"))
+	if err != nil {
+		return err
+	}
+
+	return c.NoContent(http.StatusOK)
+}
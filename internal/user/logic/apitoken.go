@@ -0,0 +1,112 @@
+package logic
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	maxAPITokens = 20
+	// characters of the token kept to tell the tokens apart
+	apiTokenShownLen = 8
+)
+
+// CreateAPIToken returns the token itself, it can't be shown again.
+func (l *logic) CreateAPIToken(ctx context.Context, token *model.APIToken) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.CreateAPIToken")
+	defer span.End()
+
+	if len(token.Scopes) == 0 {
+		return "", errors.Wrap(model.ErrBadRequest, "no scopes")
+	}
+	for _, scope := range token.Scopes {
+		if !model.IsValidScope(scope) {
+			return "", errors.Wrapf(model.ErrBadRequest, "unknown scope %q", scope)
+		}
+	}
+
+	tokens, err := l.userRepository.GetUserAPITokens(ctx, token.UserID)
+	if err != nil {
+		return "", errors.Wrap(err, "user repository error")
+	}
+
+	if len(tokens) >= maxAPITokens {
+		return "", errors.Wrapf(model.ErrBadRequest, "no more than %d tokens", maxAPITokens)
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	raw := model.APITokenPrefix + secret
+
+	token.Hash = hashToken(raw)
+	token.Prefix = raw[:len(model.APITokenPrefix)+apiTokenShownLen]
+	token.CreatedAt = time.Now()
+
+	err = l.userRepository.CreateAPIToken(ctx, token)
+	if err != nil {
+		return "", errors.Wrap(err, "user repository error")
+	}
+
+	return raw, nil
+}
+
+func (l *logic) GetAPITokens(ctx context.Context, userId uint64) ([]*model.APIToken, error) {
+	ctx, span := tracing.Start(ctx, "user.GetAPITokens")
+	defer span.End()
+
+	tokens, err := l.userRepository.GetUserAPITokens(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	return tokens, nil
+}
+
+func (l *logic) RevokeAPIToken(ctx context.Context, userId, tokenId uint64) error {
+	ctx, span := tracing.Start(ctx, "user.RevokeAPIToken")
+	defer span.End()
+
+	err := l.userRepository.DeleteAPIToken(ctx, userId, tokenId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+// AuthenticateAPIToken returns the owner and the token for a raw token,
+// or model.ErrUnauthorized if it's unknown or expired.
+func (l *logic) AuthenticateAPIToken(ctx context.Context, raw string) (*model.User, *model.APIToken, error) {
+	ctx, span := tracing.Start(ctx, "user.AuthenticateAPIToken")
+	defer span.End()
+
+	token, err := l.userRepository.GetAPITokenByHash(ctx, hashToken(raw))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, nil, model.ErrUnauthorized
+	} else if err != nil {
+		return nil, nil, errors.Wrap(err, "user repository error")
+	}
+
+	if token.Expired(time.Now()) {
+		return nil, nil, model.ErrUnauthorized
+	}
+
+	user, err := l.userRepository.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "user repository error")
+	}
+
+	err = l.userRepository.TouchAPIToken(ctx, token.ID)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "user repository error")
+	}
+
+	user.Password = ""
+	return user, token, nil
+}
@@ -1,30 +1,162 @@
 package logic
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/logger"
+	"github.com/ell1jah/bmstu_web/internal/pkg/metrics"
+	"github.com/ell1jah/bmstu_web/internal/pkg/totp"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
-	"golang.org/x/crypto/bcrypt"
+	"go.uber.org/zap"
 )
 
 type UserRepository interface {
-	GetUserByID(id uint64) (*model.User, error)
-	GetUserByLogin(login string) (*model.User, error)
-	UpdateUser(user *model.User) (*model.User, error)
-	CreateUser(user *model.User) (*model.User, error)
+	GetUserByID(ctx context.Context, id uint64) (*model.User, error)
+	GetUserByLogin(ctx context.Context, login string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	UpdatePassword(ctx context.Context, id uint64, password string) error
+	UpdateProfile(ctx context.Context, user *model.User) (*model.User, error)
+	UpdateEmail(ctx context.Context, id uint64, email string, verified bool) error
+	UpdateRole(ctx context.Context, id uint64, role string) error
+	UpdateStatus(ctx context.Context, status *model.UserStatus) error
+	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
+	CreateToken(ctx context.Context, token *model.UserToken) error
+	GetToken(ctx context.Context, purpose, hash string) (*model.UserToken, error)
+	UseToken(ctx context.Context, purpose, hash string) (*model.UserToken, error)
+	GetTOTP(ctx context.Context, userId uint64) (*model.UserTOTP, error)
+	SaveTOTP(ctx context.Context, userTOTP *model.UserTOTP) error
+	EnableTOTP(ctx context.Context, userId uint64, lastStep int64, codeHashes []string) error
+	DeleteTOTP(ctx context.Context, userId uint64) error
+	UseTOTPStep(ctx context.Context, userId uint64, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userId uint64, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userId uint64, codeHash string) error
+	CreateOIDCLogin(ctx context.Context, login *model.OIDCLogin) error
+	UseOIDCLogin(ctx context.Context, stateHash string) (*model.OIDCLogin, error)
+	GetIdentity(ctx context.Context, provider, subject string) (*model.UserIdentity, error)
+	GetUserIdentities(ctx context.Context, userId uint64) ([]*model.UserIdentity, error)
+	CreateIdentity(ctx context.Context, identity *model.UserIdentity) error
+	DeleteIdentity(ctx context.Context, userId uint64, provider string) error
+	CreateAPIToken(ctx context.Context, token *model.APIToken) error
+	GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error)
+	GetUserAPITokens(ctx context.Context, userId uint64) ([]*model.APIToken, error)
+	TouchAPIToken(ctx context.Context, id uint64) error
+	DeleteAPIToken(ctx context.Context, userId, id uint64) error
+}
+
+type PostRepository interface {
+	GetUsersPostsCnt(ctx context.Context, ownerId uint64) (int, error)
+}
+
+type RateRepository interface {
+	GetUsersRatesCnts(ctx context.Context, ownerId uint64) (model.RatesCnts, error)
+}
+
+type FollowRepository interface {
+	IsFollowing(ctx context.Context, followerId, followeeId uint64) (bool, error)
+	GetFollowCnts(ctx context.Context, userId uint64) (model.FollowCnts, error)
+}
+
+type ImageLogic interface {
+	CheckImage(ctx context.Context, imageId string) error
+	CreateImage(ctx context.Context, file io.Reader) (string, error)
+}
+
+type AttemptGuard interface {
+	Check(ctx context.Context, key string) error
+	Fail(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
 }
 
+type TxManager interface {
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Compare(hash, password string) error
+	NeedsRehash(hash string) bool
+}
+
+type PasswordPolicy interface {
+	Check(password, login string) error
+}
+
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+type Config struct {
+	// base of the links sent by mail
+	PublicURL      string
+	VerifyTokenTTL time.Duration
+	ResetTokenTTL  time.Duration
+	// issuer shown by authenticator apps
+	TOTPIssuer string
+	// time to enter the code between the sign-in steps
+	SignInChallengeTTL time.Duration
+	// time to come back from an identity provider
+	OIDCLoginTTL time.Duration
+}
+
+const (
+	tokenBytes = 32
+	// accepted clock drift of authenticator apps in 30 second steps
+	totpSkew          = 1
+	recoveryCodeCnt   = 10
+	recoveryCodeChars = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
 type logic struct {
-	userRepository UserRepository
+	userRepository   UserRepository
+	postRepository   PostRepository
+	rateRepository   RateRepository
+	followRepository FollowRepository
+	imageService     ImageLogic
+	loginGuard       AttemptGuard
+	ipGuard          AttemptGuard
+	mailer           Mailer
+	passwords        PasswordHasher
+	policy           PasswordPolicy
+	oidcProviders    map[string]OIDCProvider
+	txManager        TxManager
+	cfg              Config
 }
 
-func NewLogic(userRepository UserRepository) *logic {
+func NewLogic(userRepository UserRepository, postRepository PostRepository, rateRepository RateRepository,
+	followRepository FollowRepository, imageService ImageLogic, loginGuard, ipGuard AttemptGuard,
+	mailer Mailer, passwords PasswordHasher, policy PasswordPolicy, oidcProviders map[string]OIDCProvider,
+	txManager TxManager, cfg Config) *logic {
 	return &logic{
-		userRepository: userRepository,
+		userRepository:   userRepository,
+		postRepository:   postRepository,
+		rateRepository:   rateRepository,
+		followRepository: followRepository,
+		imageService:     imageService,
+		loginGuard:       loginGuard,
+		ipGuard:          ipGuard,
+		mailer:           mailer,
+		passwords:        passwords,
+		policy:           policy,
+		oidcProviders:    oidcProviders,
+		txManager:        txManager,
+		cfg:              cfg,
 	}
 }
 
-func (l *logic) GetUserByID(id uint64) (*model.User, error) {
-	user, err := l.userRepository.GetUserByID(id)
+func (l *logic) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "user.GetUserByID")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, id)
 
 	if err != nil {
 		return nil, errors.Wrap(err, "user repository error")
@@ -33,30 +165,182 @@ func (l *logic) GetUserByID(id uint64) (*model.User, error) {
 	return user, nil
 }
 
-func (l *logic) ChangePass(chpass *model.UserChangePass) error {
+func (l *logic) GetProfile(ctx context.Context, askerId, id uint64) (*model.UserProfile, error) {
+	ctx, span := tracing.Start(ctx, "user.GetProfile")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	postCnt, err := l.postRepository.GetUsersPostsCnt(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "post repository error")
+	}
+
+	rateCnt, err := l.rateRepository.GetUsersRatesCnts(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "rate repository error")
+	}
+
+	followCnt, err := l.followRepository.GetFollowCnts(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "follow repository error")
+	}
+
+	isFollowed, err := l.followRepository.IsFollowing(ctx, askerId, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "follow repository error")
+	}
+
+	user.Password = ""
+	return &model.UserProfile{
+		User:         *user,
+		PostCnt:      postCnt,
+		LikeCnt:      rateCnt.LikeCnt,
+		DislikeCnt:   rateCnt.DislikeCnt,
+		FollowerCnt:  followCnt.FollowerCnt,
+		FollowingCnt: followCnt.FollowingCnt,
+		IsFollowed:   isFollowed,
+	}, nil
+}
+
+func (l *logic) UpdateProfile(ctx context.Context, update *model.UserProfileUpdate) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "user.UpdateProfile")
+	defer span.End()
+
+	if update.AvatarID != nil && *update.AvatarID != "" {
+		err := l.imageService.CheckImage(ctx, *update.AvatarID)
+		if errors.Is(err, model.ErrNotFound) {
+			return nil, errors.Wrap(model.ErrBadRequest, "no avatar image")
+		} else if err != nil {
+			return nil, errors.Wrap(err, "image service error")
+		}
+	}
+
+	user, err := l.userRepository.GetUserByID(ctx, update.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	if update.DisplayName != nil {
+		user.DisplayName = *update.DisplayName
+	}
+	if update.Bio != nil {
+		user.Bio = *update.Bio
+	}
+	if update.AvatarID != nil {
+		user.AvatarID = *update.AvatarID
+	}
+	if update.Website != nil {
+		user.Website = *update.Website
+	}
+
+	user, err = l.userRepository.UpdateProfile(ctx, user)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+func (l *logic) UpdateAvatar(ctx context.Context, id uint64, avatar io.Reader) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "user.UpdateAvatar")
+	defer span.End()
+
+	imageId, err := l.imageService.CreateImage(ctx, avatar)
+	if err != nil {
+		return nil, errors.Wrap(err, "image service error")
+	}
+
+	return l.UpdateProfile(ctx, &model.UserProfileUpdate{
+		ID:       id,
+		AvatarID: &imageId,
+	})
+}
+
+func (l *logic) SetRole(ctx context.Context, userRole *model.UserRole) error {
+	ctx, span := tracing.Start(ctx, "user.SetRole")
+	defer span.End()
+
+	if !model.IsValidRole(userRole.Role) {
+		return errors.Wrap(model.ErrBadRequest, "unknown role")
+	}
+
+	err := l.userRepository.UpdateRole(ctx, userRole.ID, userRole.Role)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) GetUserStatus(ctx context.Context, id uint64) (*model.UserStatus, error) {
+	ctx, span := tracing.Start(ctx, "user.GetUserStatus")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	return user.ToUserStatus(), nil
+}
+
+func (l *logic) SetStatus(ctx context.Context, status *model.UserStatus) error {
+	ctx, span := tracing.Start(ctx, "user.SetStatus")
+	defer span.End()
+
+	switch status.Status {
+	case model.UserActive, model.UserBanned:
+		status.SuspendedUntil = time.Time{}
+	case model.UserSuspended:
+		if !status.SuspendedUntil.After(time.Now()) {
+			return errors.Wrap(model.ErrBadRequest, "suspension must end in the future")
+		}
+	default:
+		return errors.Wrap(model.ErrBadRequest, "unknown status")
+	}
+
+	err := l.userRepository.UpdateStatus(ctx, status)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) ChangePass(ctx context.Context, chpass *model.UserChangePass) error {
+	ctx, span := tracing.Start(ctx, "user.ChangePass")
+	defer span.End()
+
 	if chpass.Old == chpass.New {
 		return model.ErrConflictPassword
 	}
 
-	user, err := l.userRepository.GetUserByID(chpass.ID)
+	user, err := l.userRepository.GetUserByID(ctx, chpass.ID)
 	if err != nil {
 		return errors.Wrap(err, "user repository error")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(chpass.Old))
-	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-		return model.ErrInvalidPassword
-	} else if err != nil {
-		return errors.Wrap(err, "bcrypt error")
+	err = l.passwords.Compare(user.Password, chpass.Old)
+	if err != nil {
+		return errors.Wrap(err, "password hasher error")
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(chpass.New), 8)
+	err = l.policy.Check(chpass.New, user.Login)
 	if err != nil {
-		return errors.Wrap(err, "bcrypt error")
+		return err
 	}
 
-	user.Password = string(hashedPassword)
-	_, err = l.userRepository.UpdateUser(user)
+	hashedPassword, err := l.passwords.Hash(chpass.New)
+	if err != nil {
+		return errors.Wrap(err, "password hasher error")
+	}
+
+	err = l.userRepository.UpdatePassword(ctx, user.ID, hashedPassword)
 	if err != nil {
 		return errors.Wrap(err, "user repository error")
 	}
@@ -64,41 +348,621 @@ func (l *logic) ChangePass(chpass *model.UserChangePass) error {
 	return nil
 }
 
-func (l *logic) SignIn(user *model.User) (*model.User, error) {
-	gotUser, err := l.userRepository.GetUserByLogin(user.Login)
+func (l *logic) SignIn(ctx context.Context, user *model.User, clientIP string) (result *model.SignInResult, err error) {
+	ctx, span := tracing.Start(ctx, "user.SignIn")
+	defer span.End()
+	defer func() { countSignInFailure(err) }()
+
+	err = l.ipGuard.Check(ctx, clientIP)
 	if err != nil {
+		return nil, errors.Wrap(err, "ip guard error")
+	}
+
+	err = l.loginGuard.Check(ctx, user.Login)
+	if err != nil {
+		return nil, errors.Wrap(err, "login guard error")
+	}
+
+	gotUser, err := l.userRepository.GetUserByLogin(ctx, user.Login)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, l.failSignIn(ctx, user.Login, clientIP, errors.Wrap(err, "user repository error"))
+	} else if err != nil {
 		return nil, errors.Wrap(err, "user repository error")
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(gotUser.Password), []byte(user.Password))
-	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-		return nil, model.ErrInvalidPassword
+	err = l.passwords.Compare(gotUser.Password, user.Password)
+	if errors.Is(err, model.ErrInvalidPassword) {
+		return nil, l.failSignIn(ctx, user.Login, clientIP, model.ErrInvalidPassword)
 	} else if err != nil {
-		return nil, errors.Wrap(err, "bcrypt error")
+		return nil, errors.Wrap(err, "password hasher error")
+	}
+
+	err = gotUser.ToUserStatus().Blocked(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if l.passwords.NeedsRehash(gotUser.Password) {
+		// the user is signed in anyway, the hash gets upgraded next time
+		err = l.rehash(ctx, gotUser, user.Password)
+		if err != nil {
+			logger.Ctx(ctx, "user").Error("password rehash", zap.Uint64("user_id", gotUser.ID), zap.Error(err))
+		}
+	}
+
+	// failures stay counted until the second step succeeds
+	challenge, err := l.secondFactorChallenge(ctx, gotUser)
+	if err != nil {
+		return nil, err
+	} else if challenge != "" {
+		return &model.SignInResult{Challenge: challenge}, nil
+	}
+
+	err = l.loginGuard.Reset(ctx, user.Login)
+	if err != nil {
+		return nil, errors.Wrap(err, "login guard error")
 	}
 
 	gotUser.Password = ""
-	return gotUser, nil
+	return &model.SignInResult{User: gotUser}, nil
+}
+
+// SignInTOTP is the second sign-in step: it exchanges the challenge returned
+// by SignIn and a TOTP or recovery code for the user. A challenge works
+// until a right code spends it.
+func (l *logic) SignInTOTP(ctx context.Context, challenge, code, clientIP string) (user *model.User, err error) {
+	ctx, span := tracing.Start(ctx, "user.SignInTOTP")
+	defer span.End()
+	defer func() { countSignInFailure(err) }()
+
+	err = l.ipGuard.Check(ctx, clientIP)
+	if err != nil {
+		return nil, errors.Wrap(err, "ip guard error")
+	}
+
+	userToken, err := l.userRepository.GetToken(ctx, model.TokenSignIn, hashToken(challenge))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, model.ErrInvalidToken
+	} else if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	user, err = l.userRepository.GetUserByID(ctx, userToken.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	err = l.loginGuard.Check(ctx, user.Login)
+	if err != nil {
+		return nil, errors.Wrap(err, "login guard error")
+	}
+
+	err = user.ToUserStatus().Blocked(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// a mistyped code leaves the challenge for another try, the "signin"
+	// limit and the guards cap the tries; a right one is spent with it
+	err = l.txManager.Do(ctx, func(ctx context.Context) error {
+		err := l.checkSecondFactor(ctx, user.ID, code)
+		if err != nil {
+			return err
+		}
+
+		_, err = l.userRepository.UseToken(ctx, model.TokenSignIn, hashToken(challenge))
+		if errors.Is(err, model.ErrNotFound) {
+			return model.ErrInvalidToken
+		} else if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		return nil
+	})
+	if errors.Is(err, model.ErrInvalidCode) {
+		return nil, l.failSignIn(ctx, user.Login, clientIP, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = l.loginGuard.Reset(ctx, user.Login)
+	if err != nil {
+		return nil, errors.Wrap(err, "login guard error")
+	}
+
+	user.Password = ""
+	return user, nil
+}
+
+// secondFactorChallenge returns a challenge for SignInTOTP if the user has
+// two-factor authentication enabled, or an empty string.
+func (l *logic) secondFactorChallenge(ctx context.Context, user *model.User) (string, error) {
+	userTOTP, err := l.userRepository.GetTOTP(ctx, user.ID)
+	if errors.Is(err, model.ErrNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", errors.Wrap(err, "user repository error")
+	}
+
+	if !userTOTP.Enabled {
+		return "", nil
+	}
+
+	return l.createToken(ctx, user.ID, user.Email, model.TokenSignIn, l.cfg.SignInChallengeTTL)
+}
+
+func (l *logic) EnrollTOTP(ctx context.Context, userId uint64) (*model.TOTPEnrollment, error) {
+	ctx, span := tracing.Start(ctx, "user.EnrollTOTP")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "totp error")
+	}
+
+	err = l.userRepository.SaveTOTP(ctx, &model.UserTOTP{
+		UserID: userId,
+		Secret: secret,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	return &model.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(l.cfg.TOTPIssuer, user.Login, secret),
+	}, nil
+}
+
+// EnableTOTP finishes the enrollment with the first code from the app and
+// returns recovery codes. They are shown only now, just their hashes are kept.
+func (l *logic) EnableTOTP(ctx context.Context, userId uint64, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "user.EnableTOTP")
+	defer span.End()
+
+	userTOTP, err := l.userRepository.GetTOTP(ctx, userId)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, errors.Wrap(model.ErrBadRequest, "no two-factor enrollment")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	if userTOTP.Enabled {
+		return nil, model.ErrConflictTwoFactor
+	}
+
+	step, ok := totp.Validate(userTOTP.Secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, model.ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.userRepository.EnableTOTP(ctx, userId, step, hashes)
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, model.ErrConflictTwoFactor
+	} else if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	return codes, nil
+}
+
+func (l *logic) DisableTOTP(ctx context.Context, userId uint64, code string) error {
+	ctx, span := tracing.Start(ctx, "user.DisableTOTP")
+	defer span.End()
+
+	err := l.checkSecondFactor(ctx, userId, code)
+	if err != nil {
+		return err
+	}
+
+	err = l.userRepository.DeleteTOTP(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) RegenerateRecoveryCodes(ctx context.Context, userId uint64, code string) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "user.RegenerateRecoveryCodes")
+	defer span.End()
+
+	err := l.checkSecondFactor(ctx, userId, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	err = l.userRepository.ReplaceRecoveryCodes(ctx, userId, hashes)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	return codes, nil
 }
 
-func (l *logic) SignUp(user *model.User) (*model.User, error) {
-	_, err := l.userRepository.GetUserByLogin(user.Login)
+// checkSecondFactor accepts a current TOTP code or an unused recovery code
+// and spends it. Any mismatch is model.ErrInvalidCode.
+func (l *logic) checkSecondFactor(ctx context.Context, userId uint64, code string) error {
+	userTOTP, err := l.userRepository.GetTOTP(ctx, userId)
+	if errors.Is(err, model.ErrNotFound) {
+		return errors.Wrap(model.ErrBadRequest, "two-factor authentication is not enabled")
+	} else if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if !userTOTP.Enabled {
+		return errors.Wrap(model.ErrBadRequest, "two-factor authentication is not enabled")
+	}
+
+	step, ok := totp.Validate(userTOTP.Secret, code, time.Now(), totpSkew)
+	if ok {
+		err = l.userRepository.UseTOTPStep(ctx, userId, step)
+	} else {
+		err = l.userRepository.UseRecoveryCode(ctx, userId, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if errors.Is(err, model.ErrNotFound) {
+		return model.ErrInvalidCode
+	} else if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+func (l *logic) rehash(ctx context.Context, user *model.User, password string) error {
+	hashedPassword, err := l.passwords.Hash(password)
+	if err != nil {
+		return errors.Wrap(err, "password hasher error")
+	}
+
+	err = l.userRepository.UpdatePassword(ctx, user.ID, hashedPassword)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+// countSignInFailure counts a refused sign-in by what the client got
+// wrong, failures of the server aren't counted.
+func countSignInFailure(err error) {
+	var reason string
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, model.ErrTooManyRequests):
+		reason = "locked_out"
+	case errors.Is(err, model.ErrNotFound):
+		reason = "unknown_login"
+	case errors.Is(err, model.ErrInvalidPassword):
+		reason = "invalid_password"
+	case errors.Is(err, model.ErrInvalidCode):
+		reason = "invalid_code"
+	case errors.Is(err, model.ErrInvalidToken):
+		reason = "invalid_challenge"
+	case errors.Is(err, model.ErrUserSuspended), errors.Is(err, model.ErrUserBanned), errors.Is(err, model.ErrUserDeleted):
+		reason = "blocked"
+	default:
+		return
+	}
+
+	metrics.SignInFailures.WithLabelValues(reason).Inc()
+}
+
+// failSignIn counts a failed attempt against both the login and the client
+// address and returns cause. The address is not reset on success, so one
+// valid account can't be used to keep guessing others.
+func (l *logic) failSignIn(ctx context.Context, login, clientIP string, cause error) error {
+	err := l.loginGuard.Fail(ctx, login)
+	if err != nil {
+		return errors.Wrap(err, "login guard error")
+	}
+
+	err = l.ipGuard.Fail(ctx, clientIP)
+	if err != nil {
+		return errors.Wrap(err, "ip guard error")
+	}
+
+	return cause
+}
+
+func (l *logic) SignUp(ctx context.Context, user *model.User) (*model.User, error) {
+	ctx, span := tracing.Start(ctx, "user.SignUp")
+	defer span.End()
+
+	_, err := l.userRepository.GetUserByLogin(ctx, user.Login)
 	if err != nil && !errors.Is(err, model.ErrNotFound) {
 		return nil, errors.Wrap(err, "user repository error")
 	} else if err == nil {
 		return nil, model.ErrConflictNickname
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), 8)
+	user.Email = normalizeEmail(user.Email)
+	if user.Email != "" {
+		err = l.checkEmailFree(ctx, user.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = l.policy.Check(user.Password, user.Login)
 	if err != nil {
-		return nil, errors.Wrap(err, "bcrypt error")
+		return nil, err
 	}
 
-	user.Password = string(hashedPassword)
-	user, err = l.userRepository.CreateUser(user)
+	hashedPassword, err := l.passwords.Hash(user.Password)
+	if err != nil {
+		return nil, errors.Wrap(err, "password hasher error")
+	}
+
+	user.Password = hashedPassword
+	user.HasPassword = true
+	user.Role = model.RoleUser
+	user.Status = model.UserActive
+	user, err = l.userRepository.CreateUser(ctx, user)
 	if err != nil {
 		return nil, errors.Wrap(err, "user repository error")
 	}
+	metrics.SignUps.WithLabelValues("password").Inc()
+
+	if user.Email != "" {
+		// the account exists already, the mail can be requested again later
+		err = l.sendVerification(ctx, user.ID, user.Email)
+		if err != nil {
+			logger.Ctx(ctx, "user").Error("verification mail", zap.Uint64("user_id", user.ID), zap.Error(err))
+		}
+	}
 
 	return user, nil
 }
+
+func (l *logic) SetEmail(ctx context.Context, id uint64, email string) error {
+	ctx, span := tracing.Start(ctx, "user.SetEmail")
+	defer span.End()
+
+	email = normalizeEmail(email)
+
+	user, err := l.userRepository.GetUserByID(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if user.Email != email {
+		err = l.checkEmailFree(ctx, email)
+		if err != nil {
+			return err
+		}
+
+		err = l.userRepository.UpdateEmail(ctx, id, email, false)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+	} else if user.EmailVerified {
+		return nil
+	}
+
+	return l.sendVerification(ctx, id, email)
+}
+
+func (l *logic) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracing.Start(ctx, "user.VerifyEmail")
+	defer span.End()
+
+	// the token is spent only together with the update
+	return l.txManager.Do(ctx, func(ctx context.Context) error {
+		userToken, err := l.userRepository.UseToken(ctx, model.TokenVerifyEmail, hashToken(token))
+		if errors.Is(err, model.ErrNotFound) {
+			return model.ErrInvalidToken
+		} else if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		user, err := l.userRepository.GetUserByID(ctx, userToken.UserID)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		// the email was changed after the mail had been sent
+		if user.Email != userToken.Email {
+			return model.ErrInvalidToken
+		}
+
+		err = l.userRepository.UpdateEmail(ctx, user.ID, user.Email, true)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		return nil
+	})
+}
+
+// ForgotPassword mails a reset link if the email belongs to a user and is verified.
+// It doesn't tell the caller whether that's the case.
+func (l *logic) ForgotPassword(ctx context.Context, email string) error {
+	ctx, span := tracing.Start(ctx, "user.ForgotPassword")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByEmail(ctx, normalizeEmail(email))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if !user.EmailVerified {
+		return nil
+	}
+
+	token, err := l.createToken(ctx, user.ID, user.Email, model.TokenResetPassword, l.cfg.ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	body := "Someone asked to reset the password of " + user.Login + ".\n" +
+		"Open the link to choose a new one: " + l.link("/reset-password", token) + "\n" +
+		"If it wasn't you, ignore this mail."
+	err = l.mailer.Send(user.Email, "Password reset", body)
+	if err != nil {
+		return errors.Wrap(err, "mailer error")
+	}
+
+	return nil
+}
+
+func (l *logic) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := tracing.Start(ctx, "user.ResetPassword")
+	defer span.End()
+
+	// rules not depending on the login are checked before the token is spent
+	err := l.policy.Check(password, "")
+	if err != nil {
+		return err
+	}
+
+	// a password the policy rejects leaves the token for another try
+	var user *model.User
+	err = l.txManager.Do(ctx, func(ctx context.Context) error {
+		userToken, err := l.userRepository.UseToken(ctx, model.TokenResetPassword, hashToken(token))
+		if errors.Is(err, model.ErrNotFound) {
+			return model.ErrInvalidToken
+		} else if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		user, err = l.userRepository.GetUserByID(ctx, userToken.UserID)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		err = l.policy.Check(password, user.Login)
+		if err != nil {
+			return err
+		}
+
+		hashedPassword, err := l.passwords.Hash(password)
+		if err != nil {
+			return errors.Wrap(err, "password hasher error")
+		}
+
+		err = l.userRepository.UpdatePassword(ctx, user.ID, hashedPassword)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	err = l.loginGuard.Reset(ctx, user.Login)
+	if err != nil {
+		return errors.Wrap(err, "login guard error")
+	}
+
+	return nil
+}
+
+func (l *logic) checkEmailFree(ctx context.Context, email string) error {
+	_, err := l.userRepository.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return errors.Wrap(err, "user repository error")
+	} else if err == nil {
+		return model.ErrConflictEmail
+	}
+
+	return nil
+}
+
+func (l *logic) sendVerification(ctx context.Context, userId uint64, email string) error {
+	token, err := l.createToken(ctx, userId, email, model.TokenVerifyEmail, l.cfg.VerifyTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	body := "Open the link to confirm your email: " + l.link("/verify-email", token)
+	err = l.mailer.Send(email, "Confirm your email", body)
+	if err != nil {
+		return errors.Wrap(err, "mailer error")
+	}
+
+	return nil
+}
+
+// createToken stores the hash of a new random token and returns the token itself.
+func (l *logic) createToken(ctx context.Context, userId uint64, email, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = l.userRepository.CreateToken(ctx, &model.UserToken{
+		UserID:    userId,
+		Purpose:   purpose,
+		Hash:      hashToken(token),
+		Email:     email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "user repository error")
+	}
+
+	return token, nil
+}
+
+func (l *logic) link(path, token string) string {
+	return strings.TrimSuffix(l.cfg.PublicURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, recoveryCodeCnt)
+	hashes := make([]string, recoveryCodeCnt)
+
+	raw := make([]byte, 10)
+	for i := range codes {
+		_, err := rand.Read(raw)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "random error")
+		}
+
+		code := make([]byte, len(raw))
+		for j, b := range raw {
+			code[j] = recoveryCodeChars[int(b)%len(recoveryCodeChars)]
+		}
+
+		codes[i] = string(code[:5]) + "-" + string(code[5:])
+		hashes[i] = hashToken(string(code))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,328 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/metrics"
+	"github.com/ell1jah/bmstu_web/internal/pkg/tracing"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	minLoginLen    = 5
+	maxLoginBase   = 24
+	loginAttempts  = 5
+	displayNameLen = 64
+)
+
+type OIDCProvider interface {
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*model.ExternalIdentity, error)
+}
+
+// StartOIDC begins a login at the provider and returns the URL to send the
+// browser to. With a non-zero userId the identity is linked to that user instead.
+func (l *logic) StartOIDC(ctx context.Context, providerName string, userId uint64) (string, error) {
+	ctx, span := tracing.Start(ctx, "user.StartOIDC")
+	defer span.End()
+
+	provider, ok := l.oidcProviders[providerName]
+	if !ok {
+		return "", errors.Wrap(model.ErrNotFound, "unknown identity provider")
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = l.userRepository.CreateOIDCLogin(ctx, &model.OIDCLogin{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		UserID:       userId,
+		ExpiresAt:    time.Now().Add(l.cfg.OIDCLoginTTL),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "user repository error")
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		return "", errors.Wrap(err, "identity provider error")
+	}
+
+	return authURL, nil
+}
+
+// SignInOIDC finishes the login started by StartOIDC. An unknown identity
+// gets a new user, unless the login was started to link it to an existing one.
+func (l *logic) SignInOIDC(ctx context.Context, providerName, state, code string) (*model.SignInResult, error) {
+	ctx, span := tracing.Start(ctx, "user.SignInOIDC")
+	defer span.End()
+
+	login, err := l.userRepository.UseOIDCLogin(ctx, hashToken(state))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil, model.ErrInvalidToken
+	} else if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	provider, ok := l.oidcProviders[providerName]
+	if !ok || login.Provider != providerName {
+		return nil, model.ErrInvalidToken
+	}
+
+	external, err := provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return nil, errors.Wrapf(model.ErrInvalidToken, "identity provider error: %v", err)
+	}
+
+	identity, err := l.userRepository.GetIdentity(ctx, providerName, external.Subject)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+	found := err == nil
+
+	var user *model.User
+	switch {
+	case login.UserID != 0 && found && identity.UserID != login.UserID:
+		return nil, model.ErrConflictIdentity
+	case login.UserID != 0 && !found:
+		err = l.checkProviderFree(ctx, login.UserID, providerName)
+		if err != nil {
+			return nil, err
+		}
+
+		err = l.userRepository.CreateIdentity(ctx, &model.UserIdentity{
+			UserID:    login.UserID,
+			Provider:  providerName,
+			Subject:   external.Subject,
+			Email:     external.Email,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "user repository error")
+		}
+		user, err = l.userRepository.GetUserByID(ctx, login.UserID)
+	case found:
+		user, err = l.userRepository.GetUserByID(ctx, identity.UserID)
+	default:
+		user, err = l.createOIDCUser(ctx, external)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	err = user.ToUserStatus().Blocked(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := l.secondFactorChallenge(ctx, user)
+	if err != nil {
+		return nil, err
+	} else if challenge != "" {
+		return &model.SignInResult{Challenge: challenge}, nil
+	}
+
+	user.Password = ""
+	return &model.SignInResult{User: user}, nil
+}
+
+func (l *logic) GetIdentities(ctx context.Context, userId uint64) ([]*model.UserIdentity, error) {
+	ctx, span := tracing.Start(ctx, "user.GetIdentities")
+	defer span.End()
+
+	identities, err := l.userRepository.GetUserIdentities(ctx, userId)
+	if err != nil {
+		return nil, errors.Wrap(err, "user repository error")
+	}
+
+	return identities, nil
+}
+
+// UnlinkIdentity refuses to remove the last way to sign in of a user without a password.
+func (l *logic) UnlinkIdentity(ctx context.Context, userId uint64, providerName string) error {
+	ctx, span := tracing.Start(ctx, "user.UnlinkIdentity")
+	defer span.End()
+
+	user, err := l.userRepository.GetUserByID(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	identities, err := l.userRepository.GetUserIdentities(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	if !user.HasPassword && len(identities) <= 1 {
+		return errors.Wrap(model.ErrBadRequest, "the only way to sign in can't be unlinked, set a password first")
+	}
+
+	err = l.userRepository.DeleteIdentity(ctx, userId, providerName)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	return nil
+}
+
+// checkProviderFree allows one identity per provider for a user.
+func (l *logic) checkProviderFree(ctx context.Context, userId uint64, providerName string) error {
+	identities, err := l.userRepository.GetUserIdentities(ctx, userId)
+	if err != nil {
+		return errors.Wrap(err, "user repository error")
+	}
+
+	for _, identity := range identities {
+		if identity.Provider == providerName {
+			return model.ErrConflictIdentity
+		}
+	}
+
+	return nil
+}
+
+func (l *logic) createOIDCUser(ctx context.Context, external *model.ExternalIdentity) (*model.User, error) {
+	// nobody knows the password, the user signs in through the provider
+	unusable, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	hashedPassword, err := l.passwords.Hash(unusable)
+	if err != nil {
+		return nil, errors.Wrap(err, "password hasher error")
+	}
+
+	login, err := l.freeLogin(ctx, external)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		Login:       login,
+		Password:    hashedPassword,
+		DisplayName: truncate(external.Name, displayNameLen),
+		Role:        model.RoleUser,
+		Status:      model.UserActive,
+	}
+
+	// an email already used by someone else is not taken over
+	email := normalizeEmail(external.Email)
+	if email != "" && external.EmailVerified && l.checkEmailFree(ctx, email) == nil {
+		user.Email = email
+		user.EmailVerified = true
+	}
+
+	// a user without the identity couldn't sign in at all
+	err = l.txManager.Do(ctx, func(ctx context.Context) error {
+		// a retry must not reuse the id of the rolled back row
+		user.ID = 0
+
+		_, err := l.userRepository.CreateUser(ctx, user)
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		err = l.userRepository.CreateIdentity(ctx, &model.UserIdentity{
+			UserID:    user.ID,
+			Provider:  external.Provider,
+			Subject:   external.Subject,
+			Email:     external.Email,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "user repository error")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.SignUps.WithLabelValues("oidc").Inc()
+
+	return user, nil
+}
+
+// freeLogin makes a login from the provider's username or email, adding a
+// random suffix when it's taken.
+func (l *logic) freeLogin(ctx context.Context, external *model.ExternalIdentity) (string, error) {
+	base := sanitizeLogin(external.Username)
+	if base == "" {
+		base = sanitizeLogin(strings.SplitN(external.Email, "@", 2)[0])
+	}
+	if len(base) < minLoginLen {
+		base = "user_" + base
+	}
+
+	candidate := base
+	for i := 0; i < loginAttempts; i++ {
+		_, err := l.userRepository.GetUserByLogin(ctx, candidate)
+		if errors.Is(err, model.ErrNotFound) {
+			return candidate, nil
+		} else if err != nil {
+			return "", errors.Wrap(err, "user repository error")
+		}
+
+		suffix, err := rand.Int(rand.Reader, big.NewInt(100000))
+		if err != nil {
+			return "", errors.Wrap(err, "random error")
+		}
+		candidate = base + "_" + suffix.String()
+	}
+
+	return "", errors.Wrap(model.ErrConflictNickname, "no free login")
+}
+
+func sanitizeLogin(login string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(login) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			b.WriteRune(r)
+		}
+		if b.Len() == maxLoginBase {
+			break
+		}
+	}
+
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
+
+func randomToken() (string, error) {
+	raw := make([]byte, tokenBytes)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", errors.Wrap(err, "random error")
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,241 @@
+package logic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/internal/pkg/password"
+	userRepository "github.com/ell1jah/bmstu_web/internal/user/repository"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeProvider plays the provider side of the flow: it keeps what the
+// login was started with and checks the exchange against it.
+type fakeProvider struct {
+	state, nonce, challenge string
+	identity                model.ExternalIdentity
+}
+
+func (fp *fakeProvider) AuthCodeURL(_ context.Context, state, nonce, codeChallenge string) (string, error) {
+	fp.state, fp.nonce, fp.challenge = state, nonce, codeChallenge
+	return "https://provider.example/authorize?state=" + state, nil
+}
+
+func (fp *fakeProvider) Exchange(_ context.Context, code, codeVerifier, nonce string) (*model.ExternalIdentity, error) {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != fp.challenge {
+		return nil, errors.New("code verifier doesn't match the challenge")
+	}
+	if nonce != fp.nonce {
+		return nil, errors.New("nonce mismatch")
+	}
+
+	identity := fp.identity
+	return &identity, nil
+}
+
+type oidcTest struct {
+	logic     *logic
+	users     UserRepository
+	providers map[string]*fakeProvider
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+
+	db := memdb.New()
+	users := userRepository.NewMemoryRepo(db)
+	providers := map[string]*fakeProvider{
+		"first":  {identity: model.ExternalIdentity{Provider: "first", Subject: "subject-1", Username: "first_user"}},
+		"second": {identity: model.ExternalIdentity{Provider: "second", Subject: "subject-2", Username: "second_user"}},
+	}
+
+	oidcProviders := make(map[string]OIDCProvider, len(providers))
+	for name, provider := range providers {
+		oidcProviders[name] = provider
+	}
+
+	// only what the flow touches is set up
+	l := NewLogic(users, nil, nil, nil, nil, nil, nil, nil,
+		password.NewHasher(password.HashConfig{Algorithm: password.Bcrypt, BcryptCost: bcrypt.MinCost}),
+		nil, oidcProviders, db, Config{OIDCLoginTTL: time.Minute})
+
+	return &oidcTest{logic: l, users: users, providers: providers}
+}
+
+// signIn goes through the flow started for userId, zero for a sign-in.
+func (ot *oidcTest) signIn(t *testing.T, provider string, userId uint64) (*model.SignInResult, error) {
+	t.Helper()
+
+	_, err := ot.logic.StartOIDC(context.Background(), provider, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ot.logic.SignInOIDC(context.Background(), provider, ot.providers[provider].state, "code")
+}
+
+func (ot *oidcTest) createUser(t *testing.T, login, email string) uint64 {
+	t.Helper()
+
+	user, err := ot.users.CreateUser(context.Background(), &model.User{
+		Login:         login,
+		Email:         email,
+		EmailVerified: email != "",
+		Role:          model.RoleUser,
+		Status:        model.UserActive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+func TestStartOIDCPKCE(t *testing.T) {
+	ot := newOIDCTest(t)
+
+	_, err := ot.logic.StartOIDC(context.Background(), "unknown", 0)
+	if !errors.Is(err, model.ErrNotFound) {
+		t.Fatalf("unknown provider: %v, want %v", err, model.ErrNotFound)
+	}
+
+	// the fake provider refuses a verifier not matching the S256 challenge
+	result, err := ot.signIn(t, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User == nil || result.User.Login != "first_user" {
+		t.Fatalf("signed in as %+v, want a new first_user", result.User)
+	}
+
+	first := *ot.providers["first"]
+	_, err = ot.logic.StartOIDC(context.Background(), "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again := ot.providers["first"]
+	if again.state == first.state || again.nonce == first.nonce || again.challenge == first.challenge {
+		t.Fatal("a login reuses the values of another")
+	}
+}
+
+func TestSignInOIDCState(t *testing.T) {
+	ot := newOIDCTest(t)
+	ctx := context.Background()
+
+	_, err := ot.signIn(t, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the state is spent by the first callback
+	_, err = ot.logic.SignInOIDC(ctx, "first", ot.providers["first"].state, "code")
+	if !errors.Is(err, model.ErrInvalidToken) {
+		t.Fatalf("replayed state: %v, want %v", err, model.ErrInvalidToken)
+	}
+
+	_, err = ot.logic.SignInOIDC(ctx, "first", "forged", "code")
+	if !errors.Is(err, model.ErrInvalidToken) {
+		t.Fatalf("unknown state: %v, want %v", err, model.ErrInvalidToken)
+	}
+
+	// a login started at one provider can't be finished at another
+	_, err = ot.logic.StartOIDC(ctx, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// even with the other provider accepting its verifier
+	first, second := ot.providers["first"], ot.providers["second"]
+	second.nonce, second.challenge = first.nonce, first.challenge
+	_, err = ot.logic.SignInOIDC(ctx, "second", first.state, "code")
+	if !errors.Is(err, model.ErrInvalidToken) {
+		t.Fatalf("other provider: %v, want %v", err, model.ErrInvalidToken)
+	}
+}
+
+func TestSignInOIDCSameIdentity(t *testing.T) {
+	ot := newOIDCTest(t)
+
+	first, err := ot.signIn(t, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ot.signIn(t, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if again.User.ID != first.User.ID {
+		t.Fatalf("signed in as %d, then as %d", first.User.ID, again.User.ID)
+	}
+}
+
+func TestSignInOIDCLink(t *testing.T) {
+	ot := newOIDCTest(t)
+
+	alice := ot.createUser(t, "alice_login", "")
+	result, err := ot.signIn(t, "first", alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID != alice {
+		t.Fatalf("linked to %d, want %d", result.User.ID, alice)
+	}
+
+	// the identity is alice's now
+	bob := ot.createUser(t, "bob_login", "")
+	_, err = ot.signIn(t, "first", bob)
+	if !errors.Is(err, model.ErrConflictIdentity) {
+		t.Fatalf("identity of another user: %v, want %v", err, model.ErrConflictIdentity)
+	}
+
+	// and alice has one from the provider already
+	ot.providers["first"].identity.Subject = "subject-3"
+	_, err = ot.signIn(t, "first", alice)
+	if !errors.Is(err, model.ErrConflictIdentity) {
+		t.Fatalf("second identity of a provider: %v, want %v", err, model.ErrConflictIdentity)
+	}
+}
+
+func TestSignInOIDCEmail(t *testing.T) {
+	ot := newOIDCTest(t)
+
+	alice := ot.createUser(t, "alice_login", "alice@example.com")
+
+	// the provider vouching for alice's email doesn't make its user alice
+	ot.providers["first"].identity.Email = "Alice@Example.com"
+	ot.providers["first"].identity.EmailVerified = true
+	result, err := ot.signIn(t, "first", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.ID == alice || result.User.Email != "" {
+		t.Fatalf("signed in as %+v, want a new user without the email", result.User)
+	}
+
+	// an unverified email isn't taken
+	ot.providers["second"].identity.Email = "second@example.com"
+	result, err = ot.signIn(t, "second", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.Email != "" {
+		t.Fatalf("email = %q, want none", result.User.Email)
+	}
+
+	ot.providers["second"].identity.Subject = "subject-4"
+	ot.providers["second"].identity.EmailVerified = true
+	result, err = ot.signIn(t, "second", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.User.Email != "second@example.com" || !result.User.EmailVerified {
+		t.Fatalf("email = %q verified %v, want second@example.com verified", result.User.Email, result.User.EmailVerified)
+	}
+}
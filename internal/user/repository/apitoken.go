@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// last_used_at is written at most this often per token
+const touchPeriod = time.Minute
+
+type pgAPIToken struct {
+	ID         uint64
+	UserID     uint64
+	Name       string
+	TokenHash  string
+	Prefix     string
+	Scopes     string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+}
+
+func (t pgAPIToken) toModelAPIToken() *model.APIToken {
+	return &model.APIToken{
+		ID:         t.ID,
+		UserID:     t.UserID,
+		Name:       t.Name,
+		Hash:       t.TokenHash,
+		Prefix:     t.Prefix,
+		Scopes:     strings.Fields(t.Scopes),
+		CreatedAt:  t.CreatedAt,
+		LastUsedAt: t.LastUsedAt.Time,
+		ExpiresAt:  t.ExpiresAt.Time,
+	}
+}
+
+func fromModelAPIToken(t *model.APIToken) *pgAPIToken {
+	return &pgAPIToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Name:      t.Name,
+		TokenHash: t.Hash,
+		Prefix:    t.Prefix,
+		Scopes:    strings.Join(t.Scopes, " "),
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: sql.NullTime{
+			Time:  t.ExpiresAt,
+			Valid: !t.ExpiresAt.IsZero(),
+		},
+	}
+}
+
+func (pgAPIToken) TableName() string {
+	return "api_tokens"
+}
+
+func (pr *pgRepo) CreateAPIToken(ctx context.Context, token *model.APIToken) error {
+	pgTok := fromModelAPIToken(token)
+
+	tx := txmanager.DB(ctx, pr.db).Omit("id").Create(pgTok)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table api_tokens)")
+	}
+
+	token.ID = pgTok.ID
+
+	return nil
+}
+
+func (pr *pgRepo) GetAPITokenByHash(ctx context.Context, hash string) (*model.APIToken, error) {
+	var pgTok pgAPIToken
+
+	tx := txmanager.DB(ctx, pr.db).Where("token_hash = ?", hash).Take(&pgTok)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table api_tokens)")
+	}
+
+	return pgTok.toModelAPIToken(), nil
+}
+
+func (pr *pgRepo) GetUserAPITokens(ctx context.Context, userId uint64) ([]*model.APIToken, error) {
+	var tokens []*pgAPIToken
+
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Order("id").Find(&tokens)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table api_tokens)")
+	}
+
+	modelTokens := make([]*model.APIToken, len(tokens))
+	for i, token := range tokens {
+		modelTokens[i] = token.toModelAPIToken()
+	}
+
+	return modelTokens, nil
+}
+
+func (pr *pgRepo) TouchAPIToken(ctx context.Context, id uint64) error {
+	now := time.Now()
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgAPIToken{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-touchPeriod)).
+		Update("last_used_at", now)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table api_tokens)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) DeleteAPIToken(ctx context.Context, userId, id uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where("id = ? AND user_id = ?", id, userId).Delete(&pgAPIToken{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table api_tokens)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+type pgAccountDeletion struct {
+	UserID      uint64
+	RequestedAt time.Time
+}
+
+func (pgAccountDeletion) TableName() string {
+	return "account_deletions"
+}
+
+// tables holding nothing but the user's own account data
+var personalTables = []string{
+	"user_tokens",
+	"user_totp",
+	"user_recovery_codes",
+	"user_identities",
+	"oidc_logins",
+	"api_tokens",
+	"collections",
+}
+
+const claimDeletionQuery = `
+UPDATE account_deletions SET locked_until = @until
+WHERE user_id = (
+	SELECT user_id FROM account_deletions
+	WHERE locked_until IS NULL OR locked_until < @now
+	ORDER BY requested_at
+	LIMIT 1
+	FOR UPDATE SKIP LOCKED
+)
+RETURNING user_id`
+
+func (pr *pgRepo) RequestDeletion(ctx context.Context, userId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Create(&pgAccountDeletion{UserID: userId, RequestedAt: time.Now()})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table account_deletions)")
+	}
+
+	return nil
+}
+
+// ClaimDeletion takes the oldest deletion nobody works on for the lease time,
+// so a deletion dropped by a crashed server is picked up again.
+func (pr *pgRepo) ClaimDeletion(ctx context.Context, lease time.Duration) (uint64, error) {
+	var userIds []uint64
+	now := time.Now()
+
+	tx := txmanager.DB(ctx, pr.db).Raw(claimDeletionQuery, map[string]interface{}{
+		"now":   now,
+		"until": now.Add(lease),
+	}).Scan(&userIds)
+	if tx.Error != nil {
+		return 0, errors.Wrap(tx.Error, "database error (table account_deletions)")
+	} else if len(userIds) == 0 {
+		return 0, model.ErrNotFound
+	}
+
+	return userIds[0], nil
+}
+
+func (pr *pgRepo) FinishDeletion(ctx context.Context, userId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Delete(&pgAccountDeletion{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table account_deletions)")
+	}
+
+	return nil
+}
+
+// AnonymizeUser keeps the user row for the content left behind,
+// but nothing in it or around it points to the person anymore.
+func (pr *pgRepo) AnonymizeUser(ctx context.Context, userId uint64, login string) error {
+	err := txmanager.DB(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		for _, table := range personalTables {
+			err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userId).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Exec("DELETE FROM follows WHERE follower_id = ? OR followee_id = ?", userId, userId).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&pgUser{ID: userId}).Updates(map[string]interface{}{
+			"login":          login,
+			"password":       "",
+			"has_password":   false,
+			"email":          nil,
+			"email_verified": false,
+			"display_name":   "",
+			"bio":            "",
+			"avatar_id":      "",
+			"website":        "",
+		}).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "database error (table users)")
+	}
+
+	return nil
+}
+
+// DeleteUser expects the posts and comments to be gone already,
+// everything else referencing the user goes with the row.
+func (pr *pgRepo) DeleteUser(ctx context.Context, userId uint64) error {
+	tx := txmanager.DB(ctx, pr.db).Delete(&pgUser{}, userId)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table users)")
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgUserIdentity struct {
+	ID        uint64
+	UserID    uint64
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+func (i pgUserIdentity) toModelUserIdentity() *model.UserIdentity {
+	return &model.UserIdentity{
+		ID:        i.ID,
+		UserID:    i.UserID,
+		Provider:  i.Provider,
+		Subject:   i.Subject,
+		Email:     i.Email,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func fromModelUserIdentity(i *model.UserIdentity) *pgUserIdentity {
+	return &pgUserIdentity{
+		ID:        i.ID,
+		UserID:    i.UserID,
+		Provider:  i.Provider,
+		Subject:   i.Subject,
+		Email:     i.Email,
+		CreatedAt: i.CreatedAt,
+	}
+}
+
+func (pgUserIdentity) TableName() string {
+	return "user_identities"
+}
+
+type pgOIDCLogin struct {
+	StateHash    string `gorm:"primaryKey"`
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	UserID       sql.NullInt64
+	ExpiresAt    time.Time
+}
+
+func (l pgOIDCLogin) toModelOIDCLogin() *model.OIDCLogin {
+	return &model.OIDCLogin{
+		StateHash:    l.StateHash,
+		Provider:     l.Provider,
+		CodeVerifier: l.CodeVerifier,
+		Nonce:        l.Nonce,
+		UserID:       uint64(l.UserID.Int64),
+		ExpiresAt:    l.ExpiresAt,
+	}
+}
+
+func (pgOIDCLogin) TableName() string {
+	return "oidc_logins"
+}
+
+// CreateOIDCLogin also drops the expired logins nobody came back from.
+func (pr *pgRepo) CreateOIDCLogin(ctx context.Context, login *model.OIDCLogin) error {
+	pgLogin := pgOIDCLogin{
+		StateHash:    login.StateHash,
+		Provider:     login.Provider,
+		CodeVerifier: login.CodeVerifier,
+		Nonce:        login.Nonce,
+		UserID: sql.NullInt64{
+			Int64: int64(login.UserID),
+			Valid: login.UserID != 0,
+		},
+		ExpiresAt: login.ExpiresAt,
+	}
+
+	err := txmanager.DB(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("expires_at <= ?", time.Now()).Delete(&pgOIDCLogin{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&pgLogin).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "database error (table oidc_logins)")
+	}
+
+	return nil
+}
+
+// UseOIDCLogin removes the login and returns it, so a callback can't be replayed.
+func (pr *pgRepo) UseOIDCLogin(ctx context.Context, stateHash string) (*model.OIDCLogin, error) {
+	var pgLogin pgOIDCLogin
+
+	tx := txmanager.DB(ctx, pr.db).Clauses(clause.Returning{}).
+		Where("state_hash = ? AND expires_at > ?", stateHash, time.Now()).
+		Delete(&pgLogin)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table oidc_logins)")
+	} else if tx.RowsAffected == 0 {
+		return nil, model.ErrNotFound
+	}
+
+	return pgLogin.toModelOIDCLogin(), nil
+}
+
+func (pr *pgRepo) GetIdentity(ctx context.Context, provider, subject string) (*model.UserIdentity, error) {
+	var identity pgUserIdentity
+
+	tx := txmanager.DB(ctx, pr.db).Where("provider = ? AND subject = ?", provider, subject).Take(&identity)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table user_identities)")
+	}
+
+	return identity.toModelUserIdentity(), nil
+}
+
+func (pr *pgRepo) GetUserIdentities(ctx context.Context, userId uint64) ([]*model.UserIdentity, error) {
+	var identities []*pgUserIdentity
+
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Order("id").Find(&identities)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table user_identities)")
+	}
+
+	modelIdentities := make([]*model.UserIdentity, len(identities))
+	for i, identity := range identities {
+		modelIdentities[i] = identity.toModelUserIdentity()
+	}
+
+	return modelIdentities, nil
+}
+
+func (pr *pgRepo) CreateIdentity(ctx context.Context, identity *model.UserIdentity) error {
+	pgIdentity := fromModelUserIdentity(identity)
+
+	tx := txmanager.DB(ctx, pr.db).Omit("id").Create(pgIdentity)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table user_identities)")
+	}
+
+	identity.ID = pgIdentity.ID
+
+	return nil
+}
+
+func (pr *pgRepo) DeleteIdentity(ctx context.Context, userId uint64, provider string) error {
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ? AND provider = ?", userId, provider).Delete(&pgUserIdentity{})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table user_identities)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
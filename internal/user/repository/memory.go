@@ -0,0 +1,617 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/memdb"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+)
+
+type memoryRepo struct {
+	db *memdb.DB
+}
+
+func NewMemoryRepo(db *memdb.DB) *memoryRepo {
+	return &memoryRepo{
+		db: db,
+	}
+}
+
+func (mr *memoryRepo) GetUserByID(_ context.Context, id uint64) (*model.User, error) {
+	return mr.getUser(func(u *model.User) bool { return u.ID == id })
+}
+
+func (mr *memoryRepo) GetUsersByIDs(_ context.Context, ids []uint64) ([]*model.User, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	users := make([]*model.User, 0, len(ids))
+	for _, id := range ids {
+		usr := mr.findUser(id)
+		if usr == nil {
+			continue
+		}
+
+		copied := *usr
+		users = append(users, &copied)
+	}
+
+	return users, nil
+}
+
+func (mr *memoryRepo) GetUserByLogin(_ context.Context, login string) (*model.User, error) {
+	return mr.getUser(func(u *model.User) bool { return u.Login == login })
+}
+
+func (mr *memoryRepo) GetUserByEmail(_ context.Context, email string) (*model.User, error) {
+	return mr.getUser(func(u *model.User) bool { return u.Email != "" && u.Email == email })
+}
+
+func (mr *memoryRepo) getUser(match func(u *model.User) bool) (*model.User, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	usr := memdb.Find(mr.db.Users, match)
+	if usr == nil {
+		return nil, model.ErrNotFound
+	}
+
+	copied := *usr
+	return &copied, nil
+}
+
+func (mr *memoryRepo) UpdateProfile(_ context.Context, user *model.User) (*model.User, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	usr := mr.findUser(user.ID)
+	if usr == nil {
+		return nil, model.ErrNotFound
+	}
+
+	usr.DisplayName = user.DisplayName
+	usr.Bio = user.Bio
+	usr.AvatarID = user.AvatarID
+	usr.Website = user.Website
+
+	return user, nil
+}
+
+func (mr *memoryRepo) UpdateEmail(_ context.Context, id uint64, email string, verified bool) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	usr := mr.findUser(id)
+	if usr == nil {
+		return model.ErrNotFound
+	}
+
+	if email != "" && mr.emailTaken(id, email) {
+		return errors.New("database error (table users): duplicate email")
+	}
+
+	usr.Email = email
+	usr.EmailVerified = verified
+
+	return nil
+}
+
+func (mr *memoryRepo) UpdatePassword(_ context.Context, id uint64, password string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	usr := mr.findUser(id)
+	if usr == nil {
+		return model.ErrNotFound
+	}
+
+	usr.Password = password
+	usr.HasPassword = true
+
+	return nil
+}
+
+func (mr *memoryRepo) UpdateRole(_ context.Context, id uint64, role string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	usr := mr.findUser(id)
+	if usr == nil {
+		return model.ErrNotFound
+	}
+	usr.Role = role
+
+	return nil
+}
+
+func (mr *memoryRepo) UpdateStatus(_ context.Context, status *model.UserStatus) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	// a deleted account can't be brought back by a status change
+	usr := mr.findUser(status.ID)
+	if usr == nil || usr.Status == model.UserDeleted {
+		return model.ErrNotFound
+	}
+
+	usr.Status = status.Status
+	usr.SuspendedUntil = status.SuspendedUntil
+	usr.StatusReason = status.Reason
+
+	return nil
+}
+
+func (mr *memoryRepo) CreateUser(_ context.Context, user *model.User) (*model.User, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	if memdb.Find(mr.db.Users, func(u *model.User) bool { return u.Login == user.Login }) != nil {
+		return nil, errors.New("database error (table users): duplicate login")
+	} else if user.Email != "" && mr.emailTaken(0, user.Email) {
+		return nil, errors.New("database error (table users): duplicate email")
+	}
+
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	user.ID = mr.db.NextID("users")
+
+	copied := *user
+	mr.db.Users = append(mr.db.Users, &copied)
+
+	return user, nil
+}
+
+// CreateToken replaces the unused tokens the user has for the same purpose,
+// so only the latest mail works.
+func (mr *memoryRepo) CreateToken(_ context.Context, token *model.UserToken) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.UserTokens, func(t *memdb.UserToken) bool {
+		return t.UserID == token.UserID && t.Purpose == token.Purpose && !t.Used
+	})
+
+	token.ID = mr.db.NextID("user_tokens")
+	mr.db.UserTokens = append(mr.db.UserTokens, &memdb.UserToken{UserToken: *token})
+
+	return nil
+}
+
+// GetToken returns a live token without using it.
+func (mr *memoryRepo) GetToken(_ context.Context, purpose, hash string) (*model.UserToken, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	tok := mr.findToken(purpose, hash)
+	if tok == nil {
+		return nil, model.ErrNotFound
+	}
+
+	copied := tok.UserToken
+	return &copied, nil
+}
+
+// UseToken marks a live token as used and returns it.
+func (mr *memoryRepo) UseToken(_ context.Context, purpose, hash string) (*model.UserToken, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	tok := mr.findToken(purpose, hash)
+	if tok == nil {
+		return nil, model.ErrNotFound
+	}
+	tok.Used = true
+
+	copied := tok.UserToken
+	return &copied, nil
+}
+
+// CreateOIDCLogin also drops the expired logins nobody came back from.
+func (mr *memoryRepo) CreateOIDCLogin(_ context.Context, login *model.OIDCLogin) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	now := time.Now()
+	memdb.Delete(&mr.db.OIDCLogins, func(l *model.OIDCLogin) bool { return !l.ExpiresAt.After(now) })
+
+	if memdb.Find(mr.db.OIDCLogins, func(l *model.OIDCLogin) bool { return l.StateHash == login.StateHash }) != nil {
+		return errors.New("database error (table oidc_logins): duplicate state")
+	}
+
+	copied := *login
+	mr.db.OIDCLogins = append(mr.db.OIDCLogins, &copied)
+
+	return nil
+}
+
+// UseOIDCLogin removes the login and returns it, so a callback can't be replayed.
+func (mr *memoryRepo) UseOIDCLogin(_ context.Context, stateHash string) (*model.OIDCLogin, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	now := time.Now()
+	match := func(l *model.OIDCLogin) bool { return l.StateHash == stateHash && l.ExpiresAt.After(now) }
+
+	login := memdb.Find(mr.db.OIDCLogins, match)
+	if login == nil {
+		return nil, model.ErrNotFound
+	}
+	memdb.Delete(&mr.db.OIDCLogins, match)
+
+	return login, nil
+}
+
+func (mr *memoryRepo) GetIdentity(_ context.Context, provider, subject string) (*model.UserIdentity, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	identity := memdb.Find(mr.db.UserIdentities, func(i *model.UserIdentity) bool {
+		return i.Provider == provider && i.Subject == subject
+	})
+	if identity == nil {
+		return nil, model.ErrNotFound
+	}
+
+	copied := *identity
+	return &copied, nil
+}
+
+func (mr *memoryRepo) GetUserIdentities(_ context.Context, userId uint64) ([]*model.UserIdentity, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	identities := memdb.Filter(mr.db.UserIdentities, func(i *model.UserIdentity) bool { return i.UserID == userId })
+
+	copied := make([]*model.UserIdentity, len(identities))
+	for i, identity := range identities {
+		identityCopy := *identity
+		copied[i] = &identityCopy
+	}
+
+	return copied, nil
+}
+
+func (mr *memoryRepo) CreateIdentity(_ context.Context, identity *model.UserIdentity) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	taken := memdb.Find(mr.db.UserIdentities, func(i *model.UserIdentity) bool {
+		return i.Provider == identity.Provider && (i.Subject == identity.Subject || i.UserID == identity.UserID)
+	})
+	if taken != nil {
+		return errors.New("database error (table user_identities): duplicate identity")
+	}
+
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	identity.ID = mr.db.NextID("user_identities")
+
+	copied := *identity
+	mr.db.UserIdentities = append(mr.db.UserIdentities, &copied)
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteIdentity(_ context.Context, userId uint64, provider string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	deleted := memdb.Delete(&mr.db.UserIdentities, func(i *model.UserIdentity) bool {
+		return i.UserID == userId && i.Provider == provider
+	})
+	if deleted == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (mr *memoryRepo) GetTOTP(_ context.Context, userId uint64) (*model.UserTOTP, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	userTOTP := mr.findTOTP(userId)
+	if userTOTP == nil {
+		return nil, model.ErrNotFound
+	}
+
+	copied := *userTOTP
+	return &copied, nil
+}
+
+// SaveTOTP replaces a pending enrollment, an enabled one is left untouched.
+func (mr *memoryRepo) SaveTOTP(_ context.Context, userTOTP *model.UserTOTP) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	saved := mr.findTOTP(userTOTP.UserID)
+	switch {
+	case saved == nil:
+		mr.db.UserTOTPs = append(mr.db.UserTOTPs, &model.UserTOTP{UserID: userTOTP.UserID, Secret: userTOTP.Secret})
+	case saved.Enabled:
+		return model.ErrConflictTwoFactor
+	default:
+		saved.Secret = userTOTP.Secret
+		saved.LastStep = 0
+	}
+
+	return nil
+}
+
+// EnableTOTP enables the enrollment and replaces the recovery codes.
+func (mr *memoryRepo) EnableTOTP(_ context.Context, userId uint64, lastStep int64, codeHashes []string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	userTOTP := mr.findTOTP(userId)
+	if userTOTP == nil || userTOTP.Enabled {
+		return model.ErrNotFound
+	}
+
+	userTOTP.Enabled = true
+	userTOTP.LastStep = lastStep
+	mr.replaceRecoveryCodes(userId, codeHashes)
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteTOTP(_ context.Context, userId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.RecoveryCodes, func(c *memdb.RecoveryCode) bool { return c.UserID == userId })
+	memdb.Delete(&mr.db.UserTOTPs, func(t *model.UserTOTP) bool { return t.UserID == userId })
+
+	return nil
+}
+
+// UseTOTPStep records step as used. It returns model.ErrNotFound if the same
+// or a later step was used already, so a code works only once.
+func (mr *memoryRepo) UseTOTPStep(_ context.Context, userId uint64, step int64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	userTOTP := mr.findTOTP(userId)
+	if userTOTP == nil || userTOTP.LastStep >= step {
+		return model.ErrNotFound
+	}
+	userTOTP.LastStep = step
+
+	return nil
+}
+
+func (mr *memoryRepo) ReplaceRecoveryCodes(_ context.Context, userId uint64, codeHashes []string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	mr.replaceRecoveryCodes(userId, codeHashes)
+
+	return nil
+}
+
+func (mr *memoryRepo) UseRecoveryCode(_ context.Context, userId uint64, codeHash string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	code := memdb.Find(mr.db.RecoveryCodes, func(c *memdb.RecoveryCode) bool {
+		return c.UserID == userId && c.CodeHash == codeHash && !c.Used
+	})
+	if code == nil {
+		return model.ErrNotFound
+	}
+	code.Used = true
+
+	return nil
+}
+
+func (mr *memoryRepo) CreateAPIToken(_ context.Context, token *model.APIToken) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	if memdb.Find(mr.db.APITokens, func(t *model.APIToken) bool { return t.Hash == token.Hash }) != nil {
+		return errors.New("database error (table api_tokens): duplicate token")
+	}
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	token.ID = mr.db.NextID("api_tokens")
+
+	copied := *token
+	copied.LastUsedAt = time.Time{}
+	mr.db.APITokens = append(mr.db.APITokens, &copied)
+
+	return nil
+}
+
+func (mr *memoryRepo) GetAPITokenByHash(_ context.Context, hash string) (*model.APIToken, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	token := memdb.Find(mr.db.APITokens, func(t *model.APIToken) bool { return t.Hash == hash })
+	if token == nil {
+		return nil, model.ErrNotFound
+	}
+
+	copied := *token
+	return &copied, nil
+}
+
+func (mr *memoryRepo) GetUserAPITokens(_ context.Context, userId uint64) ([]*model.APIToken, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	tokens := memdb.Filter(mr.db.APITokens, func(t *model.APIToken) bool { return t.UserID == userId })
+
+	copied := make([]*model.APIToken, len(tokens))
+	for i, token := range tokens {
+		tokenCopy := *token
+		copied[i] = &tokenCopy
+	}
+
+	return copied, nil
+}
+
+func (mr *memoryRepo) TouchAPIToken(_ context.Context, id uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	now := time.Now()
+	token := memdb.Find(mr.db.APITokens, func(t *model.APIToken) bool { return t.ID == id })
+	if token != nil && token.LastUsedAt.Before(now.Add(-touchPeriod)) {
+		token.LastUsedAt = now
+	}
+
+	return nil
+}
+
+func (mr *memoryRepo) DeleteAPIToken(_ context.Context, userId, id uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	deleted := memdb.Delete(&mr.db.APITokens, func(t *model.APIToken) bool { return t.ID == id && t.UserID == userId })
+	if deleted == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (mr *memoryRepo) RequestDeletion(_ context.Context, userId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	if memdb.Find(mr.db.AccountDeletions, func(d *memdb.AccountDeletion) bool { return d.UserID == userId }) != nil {
+		return errors.New("database error (table account_deletions): duplicate deletion")
+	}
+
+	mr.db.AccountDeletions = append(mr.db.AccountDeletions, &memdb.AccountDeletion{UserID: userId, RequestedAt: time.Now()})
+
+	return nil
+}
+
+// ClaimDeletion takes the oldest deletion nobody works on for the lease time,
+// so a deletion dropped by a crashed server is picked up again.
+func (mr *memoryRepo) ClaimDeletion(_ context.Context, lease time.Duration) (uint64, error) {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	now := time.Now()
+	var oldest *memdb.AccountDeletion
+	for _, deletion := range mr.db.AccountDeletions {
+		if deletion.LockedUntil.After(now) {
+			continue
+		}
+		if oldest == nil || deletion.RequestedAt.Before(oldest.RequestedAt) {
+			oldest = deletion
+		}
+	}
+	if oldest == nil {
+		return 0, model.ErrNotFound
+	}
+	oldest.LockedUntil = now.Add(lease)
+
+	return oldest.UserID, nil
+}
+
+func (mr *memoryRepo) FinishDeletion(_ context.Context, userId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	memdb.Delete(&mr.db.AccountDeletions, func(d *memdb.AccountDeletion) bool { return d.UserID == userId })
+
+	return nil
+}
+
+// AnonymizeUser keeps the user row for the content left behind,
+// but nothing in it or around it points to the person anymore.
+func (mr *memoryRepo) AnonymizeUser(_ context.Context, userId uint64, login string) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	mr.deletePersonalData(userId)
+
+	usr := mr.findUser(userId)
+	if usr == nil {
+		return nil
+	}
+
+	usr.Login = login
+	usr.Password = ""
+	usr.HasPassword = false
+	usr.Email = ""
+	usr.EmailVerified = false
+	usr.DisplayName = ""
+	usr.Bio = ""
+	usr.AvatarID = ""
+	usr.Website = ""
+
+	return nil
+}
+
+// DeleteUser expects the posts and comments to be gone already,
+// everything else referencing the user goes with the row.
+func (mr *memoryRepo) DeleteUser(_ context.Context, userId uint64) error {
+	mr.db.Lock()
+	defer mr.db.Unlock()
+
+	mr.deletePersonalData(userId)
+	memdb.Delete(&mr.db.AccountDeletions, func(d *memdb.AccountDeletion) bool { return d.UserID == userId })
+	memdb.Delete(&mr.db.Rates, func(r *memdb.Rate) bool { return r.UserID == userId })
+	memdb.Delete(&mr.db.Reports, func(r *model.Report) bool { return r.ReporterID == userId || r.AuthorID == userId })
+	for _, report := range mr.db.Reports {
+		if report.ModeratorID == userId {
+			report.ModeratorID = 0
+		}
+	}
+	memdb.Delete(&mr.db.Users, func(u *model.User) bool { return u.ID == userId })
+
+	return nil
+}
+
+// deletePersonalData drops the rows holding nothing but the user's own account data.
+func (mr *memoryRepo) deletePersonalData(userId uint64) {
+	memdb.Delete(&mr.db.UserTokens, func(t *memdb.UserToken) bool { return t.UserID == userId })
+	memdb.Delete(&mr.db.UserTOTPs, func(t *model.UserTOTP) bool { return t.UserID == userId })
+	memdb.Delete(&mr.db.RecoveryCodes, func(c *memdb.RecoveryCode) bool { return c.UserID == userId })
+	memdb.Delete(&mr.db.UserIdentities, func(i *model.UserIdentity) bool { return i.UserID == userId })
+	memdb.Delete(&mr.db.OIDCLogins, func(l *model.OIDCLogin) bool { return l.UserID == userId })
+	memdb.Delete(&mr.db.APITokens, func(t *model.APIToken) bool { return t.UserID == userId })
+	memdb.Delete(&mr.db.Follows, func(f *memdb.Follow) bool { return f.FollowerID == userId || f.FolloweeID == userId })
+
+	for _, col := range memdb.Filter(mr.db.Collections, func(c *model.Collection) bool { return c.UserID == userId }) {
+		memdb.Delete(&mr.db.CollectionPosts, func(cp *memdb.CollectionPost) bool { return cp.CollectionID == col.ID })
+	}
+	memdb.Delete(&mr.db.Collections, func(c *model.Collection) bool { return c.UserID == userId })
+}
+
+func (mr *memoryRepo) findUser(id uint64) *model.User {
+	return memdb.Find(mr.db.Users, func(u *model.User) bool { return u.ID == id })
+}
+
+func (mr *memoryRepo) emailTaken(exceptId uint64, email string) bool {
+	return memdb.Find(mr.db.Users, func(u *model.User) bool { return u.ID != exceptId && u.Email == email }) != nil
+}
+
+func (mr *memoryRepo) findTOTP(userId uint64) *model.UserTOTP {
+	return memdb.Find(mr.db.UserTOTPs, func(t *model.UserTOTP) bool { return t.UserID == userId })
+}
+
+func (mr *memoryRepo) findToken(purpose, hash string) *memdb.UserToken {
+	now := time.Now()
+	return memdb.Find(mr.db.UserTokens, func(t *memdb.UserToken) bool {
+		return t.Purpose == purpose && t.Hash == hash && !t.Used && t.ExpiresAt.After(now)
+	})
+}
+
+func (mr *memoryRepo) replaceRecoveryCodes(userId uint64, codeHashes []string) {
+	memdb.Delete(&mr.db.RecoveryCodes, func(c *memdb.RecoveryCode) bool { return c.UserID == userId })
+
+	for _, hash := range codeHashes {
+		mr.db.RecoveryCodes = append(mr.db.RecoveryCodes, &memdb.RecoveryCode{UserID: userId, CodeHash: hash})
+	}
+}
@@ -1,30 +1,77 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
 	"github.com/ell1jah/bmstu_web/model"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
 type pgUser struct {
-	ID       uint64
-	Login    string
-	Password string
+	ID             uint64
+	Login          string
+	Password       string
+	HasPassword    bool
+	Email          sql.NullString
+	EmailVerified  bool
+	Role           string
+	DisplayName    string
+	Bio            string
+	AvatarID       string
+	Website        string
+	CreatedAt      time.Time
+	Status         string
+	SuspendedUntil sql.NullTime
+	StatusReason   string
 }
 
 func (u pgUser) toModelUser() *model.User {
 	return &model.User{
-		ID:       u.ID,
-		Login:    u.Login,
-		Password: u.Password,
+		ID:             u.ID,
+		Login:          u.Login,
+		Password:       u.Password,
+		HasPassword:    u.HasPassword,
+		Email:          u.Email.String,
+		EmailVerified:  u.EmailVerified,
+		Role:           u.Role,
+		DisplayName:    u.DisplayName,
+		Bio:            u.Bio,
+		AvatarID:       u.AvatarID,
+		Website:        u.Website,
+		CreatedAt:      u.CreatedAt,
+		Status:         u.Status,
+		SuspendedUntil: u.SuspendedUntil.Time,
+		StatusReason:   u.StatusReason,
 	}
 }
 
 func fromModelUser(u *model.User) *pgUser {
 	return &pgUser{
-		ID:       u.ID,
-		Login:    u.Login,
-		Password: u.Password,
+		ID:          u.ID,
+		Login:       u.Login,
+		Password:    u.Password,
+		HasPassword: u.HasPassword,
+		Email: sql.NullString{
+			String: u.Email,
+			Valid:  u.Email != "",
+		},
+		EmailVerified: u.EmailVerified,
+		Role:          u.Role,
+		DisplayName:   u.DisplayName,
+		Bio:           u.Bio,
+		AvatarID:      u.AvatarID,
+		Website:       u.Website,
+		CreatedAt:     u.CreatedAt,
+		Status:        u.Status,
+		SuspendedUntil: sql.NullTime{
+			Time:  u.SuspendedUntil,
+			Valid: !u.SuspendedUntil.IsZero(),
+		},
+		StatusReason: u.StatusReason,
 	}
 }
 
@@ -42,10 +89,10 @@ func NewPgRepo(db *gorm.DB) *pgRepo {
 	}
 }
 
-func (pr *pgRepo) GetUserByID(id uint64) (*model.User, error) {
+func (pr *pgRepo) GetUserByID(ctx context.Context, id uint64) (*model.User, error) {
 	var usr pgUser
 
-	tx := pr.db.Where("id = ?", id).Take(&usr)
+	tx := txmanager.DB(ctx, pr.db).Where("id = ?", id).Take(&usr)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -55,10 +102,35 @@ func (pr *pgRepo) GetUserByID(id uint64) (*model.User, error) {
 	return usr.toModelUser(), nil
 }
 
-func (pr *pgRepo) GetUserByLogin(login string) (*model.User, error) {
+// GetUsersByIDs returns the users in the order of ids, leaving out the
+// ones that don't exist.
+func (pr *pgRepo) GetUsersByIDs(ctx context.Context, ids []uint64) ([]*model.User, error) {
+	usrs := make([]pgUser, 0, len(ids))
+
+	tx := txmanager.DB(ctx, pr.db).Where("id IN ?", ids).Find(&usrs)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table users)")
+	}
+
+	byId := make(map[uint64]*model.User, len(usrs))
+	for _, usr := range usrs {
+		byId[usr.ID] = usr.toModelUser()
+	}
+
+	users := make([]*model.User, 0, len(usrs))
+	for _, id := range ids {
+		if user, ok := byId[id]; ok {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (pr *pgRepo) GetUserByLogin(ctx context.Context, login string) (*model.User, error) {
 	var usr pgUser
 
-	tx := pr.db.Where("login = ?", login).Take(&usr)
+	tx := txmanager.DB(ctx, pr.db).Where("login = ?", login).Take(&usr)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -68,23 +140,103 @@ func (pr *pgRepo) GetUserByLogin(login string) (*model.User, error) {
 	return usr.toModelUser(), nil
 }
 
-func (pr *pgRepo) UpdateUser(user *model.User) (*model.User, error) {
-	oldUser := fromModelUser(user)
+func (pr *pgRepo) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	var usr pgUser
 
-	tx := pr.db.Omit("id").Updates(oldUser)
+	tx := txmanager.DB(ctx, pr.db).Where("email = ?", email).Take(&usr)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
 		return nil, errors.Wrap(tx.Error, "database error (table users)")
 	}
 
+	return usr.toModelUser(), nil
+}
+
+func (pr *pgRepo) UpdateProfile(ctx context.Context, user *model.User) (*model.User, error) {
+	pgUsr := fromModelUser(user)
+
+	tx := txmanager.DB(ctx, pr.db).Select("display_name", "bio", "avatar_id", "website").Updates(pgUsr)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table users)")
+	} else if tx.RowsAffected == 0 {
+		return nil, model.ErrNotFound
+	}
+
 	return user, nil
 }
 
-func (pr *pgRepo) CreateUser(user *model.User) (*model.User, error) {
+func (pr *pgRepo) UpdateEmail(ctx context.Context, id uint64, email string, verified bool) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgUser{ID: id}).Updates(map[string]interface{}{
+		"email": sql.NullString{
+			String: email,
+			Valid:  email != "",
+		},
+		"email_verified": verified,
+	})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table users)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+// UpdatePassword sets the password hash and nothing else of the user.
+func (pr *pgRepo) UpdatePassword(ctx context.Context, id uint64, password string) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgUser{ID: id}).Updates(map[string]interface{}{
+		"password":     password,
+		"has_password": true,
+	})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table users)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) UpdateRole(ctx context.Context, id uint64, role string) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgUser{ID: id}).Update("role", role)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table users)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) UpdateStatus(ctx context.Context, status *model.UserStatus) error {
+	// a deleted account can't be brought back by a status change
+	tx := txmanager.DB(ctx, pr.db).Model(&pgUser{ID: status.ID}).Where("status <> ?", model.UserDeleted).Updates(map[string]interface{}{
+		"status": status.Status,
+		"suspended_until": sql.NullTime{
+			Time:  status.SuspendedUntil,
+			Valid: !status.SuspendedUntil.IsZero(),
+		},
+		"status_reason": status.Reason,
+		"status_changed_by": sql.NullInt64{
+			Int64: int64(status.ChangedBy),
+			Valid: status.ChangedBy != 0,
+		},
+		"status_changed_at": time.Now(),
+	})
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table users)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
 	pgUsr := fromModelUser(user)
 
-	tx := pr.db.Create(pgUsr)
+	tx := txmanager.DB(ctx, pr.db).Create(pgUsr)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return nil, model.ErrNotFound
 	} else if tx.Error != nil {
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgUserToken struct {
+	ID        uint64
+	UserID    uint64
+	Purpose   string
+	TokenHash string
+	Email     string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+	CreatedAt time.Time
+}
+
+func (t pgUserToken) toModelUserToken() *model.UserToken {
+	return &model.UserToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Purpose:   t.Purpose,
+		Hash:      t.TokenHash,
+		Email:     t.Email,
+		ExpiresAt: t.ExpiresAt,
+	}
+}
+
+func fromModelUserToken(t *model.UserToken) *pgUserToken {
+	return &pgUserToken{
+		ID:        t.ID,
+		UserID:    t.UserID,
+		Purpose:   t.Purpose,
+		TokenHash: t.Hash,
+		Email:     t.Email,
+		ExpiresAt: t.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+func (pgUserToken) TableName() string {
+	return "user_tokens"
+}
+
+// CreateToken replaces the unused tokens the user has for the same purpose,
+// so only the latest mail works.
+func (pr *pgRepo) CreateToken(ctx context.Context, token *model.UserToken) error {
+	pgTok := fromModelUserToken(token)
+
+	err := txmanager.DB(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserID, token.Purpose).
+			Delete(&pgUserToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(pgTok).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "database error (table user_tokens)")
+	}
+
+	token.ID = pgTok.ID
+
+	return nil
+}
+
+// GetToken returns a live token without using it.
+func (pr *pgRepo) GetToken(ctx context.Context, purpose, hash string) (*model.UserToken, error) {
+	var pgTok pgUserToken
+
+	tx := txmanager.DB(ctx, pr.db).
+		Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, hash, time.Now()).
+		Take(&pgTok)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table user_tokens)")
+	}
+
+	return pgTok.toModelUserToken(), nil
+}
+
+// UseToken marks a live token as used and returns it. Concurrent calls with
+// the same token can't both succeed.
+func (pr *pgRepo) UseToken(ctx context.Context, purpose, hash string) (*model.UserToken, error) {
+	var pgTok pgUserToken
+	now := time.Now()
+
+	tx := txmanager.DB(ctx, pr.db).Model(&pgTok).Clauses(clause.Returning{}).
+		Where("purpose = ? AND token_hash = ? AND used_at IS NULL AND expires_at > ?", purpose, hash, now).
+		Update("used_at", now)
+	if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table user_tokens)")
+	} else if tx.RowsAffected == 0 {
+		return nil, model.ErrNotFound
+	}
+
+	return pgTok.toModelUserToken(), nil
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ell1jah/bmstu_web/internal/pkg/txmanager"
+	"github.com/ell1jah/bmstu_web/model"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type pgUserTOTP struct {
+	UserID    uint64 `gorm:"primaryKey"`
+	Secret    string
+	Enabled   bool
+	LastStep  int64
+	CreatedAt time.Time
+}
+
+func (t pgUserTOTP) toModelUserTOTP() *model.UserTOTP {
+	return &model.UserTOTP{
+		UserID:   t.UserID,
+		Secret:   t.Secret,
+		Enabled:  t.Enabled,
+		LastStep: t.LastStep,
+	}
+}
+
+func (pgUserTOTP) TableName() string {
+	return "user_totp"
+}
+
+type pgRecoveryCode struct {
+	ID       uint64
+	UserID   uint64
+	CodeHash string
+	UsedAt   sql.NullTime
+}
+
+func (pgRecoveryCode) TableName() string {
+	return "user_recovery_codes"
+}
+
+func (pr *pgRepo) GetTOTP(ctx context.Context, userId uint64) (*model.UserTOTP, error) {
+	var pgTOTP pgUserTOTP
+
+	tx := txmanager.DB(ctx, pr.db).Where("user_id = ?", userId).Take(&pgTOTP)
+	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		return nil, model.ErrNotFound
+	} else if tx.Error != nil {
+		return nil, errors.Wrap(tx.Error, "database error (table user_totp)")
+	}
+
+	return pgTOTP.toModelUserTOTP(), nil
+}
+
+// SaveTOTP replaces a pending enrollment, an enabled one is left untouched.
+func (pr *pgRepo) SaveTOTP(ctx context.Context, userTOTP *model.UserTOTP) error {
+	pgTOTP := pgUserTOTP{
+		UserID:    userTOTP.UserID,
+		Secret:    userTOTP.Secret,
+		CreatedAt: time.Now(),
+	}
+
+	tx := txmanager.DB(ctx, pr.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_step", "created_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "NOT user_totp.enabled"}}},
+	}).Create(&pgTOTP)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table user_totp)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrConflictTwoFactor
+	}
+
+	return nil
+}
+
+// EnableTOTP enables the enrollment and replaces the recovery codes in one transaction.
+func (pr *pgRepo) EnableTOTP(ctx context.Context, userId uint64, lastStep int64, codeHashes []string) error {
+	err := txmanager.DB(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&pgUserTOTP{}).Where("user_id = ? AND NOT enabled", userId).
+			Updates(map[string]interface{}{"enabled": true, "last_step": lastStep})
+		if res.Error != nil {
+			return res.Error
+		} else if res.RowsAffected == 0 {
+			return model.ErrNotFound
+		}
+
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+	if errors.Is(err, model.ErrNotFound) {
+		return model.ErrNotFound
+	} else if err != nil {
+		return errors.Wrap(err, "database error (table user_totp)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) DeleteTOTP(ctx context.Context, userId uint64) error {
+	err := txmanager.DB(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ?", userId).Delete(&pgRecoveryCode{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userId).Delete(&pgUserTOTP{}).Error
+	})
+	if err != nil {
+		return errors.Wrap(err, "database error (table user_totp)")
+	}
+
+	return nil
+}
+
+// UseTOTPStep records step as used. It returns model.ErrNotFound if the same
+// or a later step was used already, so a code works only once.
+func (pr *pgRepo) UseTOTPStep(ctx context.Context, userId uint64, step int64) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgUserTOTP{}).Where("user_id = ? AND last_step < ?", userId, step).
+		Update("last_step", step)
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table user_totp)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) ReplaceRecoveryCodes(ctx context.Context, userId uint64, codeHashes []string) error {
+	err := txmanager.DB(ctx, pr.db).Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userId, codeHashes)
+	})
+	if err != nil {
+		return errors.Wrap(err, "database error (table user_recovery_codes)")
+	}
+
+	return nil
+}
+
+func (pr *pgRepo) UseRecoveryCode(ctx context.Context, userId uint64, codeHash string) error {
+	tx := txmanager.DB(ctx, pr.db).Model(&pgRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, codeHash).
+		Update("used_at", time.Now())
+	if tx.Error != nil {
+		return errors.Wrap(tx.Error, "database error (table user_recovery_codes)")
+	} else if tx.RowsAffected == 0 {
+		return model.ErrNotFound
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId uint64, codeHashes []string) error {
+	err := tx.Where("user_id = ?", userId).Delete(&pgRecoveryCode{}).Error
+	if err != nil {
+		return err
+	}
+
+	codes := make([]pgRecoveryCode, len(codeHashes))
+	for i := range codes {
+		codes[i] = pgRecoveryCode{UserID: userId, CodeHash: codeHashes[i]}
+	}
+
+	return tx.Create(&codes).Error
+}
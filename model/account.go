@@ -0,0 +1,19 @@
+package model
+
+// AccountExport is everything a user has put into the service.
+type AccountExport struct {
+	User       *User
+	Identities []*UserIdentity
+	Posts      []*Post
+	Comments   []*Comment
+	Rates      []*PostRate
+	// post images and the avatar
+	ImageIDs []string
+}
+
+// DeletionConfirm is the password of the account or, for accounts created
+// by an identity provider, the code mailed to the user.
+type DeletionConfirm struct {
+	Password string
+	Code     string
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+)
+
+const APITokenPrefix = "clt_"
+
+// A scope is "read" for the read requests or "<resource>:write". Every route
+// taking API tokens declares the one it needs, the account management ones
+// take none and are left to sessions.
+const (
+	ScopeRead             = "read"
+	ScopePostsWrite       = "posts:write"
+	ScopeImagesWrite      = "images:write"
+	ScopeCommentsWrite    = "comments:write"
+	ScopeCollectionsWrite = "collections:write"
+)
+
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeRead, ScopePostsWrite, ScopeImagesWrite, ScopeCommentsWrite, ScopeCollectionsWrite:
+		return true
+	default:
+		return false
+	}
+}
+
+// APIToken is a personal access token. Only its hash is stored, Prefix is
+// kept to tell the tokens apart.
+type APIToken struct {
+	ID         uint64
+	UserID     uint64
+	Name       string
+	Hash       string
+	Prefix     string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+func (t *APIToken) Allows(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !t.ExpiresAt.After(now)
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type Collection struct {
+	ID       uint64
+	UserID   uint64
+	Date     time.Time
+	Name     string
+	IsPublic bool
+	PostCnt  int
+	Posts    []*Post
+}
@@ -9,4 +9,5 @@ type Comment struct {
 	PostID   uint64
 	Date     time.Time
 	Body     string
+	IsHidden bool
 }
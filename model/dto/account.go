@@ -0,0 +1,106 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type ReqDeleteAccount struct {
+	Password string `json:"password" valid:"maxstringlength(128),optional"`
+	// mailed to the accounts created by an identity provider
+	Code string `json:"code" valid:"maxstringlength(64),optional"`
+}
+
+func (rd *ReqDeleteAccount) ToDeletionConfirm() *model.DeletionConfirm {
+	return &model.DeletionConfirm{
+		Password: rd.Password,
+		Code:     rd.Code,
+	}
+}
+
+type RespExportProfile struct {
+	Profile    *RespGetMe      `json:"profile"`
+	Identities []*RespIdentity `json:"identities"`
+}
+
+func RespExportProfileFromExport(export *model.AccountExport) *RespExportProfile {
+	return &RespExportProfile{
+		Profile:    RespGetMeFromUser(export.User),
+		Identities: RespIdentitiesFromIdentities(export.Identities),
+	}
+}
+
+type RespExportPost struct {
+	ID          uint64    `json:"postID"`
+	Date        time.Time `json:"createDate"`
+	ImageID     string    `json:"photoID"`
+	Category    string    `json:"category"`
+	Sex         string    `json:"sex"`
+	Brand       string    `json:"brand"`
+	Description string    `json:"description"`
+	Link        string    `json:"link"`
+	IsHidden    bool      `json:"isHidden"`
+}
+
+func RespExportPostsFromPosts(posts []*model.Post) []*RespExportPost {
+	resp := make([]*RespExportPost, len(posts))
+	for i, post := range posts {
+		resp[i] = &RespExportPost{
+			ID:          post.ID,
+			Date:        post.Date,
+			ImageID:     post.ImageID,
+			Category:    post.Category,
+			Sex:         post.Sex,
+			Brand:       post.Brand,
+			Description: post.Description,
+			Link:        post.Link,
+			IsHidden:    post.IsHidden,
+		}
+	}
+
+	return resp
+}
+
+type RespExportComment struct {
+	ID       uint64    `json:"commentID"`
+	PostID   uint64    `json:"postID"`
+	Date     time.Time `json:"createDate"`
+	Body     string    `json:"message"`
+	IsHidden bool      `json:"isHidden"`
+}
+
+func RespExportCommentsFromComments(comments []*model.Comment) []*RespExportComment {
+	resp := make([]*RespExportComment, len(comments))
+	for i, c := range comments {
+		resp[i] = &RespExportComment{
+			ID:       c.ID,
+			PostID:   c.PostID,
+			Date:     c.Date,
+			Body:     c.Body,
+			IsHidden: c.IsHidden,
+		}
+	}
+
+	return resp
+}
+
+type RespExportRate struct {
+	PostID uint64 `json:"postID"`
+	Rate   string `json:"rate"`
+}
+
+func RespExportRatesFromRates(rates []*model.PostRate) []*RespExportRate {
+	resp := make([]*RespExportRate, len(rates))
+	for i, rt := range rates {
+		resp[i] = &RespExportRate{
+			PostID: rt.PostID,
+			Rate:   "dislike",
+		}
+		if rt.Rate == model.Like {
+			resp[i].Rate = "like"
+		}
+	}
+
+	return resp
+}
@@ -0,0 +1,77 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type ReqAPIToken struct {
+	Name          string   `json:"name" valid:"printableascii,maxstringlength(64)"`
+	Scopes        []string `json:"scopes" valid:"-"`
+	ExpiresInDays int      `json:"expiresInDays" valid:"range(1|3650),optional"`
+}
+
+func (rt *ReqAPIToken) ToAPIToken(userId uint64) *model.APIToken {
+	token := &model.APIToken{
+		UserID: userId,
+		Name:   rt.Name,
+		Scopes: rt.Scopes,
+	}
+
+	if rt.ExpiresInDays != 0 {
+		token.ExpiresAt = time.Now().AddDate(0, 0, rt.ExpiresInDays)
+	}
+
+	return token
+}
+
+type RespAPIToken struct {
+	ID         uint64     `json:"tokenID"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+}
+
+func RespAPITokenFromAPIToken(token *model.APIToken) *RespAPIToken {
+	resp := &RespAPIToken{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+	}
+
+	if !token.LastUsedAt.IsZero() {
+		resp.LastUsedAt = &token.LastUsedAt
+	}
+	if !token.ExpiresAt.IsZero() {
+		resp.ExpiresAt = &token.ExpiresAt
+	}
+
+	return resp
+}
+
+func RespAPITokensFromAPITokens(tokens []*model.APIToken) []*RespAPIToken {
+	resp := make([]*RespAPIToken, len(tokens))
+	for i := range resp {
+		resp[i] = RespAPITokenFromAPIToken(tokens[i])
+	}
+
+	return resp
+}
+
+type RespCreatedAPIToken struct {
+	RespAPIToken
+	Token string `json:"token"`
+}
+
+func RespCreatedAPITokenFromAPIToken(token *model.APIToken, raw string) *RespCreatedAPIToken {
+	return &RespCreatedAPIToken{
+		RespAPIToken: *RespAPITokenFromAPIToken(token),
+		Token:        raw,
+	}
+}
@@ -0,0 +1,55 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type RespCollection struct {
+	ID       uint64      `json:"collectionID"`
+	UserID   uint64      `json:"creatorID"`
+	Date     time.Time   `json:"createDate"`
+	Name     string      `json:"name"`
+	IsPublic bool        `json:"isPublic"`
+	PostCnt  int         `json:"postCnt"`
+	Posts    []*RespPost `json:"posts,omitempty"`
+}
+
+func RespCollectionFromCollection(c *model.Collection) *RespCollection {
+	resp := &RespCollection{
+		ID:       c.ID,
+		UserID:   c.UserID,
+		Date:     c.Date,
+		Name:     c.Name,
+		IsPublic: c.IsPublic,
+		PostCnt:  c.PostCnt,
+	}
+
+	if c.Posts != nil {
+		resp.Posts = RespPostsFromPosts(c.Posts)
+	}
+
+	return resp
+}
+
+func RespCollectionsFromCollections(collections []*model.Collection) []*RespCollection {
+	resp := make([]*RespCollection, len(collections))
+	for i := range resp {
+		resp[i] = RespCollectionFromCollection(collections[i])
+	}
+
+	return resp
+}
+
+type ReqCollection struct {
+	Name     string `json:"name" valid:"minstringlength(1),maxstringlength(64)"`
+	IsPublic bool   `json:"isPublic" valid:"-"`
+}
+
+func (rc *ReqCollection) ToCollection() *model.Collection {
+	return &model.Collection{
+		Name:     rc.Name,
+		IsPublic: rc.IsPublic,
+	}
+}
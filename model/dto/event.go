@@ -0,0 +1,31 @@
+package dto
+
+import (
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type RespEvent struct {
+	Type       string       `json:"type"`
+	PostID     uint64       `json:"postID"`
+	Comment    *RespComment `json:"comment,omitempty"`
+	LikeCnt    *int         `json:"likeCnt,omitempty"`
+	DislikeCnt *int         `json:"dislikeCnt,omitempty"`
+}
+
+func RespEventFromEvent(event *model.Event) *RespEvent {
+	resp := &RespEvent{
+		Type:   event.Type,
+		PostID: event.PostID,
+	}
+
+	if event.Comment != nil {
+		resp.Comment = RespCommentFromComment(event.Comment)
+	}
+
+	if event.RatesCnts != nil {
+		resp.LikeCnt = &event.RatesCnts.LikeCnt
+		resp.DislikeCnt = &event.RatesCnts.DislikeCnt
+	}
+
+	return resp
+}
@@ -0,0 +1,40 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type RespIdentity struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func RespIdentityFromIdentity(identity *model.UserIdentity) *RespIdentity {
+	return &RespIdentity{
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt,
+	}
+}
+
+func RespIdentitiesFromIdentities(identities []*model.UserIdentity) []*RespIdentity {
+	resp := make([]*RespIdentity, len(identities))
+	for i := range resp {
+		resp[i] = RespIdentityFromIdentity(identities[i])
+	}
+
+	return resp
+}
+
+type RespURL struct {
+	URL string `json:"url"`
+}
+
+func RespURLFromString(url string) *RespURL {
+	return &RespURL{
+		URL: url,
+	}
+}
@@ -21,6 +21,8 @@ type RespPost struct {
 	DislikeCnt  int       `json:"dislikeCnt"`
 	IsLiked     bool      `json:"isLiked"`
 	IsDisliked  bool      `json:"isDisliked"`
+	SaveCnt     int       `json:"saveCnt"`
+	IsSaved     bool      `json:"isSaved"`
 }
 
 func RespPostFromPost(post *model.Post) *RespPost {
@@ -39,6 +41,8 @@ func RespPostFromPost(post *model.Post) *RespPost {
 		DislikeCnt:  post.DislikeCnt,
 		IsLiked:     post.IsLiked,
 		IsDisliked:  post.IsDisliked,
+		SaveCnt:     post.SaveCnt,
+		IsSaved:     post.IsSaved,
 	}
 }
 
@@ -74,11 +78,48 @@ func (rp *ReqPost) ToPost() *model.Post {
 type ReqPostParams struct {
 	Category string `query:"category" valid:"in(shoes|outerwear|underwear|accessories),optional"`
 	Sex      string `query:"sex" valid:"in(male|female),optional"`
+	Sort     string `query:"sort" valid:"in(new|hot),optional"`
+	Limit    int    `query:"limit" valid:"range(1|100),optional"`
+	Offset   int    `query:"offset" valid:"range(0|1000000),optional"`
 }
 
 func (rpp *ReqPostParams) ToPostParams() *model.PostParams {
 	return &model.PostParams{
 		Category: rpp.Category,
 		Sex:      rpp.Sex,
+		Sort:     rpp.Sort,
+		Limit:    rpp.Limit,
+		Offset:   rpp.Offset,
+	}
+}
+
+var trendingWindows = map[string]time.Duration{
+	"24h": 24 * time.Hour,
+	"7d":  7 * 24 * time.Hour,
+}
+
+// ReqTrendingParams.Window is 24h if not given.
+type ReqTrendingParams struct {
+	Window   string `query:"window" valid:"in(24h|7d),optional"`
+	Category string `query:"category" valid:"in(shoes|outerwear|underwear|accessories),optional"`
+	Sex      string `query:"sex" valid:"in(male|female),optional"`
+	Limit    int    `query:"limit" valid:"range(1|100),optional"`
+	Offset   int    `query:"offset" valid:"range(0|1000000),optional"`
+}
+
+func (rtp *ReqTrendingParams) ToWindow() time.Duration {
+	if rtp.Window == "" {
+		return trendingWindows["24h"]
+	}
+
+	return trendingWindows[rtp.Window]
+}
+
+func (rtp *ReqTrendingParams) ToPostParams() *model.PostParams {
+	return &model.PostParams{
+		Category: rtp.Category,
+		Sex:      rtp.Sex,
+		Limit:    rtp.Limit,
+		Offset:   rtp.Offset,
 	}
 }
@@ -0,0 +1,86 @@
+package dto
+
+import (
+	"time"
+
+	"github.com/ell1jah/bmstu_web/model"
+)
+
+type RespReport struct {
+	ID          uint64     `json:"reportID"`
+	ReporterID  uint64     `json:"reporterID"`
+	TargetType  string     `json:"targetType"`
+	TargetID    uint64     `json:"targetID"`
+	AuthorID    uint64     `json:"authorID"`
+	Reason      string     `json:"reason"`
+	Details     string     `json:"details"`
+	Status      string     `json:"status"`
+	Date        time.Time  `json:"createDate"`
+	ModeratorID uint64     `json:"moderatorID,omitempty"`
+	ResolvedAt  *time.Time `json:"resolveDate,omitempty"`
+}
+
+func RespReportFromReport(r *model.Report) *RespReport {
+	resp := &RespReport{
+		ID:          r.ID,
+		ReporterID:  r.ReporterID,
+		TargetType:  r.TargetType,
+		TargetID:    r.TargetID,
+		AuthorID:    r.AuthorID,
+		Reason:      r.Reason,
+		Details:     r.Details,
+		Status:      r.Status,
+		Date:        r.Date,
+		ModeratorID: r.ModeratorID,
+	}
+
+	if !r.ResolvedAt.IsZero() {
+		resp.ResolvedAt = &r.ResolvedAt
+	}
+
+	return resp
+}
+
+func RespReportsFromReports(reports []*model.Report) []*RespReport {
+	resp := make([]*RespReport, len(reports))
+	for i := range resp {
+		resp[i] = RespReportFromReport(reports[i])
+	}
+
+	return resp
+}
+
+type ReqReport struct {
+	Reason  string `json:"reason" valid:"in(spam|counterfeit|offensive|other)"`
+	Details string `json:"details" valid:"maxstringlength(1000),optional"`
+}
+
+func (rr *ReqReport) ToReport() *model.Report {
+	return &model.Report{
+		Reason:  rr.Reason,
+		Details: rr.Details,
+	}
+}
+
+type ReqReportParams struct {
+	Status string `query:"status" valid:"in(open|resolved|dismissed|content_deleted|author_suspended),optional"`
+}
+
+const defaultSuspendDays = 7
+
+type ReqResolution struct {
+	Status      string `json:"status" valid:"in(resolved|dismissed|content_deleted|author_suspended)"`
+	SuspendDays int    `json:"suspendDays" valid:"range(1|3650),optional"`
+}
+
+func (rr *ReqResolution) ToResolution() *model.ReportResolution {
+	days := rr.SuspendDays
+	if days == 0 {
+		days = defaultSuspendDays
+	}
+
+	return &model.ReportResolution{
+		Status:       rr.Status,
+		SuspendUntil: time.Now().AddDate(0, 0, days),
+	}
+}
@@ -1,21 +1,122 @@
 package dto
 
 import (
+	"time"
+
 	"github.com/ell1jah/bmstu_web/model"
 )
 
 type RespGetMe struct {
-	ID    uint64 `json:"userID"`
-	Login string `json:"login"`
+	ID            uint64    `json:"userID"`
+	Login         string    `json:"login"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"emailVerified"`
+	Role          string    `json:"role"`
+	DisplayName   string    `json:"displayName"`
+	Bio           string    `json:"bio"`
+	AvatarID      string    `json:"avatarID"`
+	Website       string    `json:"website"`
+	MemberSince   time.Time `json:"memberSince"`
 }
 
 func RespGetMeFromUser(user *model.User) *RespGetMe {
 	return &RespGetMe{
-		ID:    user.ID,
-		Login: user.Login,
+		ID:            user.ID,
+		Login:         user.Login,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarID:      user.AvatarID,
+		Website:       user.Website,
+		MemberSince:   user.CreatedAt,
+	}
+}
+
+type RespProfile struct {
+	ID           uint64    `json:"userID"`
+	Login        string    `json:"login"`
+	DisplayName  string    `json:"displayName"`
+	Bio          string    `json:"bio"`
+	AvatarID     string    `json:"avatarID"`
+	Website      string    `json:"website"`
+	MemberSince  time.Time `json:"memberSince"`
+	PostCnt      int       `json:"postCnt"`
+	LikeCnt      int       `json:"likeCnt"`
+	DislikeCnt   int       `json:"dislikeCnt"`
+	FollowerCnt  int       `json:"followerCnt"`
+	FollowingCnt int       `json:"followingCnt"`
+	IsFollowed   bool      `json:"isFollowed"`
+}
+
+func RespProfileFromProfile(profile *model.UserProfile) *RespProfile {
+	return &RespProfile{
+		ID:           profile.ID,
+		Login:        profile.Login,
+		DisplayName:  profile.DisplayName,
+		Bio:          profile.Bio,
+		AvatarID:     profile.AvatarID,
+		Website:      profile.Website,
+		MemberSince:  profile.CreatedAt,
+		PostCnt:      profile.PostCnt,
+		LikeCnt:      profile.LikeCnt,
+		DislikeCnt:   profile.DislikeCnt,
+		FollowerCnt:  profile.FollowerCnt,
+		FollowingCnt: profile.FollowingCnt,
+		IsFollowed:   profile.IsFollowed,
+	}
+}
+
+type ReqProfile struct {
+	DisplayName *string `json:"displayName" valid:"maxstringlength(64),optional"`
+	Bio         *string `json:"bio" valid:"maxstringlength(1000),optional"`
+	AvatarID    *string `json:"avatarID" valid:"alphanum,maxstringlength(260),optional"`
+	Website     *string `json:"website" valid:"url,maxstringlength(260),optional"`
+}
+
+func (rp *ReqProfile) ToProfileUpdate() *model.UserProfileUpdate {
+	return &model.UserProfileUpdate{
+		DisplayName: rp.DisplayName,
+		Bio:         rp.Bio,
+		AvatarID:    rp.AvatarID,
+		Website:     rp.Website,
+	}
+}
+
+type ReqRole struct {
+	Role string `json:"role" valid:"in(user|moderator|admin)"`
+}
+
+func (rr *ReqRole) ToUserRole() *model.UserRole {
+	return &model.UserRole{
+		Role: rr.Role,
 	}
 }
 
+type ReqStatus struct {
+	Status      string `json:"status" valid:"in(active|suspended|banned)"`
+	SuspendDays int    `json:"suspendDays" valid:"range(1|3650),optional"`
+	Reason      string `json:"reason" valid:"maxstringlength(1000),optional"`
+}
+
+func (rs *ReqStatus) ToUserStatus() *model.UserStatus {
+	status := &model.UserStatus{
+		Status: rs.Status,
+		Reason: rs.Reason,
+	}
+
+	if rs.Status == model.UserSuspended {
+		days := rs.SuspendDays
+		if days == 0 {
+			days = defaultSuspendDays
+		}
+		status.SuspendedUntil = time.Now().AddDate(0, 0, days)
+	}
+
+	return status
+}
+
 type ReqСhangePass struct {
 	Old string `json:"oldPassword" valid:"minstringlength(5)"`
 	New string `json:"newPassword" valid:"minstringlength(5)"`
@@ -31,15 +132,73 @@ func (rcp *ReqСhangePass) ToChangePass() *model.UserChangePass {
 type ReqSign struct {
 	Login    string `json:"login" valid:"minstringlength(5)"`
 	Password string `json:"password" valid:"minstringlength(5)"`
+	Email    string `json:"email" valid:"email,maxstringlength(254),optional"`
 }
 
 func (rs *ReqSign) ToUser() *model.User {
 	return &model.User{
 		Login:    rs.Login,
 		Password: rs.Password,
+		Email:    rs.Email,
 	}
 }
 
+type RespChallenge struct {
+	Challenge         string `json:"challenge"`
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+}
+
+func RespChallengeFromString(challenge string) *RespChallenge {
+	return &RespChallenge{
+		Challenge:         challenge,
+		TwoFactorRequired: true,
+	}
+}
+
+type ReqSecondFactor struct {
+	Challenge string `json:"challenge" valid:"printableascii,maxstringlength(128)"`
+	Code      string `json:"code" valid:"printableascii,maxstringlength(32)"`
+}
+
+type ReqCode struct {
+	Code string `json:"code" valid:"printableascii,maxstringlength(32)"`
+}
+
+type RespTOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func RespTOTPEnrollmentFromEnrollment(enrollment *model.TOTPEnrollment) *RespTOTPEnrollment {
+	return &RespTOTPEnrollment{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	}
+}
+
+type RespRecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+func RespRecoveryCodesFromCodes(codes []string) *RespRecoveryCodes {
+	return &RespRecoveryCodes{
+		Codes: codes,
+	}
+}
+
+type ReqEmail struct {
+	Email string `json:"email" valid:"email,maxstringlength(254)"`
+}
+
+type ReqToken struct {
+	Token string `json:"token" valid:"printableascii,maxstringlength(128)"`
+}
+
+type ReqResetPass struct {
+	Token    string `json:"token" valid:"printableascii,maxstringlength(128)"`
+	Password string `json:"password" valid:"minstringlength(5)"`
+}
+
 type RespToken struct {
 	Token string `json:"token"`
 }
@@ -49,3 +208,28 @@ func RespTokenFromString(token string) *RespToken {
 		Token: token,
 	}
 }
+
+type RespUser struct {
+	ID          uint64 `json:"userID"`
+	Login       string `json:"login"`
+	DisplayName string `json:"displayName"`
+	AvatarID    string `json:"avatarID"`
+}
+
+func RespUserFromUser(user *model.User) *RespUser {
+	return &RespUser{
+		ID:          user.ID,
+		Login:       user.Login,
+		DisplayName: user.DisplayName,
+		AvatarID:    user.AvatarID,
+	}
+}
+
+func RespUsersFromUsers(users []*model.User) []*RespUser {
+	resp := make([]*RespUser, len(users))
+	for i := range resp {
+		resp[i] = RespUserFromUser(users[i])
+	}
+
+	return resp
+}
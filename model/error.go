@@ -10,9 +10,19 @@ var (
 	ErrConflictEmail       = errors.New("email already exists")
 	ErrBadRequest          = errors.New("bad request")
 	ErrConflictFriend      = errors.New("friend already exists")
+	ErrConflictReport      = errors.New("report already exists")
+	ErrUserSuspended       = errors.New("user is suspended")
+	ErrUserBanned          = errors.New("user is banned")
+	ErrUserDeleted         = errors.New("user is deleted")
 	ErrUnauthorized        = errors.New("no cookie")
 	ErrInternalServerError = errors.New("internal server error")
 	ErrEmptyCsrf           = errors.New("empty csrf token")
 	ErrInvalidCsrf         = errors.New("invalid csrf")
 	ErrPermissionDenied    = errors.New("permission denied")
+	ErrTooManyRequests     = errors.New("too many requests")
+	ErrInvalidToken        = errors.New("invalid or expired token")
+	ErrWeakPassword        = errors.New("password is too weak")
+	ErrInvalidCode         = errors.New("invalid code")
+	ErrConflictTwoFactor   = errors.New("two-factor authentication already enabled")
+	ErrConflictIdentity    = errors.New("identity is linked to another user")
 )
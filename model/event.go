@@ -0,0 +1,14 @@
+package model
+
+const (
+	EventComment        = "comment"
+	EventCommentDeleted = "comment_deleted"
+	EventRate           = "rate"
+)
+
+type Event struct {
+	Type      string
+	PostID    uint64
+	Comment   *Comment
+	RatesCnts *RatesCnts
+}
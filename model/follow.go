@@ -0,0 +1,6 @@
+package model
+
+type FollowCnts struct {
+	FollowerCnt  int
+	FollowingCnt int
+}
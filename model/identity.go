@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// ExternalIdentity is what an identity provider tells about a signed in user.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+}
+
+type UserIdentity struct {
+	ID        uint64
+	UserID    uint64
+	Provider  string
+	Subject   string
+	Email     string
+	CreatedAt time.Time
+}
+
+// OIDCLogin is a started login at a provider waiting for its callback.
+// UserID is set when an existing user links the identity.
+type OIDCLogin struct {
+	StateHash    string
+	Provider     string
+	CodeVerifier string
+	Nonce        string
+	UserID       uint64
+	ExpiresAt    time.Time
+}
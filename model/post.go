@@ -17,11 +17,28 @@ type Post struct {
 	DislikeCnt  int
 	IsLiked     bool
 	IsDisliked  bool
+	SaveCnt     int
+	IsSaved     bool
+	IsHidden    bool
 }
 
+// orders of the posts, newest first unless PostParams.Sort is another one
+const (
+	SortNew = "new"
+	// by PostScore.Hot
+	SortHot = "hot"
+	// by PostScore.Score
+	SortTop = "top"
+)
+
+// PostParams.Since, if set, leaves out the posts made before it.
 type PostParams struct {
 	Sex      string
 	Category string
+	Sort     string
+	Since    time.Time
+	Limit    int
+	Offset   int
 }
 
 func (pp PostParams) ToPost() *Post {
@@ -30,3 +47,20 @@ func (pp PostParams) ToPost() *Post {
 		Category: pp.Category,
 	}
 }
+
+// PostStats are the numbers a post is ranked by.
+type PostStats struct {
+	PostID     uint64
+	Date       time.Time
+	LikeCnt    int
+	DislikeCnt int
+	CommentCnt int
+}
+
+// PostScore is the rank of a post as of its last scoring: Score counts its
+// votes, Hot weighs them against its age.
+type PostScore struct {
+	PostID uint64
+	Score  int
+	Hot    float64
+}
@@ -7,6 +7,11 @@ const (
 
 type Rate bool
 
+type PostRate struct {
+	PostID uint64
+	Rate   Rate
+}
+
 type RatesCnts struct {
 	LikeCnt    int
 	DislikeCnt int
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+const (
+	ReportTargetPost    = "post"
+	ReportTargetComment = "comment"
+)
+
+const (
+	ReportReasonSpam        = "spam"
+	ReportReasonCounterfeit = "counterfeit"
+	ReportReasonOffensive   = "offensive"
+	ReportReasonOther       = "other"
+)
+
+const (
+	ReportOpen            = "open"
+	ReportResolved        = "resolved"
+	ReportDismissed       = "dismissed"
+	ReportContentDeleted  = "content_deleted"
+	ReportAuthorSuspended = "author_suspended"
+)
+
+type Report struct {
+	ID          uint64
+	ReporterID  uint64
+	TargetType  string
+	TargetID    uint64
+	AuthorID    uint64
+	Reason      string
+	Details     string
+	Status      string
+	Date        time.Time
+	ModeratorID uint64
+	ResolvedAt  time.Time
+}
+
+type ReportResolution struct {
+	ReportID      uint64
+	ModeratorID   uint64
+	ModeratorRole string
+	Status        string
+	SuspendUntil  time.Time
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+	TokenSignIn        = "signin_challenge"
+	TokenDeleteAccount = "delete_account"
+)
+
+// UserToken is a single-use token sent to the user by mail or handed out
+// between the sign-in steps.
+// Only the hash of the token is stored.
+type UserToken struct {
+	ID        uint64
+	UserID    uint64
+	Purpose   string
+	Hash      string
+	Email     string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,20 @@
+package model
+
+type UserTOTP struct {
+	UserID   uint64
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// SignInResult holds the signed in user or, if the user has two-factor
+// authentication enabled, the challenge to exchange together with a code.
+type SignInResult struct {
+	User      *User
+	Challenge string
+}
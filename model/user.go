@@ -1,9 +1,41 @@
 package model
 
+import "time"
+
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	UserBanned    = "banned"
+	// set when the owner deletes the account, the rest of it goes in background
+	UserDeleted = "deleted"
+)
+
 type User struct {
-	ID       uint64
-	Login    string
-	Password string
+	ID             uint64
+	Login          string
+	Password       string
+	HasPassword    bool
+	Email          string
+	EmailVerified  bool
+	Role           string
+	DisplayName    string
+	Bio            string
+	AvatarID       string
+	Website        string
+	CreatedAt      time.Time
+	Status         string
+	SuspendedUntil time.Time
+	StatusReason   string
+}
+
+func (u *User) ToUserStatus() *UserStatus {
+	return &UserStatus{
+		ID:             u.ID,
+		Role:           u.Role,
+		Status:         u.Status,
+		SuspendedUntil: u.SuspendedUntil,
+		Reason:         u.StatusReason,
+	}
 }
 
 type UserChangePass struct {
@@ -11,3 +43,50 @@ type UserChangePass struct {
 	Old string
 	New string
 }
+
+type UserRole struct {
+	ID   uint64
+	Role string
+}
+
+type UserStatus struct {
+	ID             uint64
+	Role           string
+	Status         string
+	SuspendedUntil time.Time
+	Reason         string
+	ChangedBy      uint64
+}
+
+// Blocked returns the reason the user can't use the service at the given
+// moment, or nil. A suspension ends by itself once SuspendedUntil passes.
+func (us *UserStatus) Blocked(now time.Time) error {
+	switch {
+	case us.Status == UserBanned:
+		return ErrUserBanned
+	case us.Status == UserDeleted:
+		return ErrUserDeleted
+	case us.Status == UserSuspended && us.SuspendedUntil.After(now):
+		return ErrUserSuspended
+	default:
+		return nil
+	}
+}
+
+type UserProfile struct {
+	User
+	PostCnt      int
+	LikeCnt      int
+	DislikeCnt   int
+	FollowerCnt  int
+	FollowingCnt int
+	IsFollowed   bool
+}
+
+type UserProfileUpdate struct {
+	ID          uint64
+	DisplayName *string
+	Bio         *string
+	AvatarID    *string
+	Website     *string
+}